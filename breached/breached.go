@@ -0,0 +1,74 @@
+// Package breached checks passwords against an offline copy of a
+// breached password list, such as the Pwned Passwords range files.
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PrefixLength is how many hex digits of the SHA-1 hash name the file
+// holding it
+const PrefixLength = 5
+
+// Dir is a directory of range files, one for each hash prefix. The file
+// <PREFIX> or <PREFIX>.txt holds a SUFFIX:COUNT line for every breached
+// password whose upper case SHA-1 hash starts with PREFIX, the format
+// served by the k-anonymity range API and saved by its downloader. A
+// missing file has no breached passwords, so a partial list works too.
+type Dir struct {
+	path string
+}
+
+// Open returns the list in the directory at path
+func Open(path string) (*Dir, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached: %s is not a directory", path)
+	}
+	return &Dir{path: path}, nil
+}
+
+// Contains reports whether password is on the list
+func (d *Dir) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:PrefixLength], hash[PrefixLength:]
+
+	f, err := d.open(prefix)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (d *Dir) open(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(d.path, prefix+".txt"))
+	if os.IsNotExist(err) {
+		return os.Open(filepath.Join(d.path, prefix))
+	}
+	return f, err
+}
@@ -19,6 +19,8 @@ import BookState from './context/book/BookState';
 import ReviewState from './context/review/ReviewState';
 import ForgotPassword from './components/auth/ForgotPassword';
 import ResetPassword from './components/auth/ResetPassword';
+import VerifyEmail from './components/auth/VerifyEmail';
+import UnlockAccount from './components/auth/UnlockAccount';
 
 const App = () => {
 	return (
@@ -40,6 +42,8 @@ const App = () => {
 										<Route exact path="/home" component={Home} />
 										<Route exact path="/forgot" component={ForgotPassword} />
 										<Route exact path="/reset" component={ResetPassword} />
+										<Route exact path="/verify" component={VerifyEmail} />
+										<Route exact path="/unlock" component={UnlockAccount} />
 										<Route component={NotFound} />
 									</Switch>
 								</div>
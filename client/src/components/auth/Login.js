@@ -1,5 +1,6 @@
 import React, { useState, useContext, useEffect } from 'react';
 import { Link } from 'react-router-dom';
+import { serverURL } from '../../utils/helper';
 import styled from 'styled-components';
 import AuthContext from '../../context/auth/authContext';
 import AlertContext from '../../context/alert/alertContext';
@@ -8,7 +9,17 @@ const Login = (props) => {
 	const authContext = useContext(AuthContext);
 	const alertContext = useContext(AlertContext);
 
-	const { login, error, isAuthenticated, clearErrors } = authContext;
+	const {
+		login,
+		loginTwoFactor,
+		challenge,
+		setChallenge,
+		providers,
+		getProviders,
+		error,
+		isAuthenticated,
+		clearErrors
+	} = authContext;
 	const { setAlert } = alertContext;
 
 	useEffect(
@@ -19,7 +30,7 @@ const Login = (props) => {
 			if (error === 'resource not found') {
 				setAlert('User not found', 'danger');
 				clearErrors();
-			} else if (error === 'incorrect password provided') {
+			} else if (error) {
 				setAlert(error, 'danger');
 				clearErrors();
 			}
@@ -28,6 +39,22 @@ const Login = (props) => {
 		[ error, isAuthenticated, props.history ]
 	);
 
+	//* identity providers send users back here with an error or a two-factor challenge
+	useEffect(
+		() => {
+			getProviders();
+			const params = new URLSearchParams(window.location.search);
+			if (params.get('error')) {
+				setAlert(params.get('error'), 'danger');
+			}
+			if (params.get('challenge')) {
+				setChallenge(params.get('challenge'));
+			}
+		},
+		// eslint-disable-next-line
+		[]
+	);
+
 	const [ user, setUser ] = useState({
 		email: '',
 		password: ''
@@ -35,6 +62,8 @@ const Login = (props) => {
 
 	const { email, password } = user;
 
+	const [ code, setCode ] = useState('');
+
 	const onChange = (e) => setUser({ ...user, [e.target.name]: e.target.value });
 
 	const onSubmit = (e) => {
@@ -49,6 +78,42 @@ const Login = (props) => {
 		}
 	};
 
+	const onSubmitCode = (e) => {
+		e.preventDefault();
+		if (code === '') {
+			setAlert('Please enter the code from your authenticator app', 'danger');
+		} else {
+			loginTwoFactor(code);
+		}
+	};
+
+	if (challenge) {
+		return (
+			<FormContainer>
+				<FormTitle>
+					Two-Factor Authentication
+				</FormTitle>
+				<FormStyle onSubmit={onSubmitCode}>
+					<FormGroup>
+						<FormLabel htmlFor="code">Code</FormLabel>
+						<FormInput
+							type="text"
+							name="code"
+							value={code}
+							onChange={(e) => setCode(e.target.value)}
+							autoComplete="one-time-code"
+							required
+						/>
+					</FormGroup>
+					<SubmitButton type="submit" value="Verify" />
+				</FormStyle>
+				<ForgotLink>
+					Lost your device? Enter one of your recovery codes instead.
+				</ForgotLink>
+			</FormContainer>
+		);
+	}
+
 	return (
 		<FormContainer>
 			<FormTitle>
@@ -73,6 +138,12 @@ const Login = (props) => {
 				<SubmitButton type="submit" value="Login" />
 			</FormStyle>
 
+			{providers.map((provider) => (
+				<ProviderLink key={provider} href={`${serverURL}/api/auth/oidc/${provider}/login`}>
+					Sign in with {provider}
+				</ProviderLink>
+			))}
+
 			<ForgotLink>
 				Forgot Password ? <Link to="/forgot">
 					<ForgotClick>
@@ -129,6 +200,17 @@ const SubmitButton = styled.input`
 	cursor: pointer;
 `;
 
+const ProviderLink = styled.a`
+	display: block;
+	width: 80%;
+	margin: 0 auto 2rem;
+	padding: .5rem;
+	font-size: 1.5rem;
+	border: 1px solid #eeba6d;
+	border-radius: .5rem;
+	text-transform: capitalize;
+`;
+
 const ForgotLink = styled.div`
 	font-size: 1.5rem;
 `;
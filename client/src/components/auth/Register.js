@@ -16,7 +16,7 @@ const Register = (props) => {
 				props.history.push('/home');
 			}
 
-			if (error === 'email address is already taken') {
+			if (error && error !== 'Unauthorized. Login to access this page') {
 				setAlert(error, 'danger');
 				clearErrors();
 			}
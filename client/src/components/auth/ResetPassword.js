@@ -7,7 +7,7 @@ const ResetPassword = (props) => {
 	const authContext = useContext(AuthContext);
 	const alertContext = useContext(AlertContext);
 
-	const { error, clearErrors, resetPassword, isAuthenticated } = authContext;
+	const { error, clearErrors, resetPassword, isAuthenticated, challenge } = authContext;
 	const { setAlert } = alertContext;
 
 	const params = new URLSearchParams(window.location.search);
@@ -18,13 +18,17 @@ const ResetPassword = (props) => {
 			if (isAuthenticated) {
 				props.history.push('/home');
 			}
+			//* accounts with two-factor authentication finish signing in on the login page
+			if (challenge) {
+				props.history.push('/login');
+			}
 			if (error && error !== 'Unauthorized. Login to access this page') {
 				setAlert(error, 'danger');
 				clearErrors();
 			}
 		},
 					// eslint-disable-next-line
-		[ error, isAuthenticated, props.history ]
+		[ error, isAuthenticated, challenge, props.history ]
 	);
 
 	const [ user, setUser ] = useState({
@@ -0,0 +1,60 @@
+import React, { useContext, useEffect } from 'react';
+import styled from 'styled-components';
+import AuthContext from '../../context/auth/authContext';
+import AlertContext from '../../context/alert/alertContext';
+
+const UnlockAccount = () => {
+	const authContext = useContext(AuthContext);
+	const alertContext = useContext(AlertContext);
+
+	const { unlockAccount, error, message, clearErrors } = authContext;
+	const { setAlert } = alertContext;
+
+	const params = new URLSearchParams(window.location.search);
+	const token = params.get('token');
+
+	useEffect(
+		() => {
+			unlockAccount(token);
+		},
+					// eslint-disable-next-line
+		[ token ]
+	);
+
+	useEffect(
+		() => {
+			if (error) {
+				setAlert(error, 'danger');
+				clearErrors();
+			}
+
+			if (message) {
+				setAlert(message, 'success');
+				clearErrors();
+			}
+		},
+					// eslint-disable-next-line
+		[ error, message ]
+	);
+
+	return (
+		<Container>
+			<Title>Unlock Account</Title>
+		</Container>
+	);
+};
+
+const Container = styled.div`
+	max-width: 500px;
+  margin: 2rem auto;
+  overflow: hidden;
+	padding: 0 2rem;
+	text-align: center;
+`;
+
+const Title = styled.h1`
+	text-align: center;
+	margin-bottom: 2rem;
+`;
+
+export default UnlockAccount;
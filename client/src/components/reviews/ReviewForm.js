@@ -13,25 +13,27 @@ const ReviewForm = ({ bookID }) => {
 
 
 	const [ review, setReview ] = useState({
-		notes: ''
+		notes: '',
+		rating: ''
 	});
 
-	const { notes } = review;
+	const { notes, rating } = review;
 
 	const onChange = (e) => setReview({ ...review, [e.target.name]: e.target.value });
 
 	const onSubmit = (e) => {
 		e.preventDefault();
-		if (notes === '') {
+		if (notes === '' || rating === '') {
 			setAlert('Please enter all fields');
 		} else {
 			addReview(
 				{
-					notes
+					notes,
+					rating: parseInt(rating, 10)
 				},
 				bookID
 			);
-			setReview({ notes: '' });
+			setReview({ notes: '', rating: '' });
 		}
 	};
 
@@ -42,6 +44,16 @@ const ReviewForm = ({ bookID }) => {
 				<FormGroup>
 					<FormInput type="text" name="notes" value={notes} onChange={onChange} required />
 				</FormGroup>
+				<FormGroup>
+					<select name="rating" value={rating} onChange={onChange} required>
+						<option value="">Rating</option>
+						{[ 5, 4, 3, 2, 1 ].map((star) => (
+							<option key={star} value={star}>
+								{'\u2605'.repeat(star)}
+							</option>
+						))}
+					</select>
+				</FormGroup>
 				<SubmitButton type="submit" value="Submit" />
 			</BookForm>
 		</FormContainer>
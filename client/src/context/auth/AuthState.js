@@ -17,22 +17,26 @@ import {
 	GET_USER_FAIL,
 	TRIGGER_SUCCESS,
 	ALL_ERRORS,
-	RESET_SUCCESS
+	RESET_SUCCESS,
+	TWO_FACTOR_REQUIRED,
+	GET_PROVIDERS
 } from '../types';
 import Cookies from 'universal-cookie';
-import { serverURL, cloudinaryURL as cURL, cloudinaryUploadPreset } from '../../utils/helper';
+import { serverURL, cloudinaryURL as cURL, cloudinaryUploadPreset, errorMessage } from '../../utils/helper';
 
 const cookie = new Cookies();
 
 const AuthState = (props) => {
 	const initialState = {
-		isAuthenticated: cookie.get('remember_token') ? true : false,
+		isAuthenticated: cookie.get('signed_in') ? true : false,
 		loading: false,
 		user: null,
 		error: null,
 		avatar: null,
 		bookUser: null,
-		message: null
+		message: null,
+		challenge: null,
+		providers: []
 	};
 
 	const [ state, dispatch ] = useReducer(authReducer, initialState);
@@ -45,8 +49,7 @@ const AuthState = (props) => {
 			withCredentials: true,
 		};
 		try {
-			const token = cookie.get('remember_token');
-			const res = await axios.get(`${serverURL}/api/users/info?token=${token}`, config);
+			const res = await axios.get(`${serverURL}/api/users/info`, config);
 			dispatch({
 				type: USER_LOADED,
 				payload: res.data.data
@@ -106,7 +109,7 @@ const AuthState = (props) => {
 		} catch (error) {
 			dispatch({
 				type: REGISTER_FAIL,
-				payload: error.response.data.message || 'Internal Server error'
+				payload: errorMessage(error)
 			});
 		}
 	};
@@ -122,8 +125,14 @@ const AuthState = (props) => {
 
 		try {
 			const res = await axios.post(`${serverURL}/api/users/login`, formData, config);
+			if (res.data.data.two_factor_required) {
+				dispatch({
+					type: TWO_FACTOR_REQUIRED,
+					payload: res.data.data.challenge
+				});
+				return;
+			}
 
-			cookie.set('remember_token', res.data.data.remember, { path: '/' });
 			dispatch({
 				type: LOGIN_SUCCESS,
 				payload: res.data
@@ -149,7 +158,6 @@ const AuthState = (props) => {
 		try {
 			const res = await axios.post(`${serverURL}/api/users/update/${id}`, formData, config);
 
-			cookie.set('remember_token', res.data.data.remember, { path: '/' });
 			dispatch({
 				type: USER_LOADED,
 				payload: res.data.data
@@ -158,7 +166,7 @@ const AuthState = (props) => {
 		} catch (error) {
 			dispatch({
 				type: USER_LOAD_FAIL,
-				payload: error.response.data.message || 'Internal Server error'
+				payload: errorMessage(error)
 			});
 		}
 	};
@@ -211,10 +219,109 @@ const AuthState = (props) => {
 		};
 		try {
 			const res = await axios.post(`${serverURL}/api/users/reset?token=${token}`, formData, config);
+			if (res.data.data.two_factor_required) {
+				dispatch({
+					type: TWO_FACTOR_REQUIRED,
+					payload: res.data.data.challenge
+				});
+				return;
+			}
 			dispatch({
 				type: RESET_SUCCESS,
 				payload: res.data
 			});
+		} catch (error) {
+			dispatch({
+				type: ALL_ERRORS,
+				payload: errorMessage(error)
+			});
+		}
+	};
+
+	//* Verify email address
+	const verifyEmail = async (token) => {
+		const config = {
+			headers: {
+				'Content-Type': 'application/json'
+			},
+				withCredentials: true,
+		};
+		try {
+			const res = await axios.post(`${serverURL}/api/users/verify?token=${token}`, {}, config);
+			dispatch({
+				type: TRIGGER_SUCCESS,
+				payload: res.data.data.message
+			});
+		} catch (error) {
+			dispatch({
+				type: ALL_ERRORS,
+				payload: error.response.data.message || 'Internal Server error'
+			});
+		}
+	};
+
+	const unlockAccount = async (token) => {
+		const config = {
+			headers: {
+				'Content-Type': 'application/json'
+			},
+				withCredentials: true,
+		};
+		try {
+			const res = await axios.post(`${serverURL}/api/users/unlock?token=${token}`, {}, config);
+			dispatch({
+				type: TRIGGER_SUCCESS,
+				payload: res.data.data.message
+			});
+		} catch (error) {
+			dispatch({
+				type: ALL_ERRORS,
+				payload: error.response.data.message || 'Internal Server error'
+			});
+		}
+	};
+
+	//* Second login step, code is from the authenticator app or a recovery code
+	const loginTwoFactor = async (code) => {
+		const config = {
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			withCredentials: true,
+		};
+
+		try {
+			const res = await axios.post(`${serverURL}/api/users/login/2fa`, { challenge: state.challenge, code }, config);
+
+			dispatch({
+				type: LOGIN_SUCCESS,
+				payload: res.data
+			});
+			loadUser();
+		} catch (error) {
+			dispatch({
+				type: ALL_ERRORS,
+				payload: error.response.data.message || 'Internal Server error'
+			});
+		}
+	};
+
+	//* a login through an identity provider that still needs a code comes back with a challenge
+	const setChallenge = (challenge) => {
+		dispatch({
+			type: TWO_FACTOR_REQUIRED,
+			payload: challenge
+		});
+	};
+
+	//* identity providers users can sign in with
+	const getProviders = async () => {
+		try {
+			const res = await axios.get(`${serverURL}/api/auth/providers`);
+			dispatch({
+				type: GET_PROVIDERS,
+				payload: res.data.data.providers
+			});
 		} catch (error) {
 			dispatch({
 				type: ALL_ERRORS,
@@ -224,7 +331,14 @@ const AuthState = (props) => {
 	};
 
 	//* Logout
-	const logout = () => dispatch({ type: LOGOUT });
+	const logout = async () => {
+		try {
+			await axios.post(`${serverURL}/api/users/logout`, {}, { withCredentials: true });
+		} catch (error) {
+			console.error('logout error', error);
+		}
+		dispatch({ type: LOGOUT });
+	};
 
 	//* Clear Errors
 	const clearErrors = () => dispatch({ type: CLEAR_ERRORS });
@@ -239,8 +353,13 @@ const AuthState = (props) => {
 				avatar: state.avatar,
 				bookUser: state.bookUser,
 				message: state.message,
+				challenge: state.challenge,
+				providers: state.providers,
 				register,
 				login,
+				loginTwoFactor,
+				setChallenge,
+				getProviders,
 				logout,
 				getUser,
 				updateUser,
@@ -248,6 +367,8 @@ const AuthState = (props) => {
 				loadUser,
 				triggerReset,
 				resetPassword,
+				verifyEmail,
+				unlockAccount,
 				uploadAvatar
 			}}
 		>
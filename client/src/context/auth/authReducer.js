@@ -13,7 +13,9 @@ import {
 	GET_USER_FAIL,
 	TRIGGER_SUCCESS,
 	ALL_ERRORS,
-	RESET_SUCCESS
+	RESET_SUCCESS,
+	TWO_FACTOR_REQUIRED,
+	GET_PROVIDERS
 } from '../types';
 import Cookies from 'universal-cookie';
 
@@ -32,20 +34,28 @@ export default (state, action) => {
 		case REGISTER_SUCCESS:
 		case LOGIN_SUCCESS:
 		case RESET_SUCCESS:
-			//* set cookie
-			cookie.set('remember_token', action.payload.data.remember, { path: '/' });
+			//* the session cookie is HttpOnly, so remember that we signed in
+			cookie.set('signed_in', 'true', { path: '/' });
 			return {
 				...state,
 				...action.payload,
 				isAuthenticated: true,
-				loading: false
+				loading: false,
+				challenge: null
+			};
+		case TWO_FACTOR_REQUIRED:
+			//* the password was right, the login finishes once a code is entered
+			return {
+				...state,
+				loading: false,
+				challenge: action.payload
 			};
 		case REGISTER_FAIL:
 		case LOGIN_FAIL:
 		case LOGOUT:
 		case USER_LOAD_FAIL:
 			//* unset cookie
-			cookie.remove('remember_token');
+			cookie.remove('signed_in');
 			return {
 				...state,
 				isAuthenticated: false,
@@ -78,6 +88,11 @@ export default (state, action) => {
 				...state,
 				error: action.payload
 			};
+		case GET_PROVIDERS:
+			return {
+				...state,
+				providers: action.payload
+			};
 		case TRIGGER_SUCCESS:
 			return {
 				...state,
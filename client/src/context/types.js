@@ -32,3 +32,5 @@ export const REVIEW_ERROR = 'REVIEW_ERROR';
 export const TRIGGER_SUCCESS = 'TRIGGER_SUCCESS';
 export const ALL_ERRORS = 'ALL_ERRORS';
 export const RESET_SUCCESS = 'RESET_SUCCESS';
+export const TWO_FACTOR_REQUIRED = 'TWO_FACTOR_REQUIRED';
+export const GET_PROVIDERS = 'GET_PROVIDERS';
@@ -1,3 +1,25 @@
 export const serverURL = "https://revbook13420.herokuapp.com";
 export const cloudinaryURL = "https://api.cloudinary.com/v1_1/sajicode/image/upload";
-export const cloudinaryUploadPreset = "revbook";
\ No newline at end of file
+export const cloudinaryUploadPreset = "revbook";
+
+//* password policy errors come with a code, so the rule can be explained
+//* in the words of the form rather than the server's
+const passwordHints = {
+	password_too_short: (limit) => `Your password needs at least ${limit} characters.`,
+	password_too_long: (limit) => `Your password is too long, please keep it to ${limit} characters or fewer.`,
+	password_too_simple: (limit) =>
+		`Your password needs ${limit} of: lower case letters, upper case letters, digits and symbols.`,
+	password_personal: () => 'Your password must not contain your name or email address.',
+	password_breached: () =>
+		'This password has appeared in a data breach and could be guessed. Please choose another one.'
+};
+
+//* errorMessage returns what to show for a failed request
+export const errorMessage = (error) => {
+	const data = (error.response && error.response.data) || {};
+	const hint = data.error && passwordHints[data.error.code];
+	if (hint) {
+		return hint(data.error.limit);
+	}
+	return data.message || 'Internal Server error';
+};
@@ -0,0 +1,555 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sajicode/go-book/email"
+	"github.com/sajicode/go-book/logger"
+	"github.com/sajicode/go-book/migrate"
+	"github.com/sajicode/go-book/models"
+	"github.com/sajicode/go-book/oidc"
+	"github.com/sajicode/go-book/ratelimit"
+	"github.com/sirupsen/logrus"
+)
+
+// MinHMACKeyLength is the shortest HMAC_SECRET_KEY accepted, in bytes
+const MinHMACKeyLength = 32
+
+// providerNameRegex limits OIDC provider names, as they appear in URLs
+// and environment variable names
+var providerNameRegex = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Config is everything the app reads from its environment
+type Config struct {
+	// Env is production or anything else for development
+	Env  string
+	Port int
+	// BaseURL is the address of the frontend that emails link to
+	BaseURL string
+	// AllowedOrigin is an extra origin allowed to call the API
+	AllowedOrigin string
+	// TrustedProxies are the networks of the reverse proxies in front
+	// of the app, whose X-Forwarded-For headers are believed
+	TrustedProxies       []*net.IPNet
+	RequireVerifiedEmail bool
+	// Pepper is appended to passwords before they are hashed
+	Pepper string
+	// HMACKey signs the hashes of remember, session, reset and API tokens
+	HMACKey    string
+	DigestHour int
+	// MigrationsDir holds the numbered SQL migration files
+	MigrationsDir string
+
+	Server    ServerConfig
+	DB        DBConfig
+	Email     EmailConfig
+	Log       logger.Config
+	RateLimit RateLimitConfig
+	Password  PasswordConfig
+	// OIDC lists the OpenID Connect providers users may sign in with
+	OIDC []oidc.Config
+
+	// unparsed lists the values Load could not parse
+	unparsed Errors
+}
+
+// ServerConfig bounds how long the HTTP server spends on a request
+type ServerConfig struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// ShutdownTimeout is how long requests in flight get to finish
+	// after SIGINT or SIGTERM
+	ShutdownTimeout time.Duration
+}
+
+// RateLimitConfig holds the rate limit of every limited route. Each is
+// written as <requests>/<period>, e.g. RATE_LIMIT_SIGNUP=5/1h.
+type RateLimitConfig struct {
+	Enabled bool
+	// Store is memory, for a single instance, or postgres
+	Store string
+	// API applies to every API route, per client
+	API    ratelimit.Policy
+	Signup ratelimit.Policy
+	Login  ratelimit.Policy
+	Forgot ratelimit.Policy
+	Review ratelimit.Policy
+	// Restore checks a password, like Login
+	Restore ratelimit.Policy
+	// EmailLink covers the reset, unlock and verify links sent by email
+	EmailLink ratelimit.Policy
+}
+
+// PasswordConfig is the policy for the passwords users choose
+type PasswordConfig struct {
+	MinLength int
+	// MaxLength is in bytes, at most models.MaxPasswordBytes
+	MaxLength int
+	// CharacterClasses is how many of lower case, upper case, digits
+	// and symbols a password must mix
+	CharacterClasses int
+	RejectPersonal   bool
+	// BreachedDir holds the breached password range files, named by
+	// SHA-1 hash prefix. Breached passwords are allowed when it is empty.
+	BreachedDir string
+}
+
+// DBConfig is how to connect to the database
+type DBConfig struct {
+	Driver   string
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+}
+
+// ConnectionInfo is the connection string passed to gorm
+func (c DBConfig) ConnectionInfo() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		c.Host, c.Port, c.User, c.Password, c.Name)
+}
+
+// EmailConfig is how email is rendered and delivered
+type EmailConfig struct {
+	// Transport is mailgun, smtp or outbox
+	Transport        string
+	MailgunDomain    string
+	MailgunAPIKey    string
+	MailgunPublicKey string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	OutboxDir        string
+	// TemplatesDir overrides the built in templates when set
+	TemplatesDir string
+	Workers      int
+}
+
+// IsProduction reports whether the app runs in production
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// Errors lists every problem found in the configuration, so that they
+// can all be fixed at once
+type Errors []string
+
+func (e Errors) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// Load reads the configuration. Values are taken, in order of
+// precedence, from the environment, from envFile and from the file
+// named by CONFIG_FILE, which may be a .env, YAML or TOML file. Keys are
+// matched case insensitively.
+//
+// Values that cannot be parsed are replaced by their defaults and
+// reported by Validate, which must be called before the config is used
+// to serve requests.
+func Load(envFile string) (*Config, error) {
+	src := source{}
+	dotenv, err := readFile(envFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		configFile = dotenv["CONFIG_FILE"]
+	}
+	if configFile != "" {
+		file, err := readFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		src.merge(file)
+	}
+	src.merge(dotenv)
+	src.merge(environ())
+
+	cfg := Config{
+		Env:                  src.str("APP_ENV", "development"),
+		Port:                 src.integer("PORT", 0),
+		BaseURL:              src.str("APP_BASE_URL", email.DefaultBaseURL),
+		AllowedOrigin:        src.str("ORIGIN_ALLOWED", ""),
+		TrustedProxies:       src.networks("TRUSTED_PROXIES"),
+		RequireVerifiedEmail: src.boolean("REQUIRE_VERIFIED_EMAIL", false),
+		Pepper:               src.str("USER_PASSWORD_PEPPER", ""),
+		HMACKey:              src.str("HMAC_SECRET_KEY", ""),
+		DigestHour:           src.integer("DIGEST_HOUR", 8),
+		MigrationsDir:        src.str("MIGRATIONS_DIR", migrate.DefaultDir),
+		Server: ServerConfig{
+			ReadTimeout:       src.duration("SERVER_READ_TIMEOUT", 15*time.Second),
+			ReadHeaderTimeout: src.duration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+			WriteTimeout:      src.duration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:       src.duration("SERVER_IDLE_TIMEOUT", 2*time.Minute),
+			MaxHeaderBytes:    src.integer("SERVER_MAX_HEADER_BYTES", 1<<20),
+			ShutdownTimeout:   src.duration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+		},
+		DB: DBConfig{
+			Driver:   src.str("DB_DRIVER", "postgres"),
+			Host:     src.str("DB_HOST", "localhost"),
+			Port:     src.integer("DB_PORT", 5432),
+			User:     src.str("DB_USER", ""),
+			Password: src.str("DB_PASSWORD", ""),
+			Name:     src.str("DB_NAME", ""),
+		},
+		Email: EmailConfig{
+			Transport:        src.str("EMAIL_TRANSPORT", "mailgun"),
+			MailgunDomain:    src.str("MG_DOMAIN", ""),
+			MailgunAPIKey:    src.str("MG_API_KEY", ""),
+			MailgunPublicKey: src.str("MG_PUBLIC_KEY", ""),
+			SMTPHost:         src.str("SMTP_HOST", ""),
+			SMTPPort:         src.integer("SMTP_PORT", 587),
+			SMTPUsername:     src.str("SMTP_USERNAME", ""),
+			SMTPPassword:     src.str("SMTP_PASSWORD", ""),
+			OutboxDir:        src.str("EMAIL_OUTBOX_DIR", ""),
+			TemplatesDir:     src.str("EMAIL_TEMPLATES_DIR", ""),
+			Workers:          src.integer("EMAIL_WORKERS", 2),
+		},
+		Log: logger.Config{
+			Level:   src.str("LOG_LEVEL", "info"),
+			Format:  src.str("LOG_FORMAT", "json"),
+			Outputs: src.list("LOG_OUTPUTS", "stdout,file"),
+			File:    src.str("LOG_FILE", "logrus.log"),
+			Rotate: logger.RotateConfig{
+				MaxSize:    int64(src.integer("LOG_MAX_SIZE_MB", 100)) << 20,
+				Interval:   src.duration("LOG_ROTATE_INTERVAL", 24*time.Hour),
+				MaxBackups: src.integer("LOG_MAX_BACKUPS", 7),
+				MaxAge:     time.Duration(src.integer("LOG_MAX_AGE_DAYS", 30)) * 24 * time.Hour,
+			},
+			SyslogTag: src.str("LOG_SYSLOG_TAG", "go-book"),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   src.boolean("RATE_LIMIT_ENABLED", true),
+			Store:     src.str("RATE_LIMIT_STORE", "memory"),
+			API:       src.policy("RATE_LIMIT_API", "api", "300/1m"),
+			Signup:    src.policy("RATE_LIMIT_SIGNUP", "signup", "5/1h"),
+			Login:     src.policy("RATE_LIMIT_LOGIN", "login", "20/1m"),
+			Forgot:    src.policy("RATE_LIMIT_FORGOT", "forgot", "5/1h"),
+			Review:    src.policy("RATE_LIMIT_REVIEW", "review", "10/1m"),
+			Restore:   src.policy("RATE_LIMIT_RESTORE", "restore", "10/1h"),
+			EmailLink: src.policy("RATE_LIMIT_EMAIL_LINK", "email-link", "20/1h"),
+		},
+		Password: PasswordConfig{
+			MinLength:        src.integer("PASSWORD_MIN_LENGTH", models.DefaultPasswordPolicy.MinLength),
+			MaxLength:        src.integer("PASSWORD_MAX_LENGTH", models.DefaultPasswordPolicy.MaxLength),
+			CharacterClasses: src.integer("PASSWORD_CHARACTER_CLASSES", models.DefaultPasswordPolicy.CharacterClasses),
+			RejectPersonal:   src.boolean("PASSWORD_REJECT_PERSONAL", models.DefaultPasswordPolicy.RejectPersonal),
+			BreachedDir:      src.str("PASSWORD_BREACHED_DIR", ""),
+		},
+	}
+	cfg.OIDC = src.oidcProviders(cfg.BaseURL)
+	cfg.unparsed = src.problems
+	return &cfg, nil
+}
+
+// Validate checks that everything needed to serve requests is set
+// and sensible, returning every problem found as Errors
+func (c *Config) Validate() error {
+	problems := append(Errors{}, c.unparsed...)
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !validPort(c.Port) {
+		add("PORT must be a port number, got %d", c.Port)
+	}
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		add("APP_BASE_URL must be an absolute URL, got %q", c.BaseURL)
+	}
+	if c.Pepper == "" {
+		add("USER_PASSWORD_PEPPER is required")
+	}
+	if len(c.HMACKey) < MinHMACKeyLength {
+		add("HMAC_SECRET_KEY must be at least %d bytes long, got %d", MinHMACKeyLength, len(c.HMACKey))
+	}
+	if c.DigestHour < 0 || c.DigestHour > 23 {
+		add("DIGEST_HOUR must be between 0 and 23, got %d", c.DigestHour)
+	}
+
+	timeouts := []struct {
+		key string
+		d   time.Duration
+	}{
+		{"SERVER_READ_TIMEOUT", c.Server.ReadTimeout},
+		{"SERVER_READ_HEADER_TIMEOUT", c.Server.ReadHeaderTimeout},
+		{"SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout},
+		{"SERVER_SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d <= 0 {
+			add("%s must be positive, got %s", t.key, t.d)
+		}
+	}
+	if c.Server.MaxHeaderBytes < 4096 {
+		add("SERVER_MAX_HEADER_BYTES must be at least 4096, got %d", c.Server.MaxHeaderBytes)
+	}
+
+	if c.DB.Driver == "" {
+		add("DB_DRIVER is required")
+	}
+	if c.DB.Name == "" {
+		add("DB_NAME is required")
+	}
+	if c.DB.User == "" {
+		add("DB_USER is required")
+	}
+	if !validPort(c.DB.Port) {
+		add("DB_PORT must be a port number, got %d", c.DB.Port)
+	}
+
+	switch c.Email.Transport {
+	case "mailgun":
+		if c.Email.MailgunDomain == "" || c.Email.MailgunAPIKey == "" {
+			add("MG_DOMAIN and MG_API_KEY are required to send email with mailgun")
+		}
+	case "smtp":
+		if c.Email.SMTPHost == "" {
+			add("SMTP_HOST is required to send email with smtp")
+		}
+		if !validPort(c.Email.SMTPPort) {
+			add("SMTP_PORT must be a port number, got %d", c.Email.SMTPPort)
+		}
+	case "outbox":
+	default:
+		add("EMAIL_TRANSPORT must be one of mailgun, smtp or outbox, got %q", c.Email.Transport)
+	}
+	if c.Email.Workers < 1 {
+		add("EMAIL_WORKERS must be at least 1, got %d", c.Email.Workers)
+	}
+
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		add("LOG_LEVEL: %v", err)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("LOG_FORMAT must be json or text, got %q", c.Log.Format)
+	}
+	for _, output := range c.Log.Outputs {
+		switch output {
+		case "stdout", "syslog":
+		case "file":
+			if c.Log.File == "" {
+				add("LOG_FILE is required to log to a file")
+			}
+		default:
+			add("LOG_OUTPUTS must only hold stdout, file or syslog, got %q", output)
+		}
+	}
+
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "postgres" {
+		add("RATE_LIMIT_STORE must be memory or postgres, got %q", c.RateLimit.Store)
+	}
+
+	if c.Password.MinLength < 8 {
+		add("PASSWORD_MIN_LENGTH must be at least 8, got %d", c.Password.MinLength)
+	}
+	if c.Password.MaxLength < c.Password.MinLength || c.Password.MaxLength > models.MaxPasswordBytes {
+		add("PASSWORD_MAX_LENGTH must be between PASSWORD_MIN_LENGTH and %d, got %d", models.MaxPasswordBytes, c.Password.MaxLength)
+	}
+	if c.Password.CharacterClasses < 0 || c.Password.CharacterClasses > 4 {
+		add("PASSWORD_CHARACTER_CLASSES must be between 0 and 4, got %d", c.Password.CharacterClasses)
+	}
+	if c.Password.BreachedDir != "" {
+		if info, err := os.Stat(c.Password.BreachedDir); err != nil || !info.IsDir() {
+			add("PASSWORD_BREACHED_DIR must be a directory, got %q", c.Password.BreachedDir)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, p := range c.OIDC {
+		key := "OIDC_" + strings.ToUpper(p.Name)
+		if !providerNameRegex.MatchString(p.Name) {
+			add("OIDC_PROVIDERS must only hold lower case letters and digits, got %q", p.Name)
+		}
+		if seen[p.Name] {
+			add("OIDC_PROVIDERS lists %q twice", p.Name)
+		}
+		seen[p.Name] = true
+		if !secureURL(p.Issuer) {
+			add("%s_ISSUER must be an https URL, got %q", key, p.Issuer)
+		}
+		if p.ClientID == "" {
+			add("%s_CLIENT_ID is required", key)
+		}
+		if u, err := url.Parse(p.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+			add("%s_REDIRECT_URL must be an absolute URL, got %q", key, p.RedirectURL)
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// secureURL reports whether raw is an https URL. Plain http is only
+// allowed for local addresses, e.g. a provider used in development.
+func secureURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+// source holds raw values by upper case key and collects the ones
+// that cannot be parsed
+type source struct {
+	values   map[string]string
+	problems Errors
+}
+
+func (s *source) merge(values map[string]string) {
+	if s.values == nil {
+		s.values = map[string]string{}
+	}
+	//* an empty value does not hide one set further down
+	for key, value := range values {
+		if value != "" {
+			s.values[strings.ToUpper(key)] = value
+		}
+	}
+}
+
+func (s *source) str(key, fallback string) string {
+	if value := strings.TrimSpace(s.values[key]); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (s *source) integer(key string, fallback int) int {
+	value := s.str(key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be a whole number, got %q", key, value))
+		return fallback
+	}
+	return n
+}
+
+func (s *source) boolean(key string, fallback bool) bool {
+	value := s.str(key, "")
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be true or false, got %q", key, value))
+		return fallback
+	}
+	return b
+}
+
+func (s *source) duration(key string, fallback time.Duration) time.Duration {
+	value := s.str(key, "")
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be a duration such as 24h, got %q", key, value))
+		return fallback
+	}
+	return d
+}
+
+func (s *source) policy(key, name, fallback string) ratelimit.Policy {
+	p, err := ratelimit.ParsePolicy(name, s.str(key, fallback))
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s: %v", key, err))
+		p, _ = ratelimit.ParsePolicy(name, fallback)
+	}
+	return p
+}
+
+// oidcProviders reads the providers named in OIDC_PROVIDERS. Each is
+// set with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _SCOPES and
+// _REDIRECT_URL, which defaults to the callback route under baseURL.
+func (s *source) oidcProviders(baseURL string) []oidc.Config {
+	var providers []oidc.Config
+	for _, name := range s.list("OIDC_PROVIDERS", "") {
+		name = strings.ToLower(name)
+		key := "OIDC_" + strings.ToUpper(name)
+		providers = append(providers, oidc.Config{
+			Name:         name,
+			Issuer:       s.str(key+"_ISSUER", ""),
+			ClientID:     s.str(key+"_CLIENT_ID", ""),
+			ClientSecret: s.str(key+"_CLIENT_SECRET", ""),
+			RedirectURL:  s.str(key+"_REDIRECT_URL", strings.TrimSuffix(baseURL, "/")+"/api/auth/oidc/"+name+"/callback"),
+			Scopes:       s.list(key+"_SCOPES", strings.Join(oidc.DefaultScopes, ",")),
+		})
+	}
+	return providers
+}
+
+// networks reads a list of CIDR ranges, where a single address stands
+// for a network of just that address
+func (s *source) networks(key string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, item := range s.list(key, "") {
+		cidr := item
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("%s must list IP addresses or CIDR ranges, got %q", key, item))
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func (s *source) list(key, fallback string) []string {
+	var items []string
+	for _, item := range strings.Split(s.str(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func environ() map[string]string {
+	values := map[string]string{}
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			values[kv[:i]] = kv[i+1:]
+		}
+	}
+	return values
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sajicode/go-book/logger"
+	"github.com/sajicode/go-book/models"
+)
+
+// validConfig returns a configuration that passes Validate
+func validConfig() *Config {
+	return &Config{
+		Port:       8080,
+		BaseURL:    "https://books.example.com",
+		Pepper:     "pepper",
+		HMACKey:    strings.Repeat("k", MinHMACKeyLength),
+		DigestHour: 8,
+		Server: ServerConfig{
+			ReadTimeout:       time.Second,
+			ReadHeaderTimeout: time.Second,
+			WriteTimeout:      time.Second,
+			IdleTimeout:       time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   time.Second,
+		},
+		DB:        DBConfig{Driver: "postgres", Port: 5432, User: "books", Name: "books"},
+		Email:     EmailConfig{Transport: "outbox", Workers: 1},
+		Log:       logger.Config{Level: "info", Format: "json", Outputs: []string{"stdout"}},
+		RateLimit: RateLimitConfig{Store: "memory"},
+		Password: PasswordConfig{
+			MinLength: models.DefaultPasswordPolicy.MinLength,
+			MaxLength: models.DefaultPasswordPolicy.MaxLength,
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"short HMAC key", func(c *Config) { c.HMACKey = "short" }, []string{
+			"HMAC_SECRET_KEY must be at least 32 bytes long, got 5",
+		}},
+		{"bad ports", func(c *Config) { c.Port = 0; c.DB.Port = 70000 }, []string{
+			"PORT must be a port number, got 0",
+			"DB_PORT must be a port number, got 70000",
+		}},
+		{"missing database", func(c *Config) { c.DB.Name = ""; c.DB.Driver = "" }, []string{
+			"DB_DRIVER is required",
+			"DB_NAME is required",
+		}},
+		{"smtp without a host", func(c *Config) { c.Email.Transport = "smtp"; c.Email.SMTPPort = 587 }, []string{
+			"SMTP_HOST is required to send email with smtp",
+		}},
+		{"unparsed values", func(c *Config) { c.unparsed = Errors{`PORT must be a whole number, got "eighty"`} }, []string{
+			`PORT must be a whole number, got "eighty"`,
+		}},
+	}
+	for _, tt := range tests {
+		c := validConfig()
+		tt.change(c)
+		err := c.Validate()
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		problems, ok := err.(Errors)
+		if !ok {
+			t.Errorf("%s: err = %v, want Errors", tt.name, err)
+			continue
+		}
+		if strings.Join(problems, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: problems = %q, want %q", tt.name, problems, tt.want)
+		}
+	}
+}
+
+func TestValidateReportsUnparsedValues(t *testing.T) {
+	for _, key := range []string{"DIGEST_HOUR", "SERVER_READ_TIMEOUT", "RATE_LIMIT_ENABLED"} {
+		if os.Getenv(key) != "" {
+			t.Skipf("%s is set in the environment", key)
+		}
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	os.Setenv("CONFIG_FILE", writeConfig(t, dir, "settings.toml", `digest_hour = "eight"
+rate_limit_enabled = "sometimes"
+
+[server]
+read_timeout = "soon"
+`))
+	defer os.Unsetenv("CONFIG_FILE")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DigestHour != 8 || cfg.Server.ReadTimeout != 15*time.Second {
+		t.Errorf("digest hour = %d, read timeout = %s, want the defaults", cfg.DigestHour, cfg.Server.ReadTimeout)
+	}
+	err = cfg.Validate()
+	for _, want := range []string{
+		`DIGEST_HOUR must be a whole number, got "eight"`,
+		`RATE_LIMIT_ENABLED must be true or false, got "sometimes"`,
+		`SERVER_READ_TIMEOUT must be a duration such as 24h, got "soon"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, want it to report %s", err, want)
+		}
+	}
+}
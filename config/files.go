@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+// readFile reads the settings in path, whose format is picked by its
+// extension: .yaml or .yml for YAML, .toml for TOML and .env or none for
+// KEY=value lines. Nested keys are joined with underscores, so that
+// db: {host: x} sets DB_HOST, and lists are joined with commas.
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return readYAML(path)
+	case ".toml":
+		return readTOML(path)
+	case "", ".env":
+		return godotenv.Read(path)
+	default:
+		return nil, fmt.Errorf("config: %s: unknown format %s, use .env, .yaml, .yml or .toml", path, ext)
+	}
+}
+
+func readYAML(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	values := map[string]string{}
+	for key, value := range doc {
+		if err := flatten(values, key, value); err != nil {
+			return nil, fmt.Errorf("config: %s: %v", path, err)
+		}
+	}
+	return values, nil
+}
+
+func readTOML(path string) (map[string]string, error) {
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	values := map[string]string{}
+	for key, value := range tree.ToMap() {
+		if err := flatten(values, key, value); err != nil {
+			return nil, fmt.Errorf("config: %s: %v", path, err)
+		}
+	}
+	return values, nil
+}
+
+// flatten adds value to values under key, and the fields of a map under
+// key_field
+func flatten(values map[string]string, key string, value interface{}) error {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		for field, value := range v {
+			if err := flatten(values, key+"_"+fmt.Sprint(field), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for field, value := range v {
+			if err := flatten(values, key+"_"+field, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := scalar(key, item)
+			if err != nil {
+				return err
+			}
+			items[i] = s
+		}
+		return set(values, key, strings.Join(items, ","))
+	default:
+		s, err := scalar(key, v)
+		if err != nil {
+			return err
+		}
+		return set(values, key, s)
+	}
+}
+
+func scalar(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("%s must be a value or a list of values", key)
+	}
+}
+
+// set refuses a key that is already set, also when the two only differ
+// in case or in how they are nested, e.g. db_host and db: {host: x}
+func set(values map[string]string, key, value string) error {
+	key = strings.ToUpper(key)
+	if _, ok := values[key]; ok {
+		return fmt.Errorf("%s is set twice", key)
+	}
+	values[key] = value
+	return nil
+}
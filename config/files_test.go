@@ -0,0 +1,140 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeConfig(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	want := map[string]string{
+		"PORT":                   "8080",
+		"REQUIRE_VERIFIED_EMAIL": "true",
+		"DB_HOST":                "db.internal",
+		"DB_PASSWORD":            "p#ss: \"word\"",
+		"TRUSTED_PROXIES":        "10.0.0.0/8,192.168.1.1",
+		"OIDC_GOOGLE_CLIENT_ID":  "abc",
+		"RATE_LIMIT_LOGIN":       "5/1m",
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"settings.env", `PORT=8080
+REQUIRE_VERIFIED_EMAIL=true
+DB_HOST=db.internal
+DB_PASSWORD='p#ss: "word"'
+TRUSTED_PROXIES=10.0.0.0/8,192.168.1.1
+OIDC_GOOGLE_CLIENT_ID=abc
+RATE_LIMIT_LOGIN=5/1m
+`},
+		{"settings.yaml", `port: 8080
+require_verified_email: true
+db:
+  host: db.internal
+  password: 'p#ss: "word"'
+trusted_proxies:
+  - 10.0.0.0/8
+  - 192.168.1.1
+oidc:
+  google:
+    client_id: abc
+rate_limit_login: 5/1m
+`},
+		{"settings.toml", `# the app
+port = 8_080
+require_verified_email = true
+trusted_proxies = [
+  "10.0.0.0/8", # office
+  "192.168.1.1",
+]
+rate_limit.login = '5/1m'
+
+[db]
+host = "db.internal"
+password = "p#ss: \"word\""
+
+[oidc.google]
+client_id = "abc"
+`},
+	}
+	for _, tt := range tests {
+		got, err := readFile(writeConfig(t, dir, tt.name, tt.contents))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("%s: %s = %q, want %q", tt.name, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"settings.json", `{"port": 8080}`, "unknown format .json"},
+		{"settings.yaml", "db:\n  - host: x\n", "db must be a value or a list of values"},
+		{"settings.yaml", "db_host: x\ndb:\n  host: y\n", "DB_HOST is set twice"},
+		{"settings.yaml", "port: [8080\n", "settings.yaml"},
+		{"settings.toml", "port = 8080\nport = 8081\n", "defined twice: port"},
+		{"settings.toml", "db_host = \"x\"\n[db]\nhost = \"y\"\n", "DB_HOST is set twice"},
+		{"settings.toml", "\n\ntimeout = 15s\n", "settings.toml: (3, 13)"},
+		{"settings.toml", "started = 1979-05-27T07:32:00Z\n", "started must be a value or a list of values"},
+		{"settings.toml", "[[providers]]\nname = \"google\"\n", "providers must be a value or a list of values"},
+		{"settings.toml", "key = \"open\n", "settings.toml: (1, 8)"},
+		{"settings.toml", "key = \"a\" \"b\"\n", "unexpected token"},
+	}
+	for _, tt := range tests {
+		_, err := readFile(writeConfig(t, dir, tt.name, tt.contents))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %q: err = %v, want it to mention %q", tt.name, tt.contents, err, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	if os.Getenv("PORT") != "" || os.Getenv("DB_NAME") != "" {
+		t.Skip("PORT or DB_NAME is set in the environment")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	os.Setenv("CONFIG_FILE", writeConfig(t, dir, "settings.toml", "port = 9000\n[db]\nname = \"books\"\n"))
+	defer os.Unsetenv("CONFIG_FILE")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9000 || cfg.DB.Name != "books" {
+		t.Errorf("port = %d, database = %q, want 9000 and books", cfg.Port, cfg.DB.Name)
+	}
+}
@@ -9,13 +9,20 @@ import (
 // * we do not want another app to overwrite our user key in context
 // * context stores both the key and key type
 const (
-	userKey privateKey = "user"
+	userKey     privateKey = "user"
+	sessionKey  privateKey = "session"
+	apiTokenKey privateKey = "api_token"
+	requestKey  privateKey = "request"
 )
 
 type privateKey string
 
-// WithUser sets a user on context
+// WithUser sets a user on context, and records who made the request
+// so that it can be logged
 func WithUser(ctx context.Context, user *models.User) context.Context {
+	if info := Request(ctx); info != nil && user != nil {
+		info.UserID = user.ID
+	}
 	return context.WithValue(ctx, userKey, user)
 }
 
@@ -28,3 +35,56 @@ func User(ctx context.Context) *models.User {
 	}
 	return nil
 }
+
+// WithSession sets the session the request was authenticated with on context
+func WithSession(ctx context.Context, session *models.Session) context.Context {
+	return context.WithValue(ctx, sessionKey, session)
+}
+
+// Session returns the Session data stored in context
+func Session(ctx context.Context) *models.Session {
+	if temp := ctx.Value(sessionKey); temp != nil {
+		if session, ok := temp.(*models.Session); ok {
+			return session
+		}
+	}
+	return nil
+}
+
+// WithAPIToken sets the personal access token the request was
+// authenticated with on context
+func WithAPIToken(ctx context.Context, token *models.APIToken) context.Context {
+	return context.WithValue(ctx, apiTokenKey, token)
+}
+
+// APIToken returns the APIToken data stored in context
+func APIToken(ctx context.Context) *models.APIToken {
+	if temp := ctx.Value(apiTokenKey); temp != nil {
+		if token, ok := temp.(*models.APIToken); ok {
+			return token
+		}
+	}
+	return nil
+}
+
+// RequestInfo identifies a request in the logs. It is set on context
+// once per request and filled in as the request is handled.
+type RequestInfo struct {
+	ID     string
+	UserID uint
+}
+
+// WithRequest sets the request info on context
+func WithRequest(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestKey, info)
+}
+
+// Request returns the RequestInfo stored in context
+func Request(ctx context.Context) *RequestInfo {
+	if temp := ctx.Value(requestKey); temp != nil {
+		if info, ok := temp.(*RequestInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/logger"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// Admin controller structure
+type Admin struct {
+	us  models.UserService
+	tfs models.TwoFactorService
+	js  models.JobService
+}
+
+// NewAdmin is used to create a new admin controller
+func NewAdmin(us models.UserService, tfs models.TwoFactorService, js models.JobService) *Admin {
+	return &Admin{
+		us:  us,
+		tfs: tfs,
+		js:  js,
+	}
+}
+
+// canModify reports whether user may change content owned by ownerID.
+// Owners can always change their own content and moderators can change
+// anyone's.
+func canModify(user *models.User, ownerID uint) bool {
+	return user.ID == ownerID || user.HasRole(models.RoleModerator)
+}
+
+// ListUsers returns a paginated list of every user
+// GET /admin/users
+func (a *Admin) ListUsers(w http.ResponseWriter, r *http.Request) {
+	pagination, err := parsePagination(r.URL.Query())
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	users, page, err := a.us.AllUsers(pagination)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		if err == models.ErrCursorInvalid {
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching users"))
+		return
+	}
+	util.Respond(w, util.SuccessPage("success", models.SelfUsers(users), page))
+}
+
+// Suspend stops a user from signing in
+// POST /admin/users/:id/suspend
+func (a *Admin) Suspend(w http.ResponseWriter, r *http.Request) {
+	a.changeUser(w, r, func(id uint) (*models.User, error) {
+		return a.us.Suspend(id)
+	})
+}
+
+// Unsuspend lets a suspended user sign in again
+// POST /admin/users/:id/unsuspend
+func (a *Admin) Unsuspend(w http.ResponseWriter, r *http.Request) {
+	a.changeUser(w, r, func(id uint) (*models.User, error) {
+		return a.us.Unsuspend(id)
+	})
+}
+
+// RoleForm is used to process the change role form
+type RoleForm struct {
+	Role models.Role `json:"role"`
+}
+
+// SetRole changes the role of a user
+// PUT /admin/users/:id/role
+func (a *Admin) SetRole(w http.ResponseWriter, r *http.Request) {
+	form := &RoleForm{}
+	err := json.NewDecoder(r.Body).Decode(form)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	a.changeUser(w, r, func(id uint) (*models.User, error) {
+		return a.us.SetRole(id, form.Role)
+	})
+}
+
+// ResetTwoFactor turns two-factor authentication off for a user who
+// lost both their authenticator app and their recovery codes
+// POST /admin/users/{id}/2fa/reset
+func (a *Admin) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	a.changeUser(w, r, a.tfs.Reset)
+}
+
+// changeUser applies an admin action to the user in the URL. Admins
+// cannot act on their own account so they cannot lock themselves out.
+func (a *Admin) changeUser(w http.ResponseWriter, r *http.Request, action func(id uint) (*models.User, error)) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	admin := context.User(r.Context())
+	if admin.ID == uint(id) {
+		slogger.InvalidRequest(r.Context(), "Admin attempted to change their own account")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", "You cannot change your own account"))
+		return
+	}
+
+	user, err := action(uint(id))
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case models.ErrNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			util.Respond(w, util.Fail("fail", "User not found"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", err.Error()))
+		}
+		return
+	}
+	util.Respond(w, util.Success("success", user.Self()))
+}
+
+// JobsStatus is the state of the background job queues
+type JobsStatus struct {
+	Counts []models.JobCount `json:"counts"`
+	Jobs   []models.Job      `json:"jobs"`
+}
+
+// Jobs reports how many jobs each queue holds in every status and
+// lists the jobs, optionally only those with ?status=
+// GET /admin/jobs
+func (a *Admin) Jobs(w http.ResponseWriter, r *http.Request) {
+	pagination, err := parsePagination(r.URL.Query())
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	status := models.JobStatus(r.URL.Query().Get("status"))
+	jobs, page, err := a.js.ByStatus(status, pagination)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		if err == models.ErrJobStatusInvalid || err == models.ErrCursorInvalid {
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching jobs"))
+		return
+	}
+	counts, err := a.js.Counts()
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching jobs"))
+		return
+	}
+	util.Respond(w, util.SuccessPage("success", JobsStatus{Counts: counts, Jobs: jobs}, page))
+}
+
+// LogLevelForm is used to read and change the log level
+type LogLevelForm struct {
+	Level string `json:"level"`
+}
+
+// LogLevel returns the level the app logs at
+// GET /admin/log-level
+func (a *Admin) LogLevel(w http.ResponseWriter, r *http.Request) {
+	util.Respond(w, util.Success("success", LogLevelForm{Level: logger.Level()}))
+}
+
+// SetLogLevel changes the level the app logs at until it restarts,
+// e.g. to turn on debug logging while chasing a problem
+// PUT /admin/log-level
+func (a *Admin) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	form := &LogLevelForm{}
+	err := json.NewDecoder(r.Body).Decode(form)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	if err := logger.SetLevel(form.Level); err != nil {
+		slogger.InvalidArgValue(r.Context(), "level", form.Level)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	user := context.User(r.Context())
+	slogger.WithRequest(r.Context()).Warnf("Log level changed to %s by user %d", logger.Level(), user.ID)
+	util.Respond(w, util.Success("success", LogLevelForm{Level: logger.Level()}))
+}
@@ -2,8 +2,12 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sajicode/go-book/context"
@@ -32,7 +36,7 @@ func (b *Books) Create(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(book)
 	book.UserID = user.ID
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -41,7 +45,7 @@ func (b *Books) Create(w http.ResponseWriter, r *http.Request) {
 
 	newBook, err := b.bs.Create(book)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -56,7 +60,7 @@ func (b *Books) ShowUserBooks(w http.ResponseWriter, r *http.Request) {
 	user := context.User(r.Context())
 	books, err := b.bs.ByUserID(user.ID)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -72,7 +76,7 @@ func (b *Books) GetOneBook(w http.ResponseWriter, r *http.Request) {
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -80,7 +84,7 @@ func (b *Books) GetOneBook(w http.ResponseWriter, r *http.Request) {
 	}
 	book, err := b.bs.ByID(uint(id))
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -94,33 +98,36 @@ func (b *Books) GetOneBook(w http.ResponseWriter, r *http.Request) {
 func (b *Books) Update(w http.ResponseWriter, r *http.Request) {
 	book, err := b.bookByID(w, r)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
 	user := context.User(r.Context())
-	if user.ID != book.UserID {
-		slogger.InvalidRequest("Unauthorized request")
+	if !canModify(user, book.UserID) {
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		util.Respond(w, util.Fail("fail", "Invalid request"))
 		return
 	}
 
+	ownerID := book.UserID
 	err = json.NewDecoder(r.Body).Decode(book)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
+	// a moderator editing the book does not take it over
+	book.UserID = ownerID
 
 	updatedBook, err := b.bs.Update(book)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -131,33 +138,174 @@ func (b *Books) Update(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Delete removes a book along with its reviews
+// DELETE /books/:id
+func (b *Books) Delete(w http.ResponseWriter, r *http.Request) {
+	book, err := b.bookByID(w, r)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		util.Respond(w, util.Fail("fail", "Book not found"))
+		return
+	}
+	user := context.User(r.Context())
+	if !canModify(user, book.UserID) {
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		util.Respond(w, util.Fail("fail", "Invalid request"))
+		return
+	}
+
+	err = b.bs.Delete(book.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error deleting book"))
+		return
+	}
+	util.Respond(w, util.Success("success", deletedMessage("Book")))
+}
+
+// Restore brings back a recently deleted book and its reviews
+// POST /books/:id/restore
+func (b *Books) Restore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	book, err := b.bs.DeletedByID(uint(id))
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		util.Respond(w, util.Fail("fail", "Book not found"))
+		return
+	}
+	user := context.User(r.Context())
+	if !canModify(user, book.UserID) {
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		util.Respond(w, util.Fail("fail", "Invalid request"))
+		return
+	}
+
+	err = b.bs.Restore(book.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	restoredBook, err := b.bs.ByID(book.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", restoredBook))
+}
+
 // GetAllBooks returns a paginated list of books
+// GET /books?category=&author=&user_id=&created_after=&created_before=&sort=
 func (b *Books) GetAllBooks(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
-	pageStr := r.URL.Query().Get("page")
+	query := r.URL.Query()
+	pagination, err := parsePagination(query)
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
 
-	if limitStr == "" {
-		limitStr = "20"
+	bookQuery, err := parseBookQuery(query)
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
 	}
+	bookQuery.Pagination = pagination
+
+	books, page, err := b.bs.Query(bookQuery)
 
-	if pageStr == "" {
-		pageStr = "1"
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case models.ErrSortInvalid, models.ErrDateRangeInvalid, models.ErrCursorInvalid, models.ErrCursorSortInvalid:
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", err.Error()))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			util.Respond(w, util.Fail("fail", "Error fetching books"))
+		}
+		return
 	}
 
-	limit, _ := strconv.Atoi(limitStr)
-	page, _ := strconv.Atoi(pageStr)
+	util.Respond(w, util.SuccessPage("success", books, page))
+}
 
-	books, err := b.bs.AllBooks(limit, page)
+// Search returns books matching a full-text query
+// GET /books/search?q=
+func (b *Books) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pagination, err := parsePagination(query)
+	if err == nil && (pagination.After != "" || pagination.Before != "") {
+		err = errors.New("search results are paged with page, not cursors")
+	}
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	includeReviews := false
+	if v := query.Get("reviews"); v != "" {
+		includeReviews, err = strconv.ParseBool(v)
+		if err != nil {
+			slogger.InvalidArgValue(r.Context(), "reviews", v)
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", "reviews must be true or false"))
+			return
+		}
+	}
 
+	books, page, err := b.bs.Search(models.BookSearch{
+		Query:          query.Get("q"),
+		IncludeReviews: includeReviews,
+		Limit:          pagination.Limit,
+		Page:           pagination.Page,
+	})
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
+		if err == models.ErrSearchQueryRequired {
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", err.Error()))
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
-		util.Respond(w, util.Fail("fail", "Error fetching books"))
+		util.Respond(w, util.Fail("fail", "Error searching books"))
 		return
 	}
 
-	util.Respond(w, util.Success("success", books))
+	util.Respond(w, util.SuccessPage("success", books, page))
 }
 
 // bookByID returns a book by it's ID
@@ -166,13 +314,53 @@ func (b *Books) bookByID(w http.ResponseWriter, r *http.Request) (*models.Book,
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		slogger.InvalidArg(err.Error())
+		slogger.InvalidArg(r.Context(), err.Error())
 		return nil, err
 	}
 	book, err := b.bs.ByID(uint(id))
 	if err != nil {
-		slogger.InvalidArg(err.Error())
+		slogger.InvalidArg(r.Context(), err.Error())
 		return nil, err
 	}
 	return book, nil
 }
+
+// parseBookQuery reads the book listing filters from the query string
+func parseBookQuery(query url.Values) (models.BookQuery, error) {
+	bookQuery := models.BookQuery{
+		Category: query.Get("category"),
+		Author:   query.Get("author"),
+		Sort:     models.BookSort(query.Get("sort")),
+	}
+	if userIDStr := query.Get("user_id"); userIDStr != "" {
+		userID, err := strconv.ParseUint(userIDStr, 10, 64)
+		if err != nil {
+			return bookQuery, errors.New("user_id must be a number")
+		}
+		bookQuery.UserID = uint(userID)
+	}
+	var err error
+	if bookQuery.CreatedAfter, err = parseDate(query.Get("created_after")); err != nil {
+		return bookQuery, fmt.Errorf("created_after %s", err)
+	}
+	if bookQuery.CreatedBefore, err = parseDate(query.Get("created_before")); err != nil {
+		return bookQuery, fmt.Errorf("created_before %s", err)
+	}
+	return bookQuery, nil
+}
+
+// parseDate accepts either a plain date (2006-01-02) or an RFC 3339
+// timestamp. An empty string gives the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	}
+	return t, nil
+}
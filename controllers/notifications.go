@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// Notifications controller structure
+type Notifications struct {
+	ns models.NotificationService
+}
+
+// NewNotifications is used to create a new notifications controller
+func NewNotifications(ns models.NotificationService) *Notifications {
+	return &Notifications{
+		ns: ns,
+	}
+}
+
+// NotificationList is a page of notifications along with how many
+// of the user's notifications are unread
+type NotificationList struct {
+	Unread        int                   `json:"unread"`
+	Notifications []models.Notification `json:"notifications"`
+}
+
+// List returns the user's notifications, newest first. Pass
+// ?unread=true to only get unread ones.
+// GET /notifications
+func (n *Notifications) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pagination, err := parsePagination(query)
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	unreadOnly := false
+	if v := query.Get("unread"); v != "" {
+		unreadOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			slogger.InvalidArgValue(r.Context(), "unread", v)
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", "unread must be true or false"))
+			return
+		}
+	}
+
+	user := context.User(r.Context())
+	notifications, page, err := n.ns.ByUserID(user.ID, unreadOnly, pagination)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		if err == models.ErrCursorInvalid {
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching notifications"))
+		return
+	}
+	unread, err := n.ns.UnreadCount(user.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching notifications"))
+		return
+	}
+	list := NotificationList{
+		Unread:        unread,
+		Notifications: notifications,
+	}
+	util.Respond(w, util.SuccessPage("success", list, page))
+}
+
+// MarkRead marks one of the user's notifications as read
+// POST /notifications/:id/read
+func (n *Notifications) MarkRead(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	user := context.User(r.Context())
+	if err := n.ns.MarkRead(uint(id), user.ID); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		if err == models.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			util.Respond(w, util.Fail("fail", "Notification not found"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error updating notification"))
+		return
+	}
+	message := &ResponseMessage{
+		Message: "The notification has been marked as read.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
+
+// MarkAllRead marks every one of the user's notifications as read
+// POST /notifications/read
+func (n *Notifications) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	if err := n.ns.MarkAllRead(user.ID); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error updating notifications"))
+		return
+	}
+	message := &ResponseMessage{
+		Message: "All notifications have been marked as read.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	"github.com/sajicode/go-book/oidc"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// flowCookie holds the state, nonce and PKCE verifier of a login with
+// an identity provider while the user is away at the provider
+const flowCookie = "oidc_flow"
+
+// flowDuration is how long the user has to sign in at the provider
+const flowDuration = 10 * time.Minute
+
+// errFlowInvalid is returned when the callback does not match the
+// login that was started from this browser
+var errFlowInvalid = errors.New("login with identity provider is not valid")
+
+// OIDC controller signs users in with OpenID Connect providers
+type OIDC struct {
+	users     *Users
+	is        models.IdentityService
+	providers map[string]*oidc.Provider
+	names     []string
+	flowKey   []byte
+	// baseURL is the frontend, where users are sent back to
+	baseURL string
+}
+
+// NewOIDC is used to create a new OIDC controller. Sessions are started
+// through users, and the flow cookie is signed with hmacKey.
+func NewOIDC(users *Users, is models.IdentityService, providers []*oidc.Provider, hmacKey, baseURL string) *OIDC {
+	o := &OIDC{
+		users:     users,
+		is:        is,
+		providers: map[string]*oidc.Provider{},
+		flowKey:   []byte("oidc flow:" + hmacKey),
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+	}
+	for _, p := range providers {
+		o.providers[p.Name] = p
+		o.names = append(o.names, p.Name)
+	}
+	return o
+}
+
+// ProviderList names the identity providers users can sign in with
+type ProviderList struct {
+	Providers []string `json:"providers"`
+}
+
+// Providers lists the identity providers users can sign in with
+// GET /auth/providers
+func (o *OIDC) Providers(w http.ResponseWriter, r *http.Request) {
+	list := &ProviderList{Providers: o.names}
+	if list.Providers == nil {
+		list.Providers = []string{}
+	}
+	util.Respond(w, util.Success("success", list))
+}
+
+// Login sends the user to sign in at the provider
+// GET /auth/oidc/{provider}/login
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["provider"]
+	provider, ok := o.providers[name]
+	if !ok {
+		slogger.InvalidArgValue(r.Context(), "provider", name)
+		o.fail(w, r, "Identity provider not found")
+		return
+	}
+
+	flow, err := oidc.NewFlow()
+	if err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+		o.fail(w, r, "Could not start signing in, please try again")
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), flow)
+	if err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+		o.fail(w, r, "Could not reach "+provider.Name+", please try again later")
+		return
+	}
+	if err := o.setFlow(w, provider.Name, flow); err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+		o.fail(w, r, "Could not start signing in, please try again")
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback is where the provider sends the user back to. It signs them
+// in, linking or creating their account, and sends them on to the
+// frontend.
+// GET /auth/oidc/{provider}/callback
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["provider"]
+	provider, ok := o.providers[name]
+	if !ok {
+		slogger.InvalidArgValue(r.Context(), "provider", name)
+		o.fail(w, r, "Identity provider not found")
+		return
+	}
+	flow, err := o.flow(r, name)
+	o.clearFlow(w)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		o.fail(w, r, "Your sign in has expired, please try again")
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		slogger.InvalidRequest(r.Context(), "Identity provider returned "+e+": "+query.Get("error_description"))
+		o.fail(w, r, "Signing in with "+name+" was cancelled")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		slogger.InvalidRequest(r.Context(), "OIDC state does not match")
+		o.fail(w, r, "Your sign in has expired, please try again")
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), flow)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		o.fail(w, r, "Could not sign you in with "+name+", please try again")
+		return
+	}
+	user, err := o.is.Login(externalUser(name, claims))
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		if public, ok := err.(interface{ Public() string }); ok {
+			o.fail(w, r, public.Public())
+			return
+		}
+		o.fail(w, r, "Could not sign you in with "+name+", please try again")
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		token, err := o.users.tfs.Challenge(user)
+		if err != nil {
+			slogger.ServerError(r.Context(), err.Error())
+			o.fail(w, r, "Could not sign you in, please try again")
+			return
+		}
+		http.Redirect(w, r, o.baseURL+"/login?challenge="+url.QueryEscape(token), http.StatusFound)
+		return
+	}
+	if err := o.users.signIn(w, r, user); err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+		o.fail(w, r, "Could not sign you in, please try again")
+		return
+	}
+	http.Redirect(w, r, o.baseURL+"/home", http.StatusFound)
+}
+
+// Identities lists the providers linked to the signed in user
+// GET /users/identities
+func (o *OIDC) Identities(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	identities, err := o.is.ByUserID(user.ID)
+	if err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching linked identities"))
+		return
+	}
+	util.Respond(w, util.Success("success", identities))
+}
+
+// Unlink removes a provider from the signed in user
+// DELETE /users/identities/{id}
+func (o *OIDC) Unlink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	user := context.User(r.Context())
+	if err := o.is.Unlink(user.ID, uint(id)); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		if err == models.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			util.Respond(w, util.Fail("fail", "Linked identity not found"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error unlinking identity"))
+		return
+	}
+	message := &ResponseMessage{
+		Message: "The identity has been unlinked.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
+
+// fail sends the user back to the login page of the frontend, which
+// shows message
+func (o *OIDC) fail(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, o.baseURL+"/login?error="+url.QueryEscape(message), http.StatusFound)
+}
+
+// flowState is what the flow cookie holds
+type flowState struct {
+	oidc.Flow
+	Provider  string `json:"provider"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// setFlow stores flow in a signed cookie. It must survive the redirect
+// back from the provider, which is a cross-site navigation, so it is
+// SameSite=Lax.
+func (o *OIDC) setFlow(w http.ResponseWriter, provider string, flow *oidc.Flow) error {
+	b, err := json.Marshal(flowState{
+		Flow:      *flow,
+		Provider:  provider,
+		ExpiresAt: time.Now().Add(flowDuration).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookie,
+		Value:    payload + "." + o.sign(payload),
+		Path:     "/api/auth/oidc/",
+		MaxAge:   int(flowDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   o.users.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// flow reads back the flow set by setFlow for provider
+func (o *OIDC) flow(r *http.Request, provider string) (*oidc.Flow, error) {
+	cookie, err := r.Cookie(flowCookie)
+	if err != nil {
+		return nil, errFlowInvalid
+	}
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(o.sign(parts[0]))) {
+		return nil, errFlowInvalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errFlowInvalid
+	}
+	var state flowState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errFlowInvalid
+	}
+	if state.Provider != provider || time.Now().Unix() > state.ExpiresAt {
+		return nil, errFlowInvalid
+	}
+	return &state.Flow, nil
+}
+
+func (o *OIDC) clearFlow(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookie,
+		Value:    "",
+		Path:     "/api/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   o.users.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (o *OIDC) sign(payload string) string {
+	mac := hmac.New(sha256.New, o.flowKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// externalUser is who the ID token says signed in at provider
+func externalUser(provider string, claims *oidc.Claims) *models.ExternalUser {
+	first, last := claims.GivenName, claims.FamilyName
+	if first == "" && last == "" {
+		names := strings.Fields(claims.Name)
+		if len(names) > 0 {
+			first = names[0]
+			last = strings.Join(names[1:], " ")
+		}
+	}
+	return &models.ExternalUser{
+		Provider:      provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		FirstName:     first,
+		LastName:      last,
+		Avatar:        claims.Picture,
+	}
+}
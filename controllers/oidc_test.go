@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sajicode/go-book/email"
+	"github.com/sajicode/go-book/models"
+	"github.com/sajicode/go-book/oidc"
+	"github.com/sajicode/go-book/oidc/oidctest"
+)
+
+const (
+	testBaseURL     = "https://books.example.com"
+	testRedirectURL = testBaseURL + "/api/auth/oidc/test/callback"
+)
+
+// fakeIdentities signs in whoever the provider vouches for as user 1,
+// or fails with err
+type fakeIdentities struct {
+	models.IdentityService
+	err    error
+	logins []*models.ExternalUser
+}
+
+func (f *fakeIdentities) Login(ext *models.ExternalUser) (*models.User, error) {
+	f.logins = append(f.logins, ext)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.User{ID: 1, Email: ext.Email}, nil
+}
+
+type fakeSessions struct {
+	models.SessionService
+	created []*models.Session
+}
+
+func (f *fakeSessions) Create(session *models.Session) error {
+	session.Token = "session-token"
+	session.ExpiresAt = time.Now().Add(time.Hour)
+	f.created = append(f.created, session)
+	return nil
+}
+
+type oidcTest struct {
+	issuer     *oidctest.Issuer
+	identities *fakeIdentities
+	sessions   *fakeSessions
+	router     *mux.Router
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	ot := &oidcTest{
+		issuer:     oidctest.NewIssuer(t, "client-id", "client-secret", testRedirectURL),
+		identities: &fakeIdentities{},
+		sessions:   &fakeSessions{},
+	}
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       ot.issuer.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  testRedirectURL,
+	})
+	users := NewUsers(nil, ot.sessions, nil, email.Client{}, false)
+	o := NewOIDC(users, ot.identities, []*oidc.Provider{provider}, strings.Repeat("k", 32), testBaseURL)
+	ot.router = mux.NewRouter()
+	ot.router.HandleFunc("/api/auth/oidc/{provider}/login", o.Login)
+	ot.router.HandleFunc("/api/auth/oidc/{provider}/callback", o.Callback)
+	return ot
+}
+
+// login starts signing in and returns the flow cookie and the code and
+// state the provider sends the user back with
+func (ot *oidcTest) login(t *testing.T) (*http.Cookie, string, string) {
+	rec := httptest.NewRecorder()
+	ot.router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/auth/oidc/test/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var flow *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == flowCookie {
+			flow = cookie
+		}
+	}
+	if flow == nil {
+		t.Fatal("login: no flow cookie")
+	}
+	code, state := ot.issuer.Authorize(t, rec.Header().Get("Location"))
+	return flow, code, state
+}
+
+// callback returns where the user is sent and the session cookie, if
+// one was set
+func (ot *oidcTest) callback(flow *http.Cookie, code, state string) (*url.URL, *http.Cookie) {
+	query := url.Values{"code": {code}, "state": {state}}
+	r := httptest.NewRequest("GET", "/api/auth/oidc/test/callback?"+query.Encode(), nil)
+	if flow != nil {
+		r.AddCookie(flow)
+	}
+	rec := httptest.NewRecorder()
+	ot.router.ServeHTTP(rec, r)
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookie && cookie.Value != "" {
+			return location, cookie
+		}
+	}
+	return location, nil
+}
+
+func TestOIDCCallback(t *testing.T) {
+	ot := newOIDCTest(t)
+	defer ot.issuer.Close()
+
+	flow, code, state := ot.login(t)
+	location, session := ot.callback(flow, code, state)
+	if location.String() != testBaseURL+"/home" || session == nil {
+		t.Fatalf("sent to %s with session %v, want /home with a session", location, session)
+	}
+	if !session.HttpOnly || session.SameSite != http.SameSiteLaxMode {
+		t.Errorf("session cookie = %+v, want it HttpOnly and SameSite=Lax", session)
+	}
+	if len(ot.identities.logins) != 1 {
+		t.Fatalf("%d identity logins, want 1", len(ot.identities.logins))
+	}
+	ext := ot.identities.logins[0]
+	if ext.Provider != "test" || ext.Subject != "user-1" || !ext.EmailVerified || ext.FirstName != "Ada" {
+		t.Errorf("external user = %+v", ext)
+	}
+}
+
+func TestOIDCCallbackRefuses(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// callback calls the callback the way it should be refused
+		callback     func(ot *oidcTest, flow *http.Cookie, code, state string) (*url.URL, *http.Cookie)
+		tokenRequest bool
+		wantError    string
+	}{
+		{
+			name: "state mismatch",
+			callback: func(ot *oidcTest, flow *http.Cookie, code, state string) (*url.URL, *http.Cookie) {
+				return ot.callback(flow, code, "forged-state")
+			},
+			wantError: "Your sign in has expired, please try again",
+		},
+		{
+			name: "no flow cookie",
+			callback: func(ot *oidcTest, flow *http.Cookie, code, state string) (*url.URL, *http.Cookie) {
+				return ot.callback(nil, code, state)
+			},
+			wantError: "Your sign in has expired, please try again",
+		},
+		{
+			name: "forged flow cookie",
+			callback: func(ot *oidcTest, flow *http.Cookie, code, state string) (*url.URL, *http.Cookie) {
+				forged := *flow
+				forged.Value = strings.Replace(forged.Value, ".", "x.", 1)
+				return ot.callback(&forged, code, state)
+			},
+			wantError: "Your sign in has expired, please try again",
+		},
+		{
+			name: "bad token signature",
+			callback: func(ot *oidcTest, flow *http.Cookie, code, state string) (*url.URL, *http.Cookie) {
+				ot.issuer.Signer = otherKey
+				return ot.callback(flow, code, state)
+			},
+			tokenRequest: true,
+			wantError:    "Could not sign you in with test, please try again",
+		},
+		{
+			name: "unverified local email",
+			callback: func(ot *oidcTest, flow *http.Cookie, code, state string) (*url.URL, *http.Cookie) {
+				ot.identities.err = models.ErrEmailNotVerified
+				return ot.callback(flow, code, state)
+			},
+			tokenRequest: true,
+			wantError:    models.ErrEmailNotVerified.Public(),
+		},
+	}
+	for _, tt := range tests {
+		ot := newOIDCTest(t)
+		flow, code, state := ot.login(t)
+		location, session := tt.callback(ot, flow, code, state)
+		ot.issuer.Close()
+
+		if location.Path != "/login" || location.Query().Get("error") != tt.wantError {
+			t.Errorf("%s: sent to %s, want the login page with %q", tt.name, location, tt.wantError)
+		}
+		if session != nil || len(ot.sessions.created) != 0 {
+			t.Errorf("%s: signed in", tt.name)
+		}
+		if got := ot.issuer.TokenRequests() > 0; got != tt.tokenRequest {
+			t.Errorf("%s: code exchanged = %v, want %v", tt.name, got, tt.tokenRequest)
+		}
+	}
+}
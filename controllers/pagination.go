@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/sajicode/go-book/models"
+)
+
+var (
+	errLimitInvalid  = errors.New("limit must be a positive number")
+	errPageInvalid   = errors.New("page must be a positive number")
+	errCursorsBoth   = errors.New("only one of after and before may be given")
+	errCursorPageMix = errors.New("page cannot be combined with a cursor")
+)
+
+// parsePagination reads limit, page, after and before from the query
+// string. Malformed or non-positive values are rejected and limits
+// above models.MaxPageLimit are clamped.
+func parsePagination(query url.Values) (models.Pagination, error) {
+	p := models.Pagination{
+		Limit:  models.DefaultPageLimit,
+		Page:   1,
+		After:  query.Get("after"),
+		Before: query.Get("before"),
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return p, errLimitInvalid
+		}
+		if limit > models.MaxPageLimit {
+			limit = models.MaxPageLimit
+		}
+		p.Limit = limit
+	}
+	if pageStr := query.Get("page"); pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			return p, errPageInvalid
+		}
+		if p.After != "" || p.Before != "" {
+			return p, errCursorPageMix
+		}
+		p.Page = page
+	}
+	if p.After != "" && p.Before != "" {
+		return p, errCursorsBoth
+	}
+	return p, nil
+}
@@ -11,17 +11,25 @@ import (
 	util "github.com/sajicode/go-book/utils"
 )
 
+// ReviewEvents is told when reviews are posted, e.g. so that the
+// book's owner can be notified
+type ReviewEvents interface {
+	ReviewCreated(review *models.Review, book *models.Book) error
+}
+
 // Reviews controller struct
 type Reviews struct {
-	rs models.ReviewService
-	bs models.BookService
+	rs     models.ReviewService
+	bs     models.BookService
+	events ReviewEvents
 }
 
 // NewReviews is used to create a new review controller
-func NewReviews(rs models.ReviewService, bs models.BookService) *Reviews {
+func NewReviews(rs models.ReviewService, bs models.BookService, events ReviewEvents) *Reviews {
 	return &Reviews{
-		rs: rs,
-		bs: bs,
+		rs:     rs,
+		bs:     bs,
+		events: events,
 	}
 }
 
@@ -31,7 +39,7 @@ func (rev *Reviews) Create(w http.ResponseWriter, r *http.Request) {
 
 	book, err := rev.bookByID(w, r)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		util.Respond(w, util.Fail("fail", "Book not found"))
@@ -40,7 +48,7 @@ func (rev *Reviews) Create(w http.ResponseWriter, r *http.Request) {
 	user := context.User(r.Context())
 
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		util.Respond(w, util.Fail("fail", "Book not found"))
@@ -50,7 +58,7 @@ func (rev *Reviews) Create(w http.ResponseWriter, r *http.Request) {
 	err = json.NewDecoder(r.Body).Decode(review)
 
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -62,12 +70,16 @@ func (rev *Reviews) Create(w http.ResponseWriter, r *http.Request) {
 
 	newReview, err := rev.rs.Create(review)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
+	//* a failed notification should not fail the review
+	if err := rev.events.ReviewCreated(newReview, book); err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+	}
 	util.Respond(w, util.Success("success", newReview))
 }
 
@@ -76,7 +88,7 @@ func (rev *Reviews) Create(w http.ResponseWriter, r *http.Request) {
 func (rev *Reviews) GetBookReviews(w http.ResponseWriter, r *http.Request) {
 	book, err := rev.bookByID(w, r)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		util.Respond(w, util.Fail("fail", "Book not found"))
@@ -85,7 +97,7 @@ func (rev *Reviews) GetBookReviews(w http.ResponseWriter, r *http.Request) {
 	reviews, err := rev.rs.ByBookID(book.ID)
 
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -94,18 +106,209 @@ func (rev *Reviews) GetBookReviews(w http.ResponseWriter, r *http.Request) {
 	util.Respond(w, util.Success("success", reviews))
 }
 
+// GetReview returns a single review along with its edit history
+// GET /reviews/:id
+func (rev *Reviews) GetReview(w http.ResponseWriter, r *http.Request) {
+	review, err := rev.reviewByID(w, r)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		util.Respond(w, util.Fail("fail", "Review not found"))
+		return
+	}
+	history, err := rev.rs.History(review.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	review.History = history
+	util.Respond(w, util.Success("success", review))
+}
+
+// ReviewForm holds the fields of a review its author may change
+type ReviewForm struct {
+	Notes  string `json:"notes"`
+	Rating int    `json:"rating"`
+}
+
+// Update a review's notes and rating
+// PUT /reviews/:id
+func (rev *Reviews) Update(w http.ResponseWriter, r *http.Request) {
+	review, err := rev.reviewByID(w, r)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		util.Respond(w, util.Fail("fail", "Review not found"))
+		return
+	}
+	user := context.User(r.Context())
+	if !canModify(user, review.UserID) {
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		util.Respond(w, util.Fail("fail", "Invalid request"))
+		return
+	}
+
+	form := &ReviewForm{}
+	err = json.NewDecoder(r.Body).Decode(form)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	review.Notes = form.Notes
+	review.Rating = form.Rating
+
+	updatedReview, err := rev.rs.Update(review)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", updatedReview))
+}
+
+// GetUserReviews returns all reviews written by a user
+// GET /users/:id/reviews
+func (rev *Reviews) GetUserReviews(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	reviews, err := rev.rs.ByUserID(uint(id))
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", reviews))
+}
+
+// Delete removes a review
+// DELETE /reviews/:id
+func (rev *Reviews) Delete(w http.ResponseWriter, r *http.Request) {
+	review, err := rev.reviewByID(w, r)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		util.Respond(w, util.Fail("fail", "Review not found"))
+		return
+	}
+	user := context.User(r.Context())
+	if !canModify(user, review.UserID) {
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		util.Respond(w, util.Fail("fail", "Invalid request"))
+		return
+	}
+
+	err = rev.rs.Delete(review.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error deleting review"))
+		return
+	}
+	util.Respond(w, util.Success("success", deletedMessage("Review")))
+}
+
+// Restore brings back a recently deleted review
+// POST /reviews/:id/restore
+func (rev *Reviews) Restore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	review, err := rev.rs.DeletedByID(uint(id))
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		util.Respond(w, util.Fail("fail", "Review not found"))
+		return
+	}
+	user := context.User(r.Context())
+	if !canModify(user, review.UserID) {
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		util.Respond(w, util.Fail("fail", "Invalid request"))
+		return
+	}
+
+	err = rev.rs.Restore(review.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	restoredReview, err := rev.rs.ByID(review.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", restoredReview))
+}
+
+// reviewByID returns a review by it's ID
+func (rev *Reviews) reviewByID(w http.ResponseWriter, r *http.Request) (*models.Review, error) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		return nil, err
+	}
+	review, err := rev.rs.ByID(uint(id))
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		return nil, err
+	}
+	return review, nil
+}
+
 // bookByID returns a book by it's ID
 func (rev *Reviews) bookByID(w http.ResponseWriter, r *http.Request) (*models.Book, error) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		slogger.InvalidArg(err.Error())
+		slogger.InvalidArg(r.Context(), err.Error())
 		return nil, err
 	}
 	book, err := rev.bs.ByID(uint(id))
 	if err != nil {
-		slogger.InvalidArg(err.Error())
+		slogger.InvalidArg(r.Context(), err.Error())
 		return nil, err
 	}
 	return book, nil
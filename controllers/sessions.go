@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// sessionCookie is the name of the cookie holding the session token
+const sessionCookie = "remember_token"
+
+// signIn starts a new session on the requesting device and hands
+// its token to the client in an HttpOnly cookie
+func (u *Users) signIn(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	session := &models.Session{
+		UserID:    user.ID,
+		UserAgent: r.UserAgent(),
+		IP:        util.ClientIP(r),
+	}
+	if err := u.ss.Create(session); err != nil {
+		return err
+	}
+	cookie := http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		MaxAge:   int(time.Until(session.ExpiresAt).Seconds()),
+		HttpOnly: true,
+		Secure:   u.secureCookies,
+		//* Lax keeps the browser from sending the cookie with requests
+		//* other sites make on a user's behalf, so a cookie session
+		//* cannot be used for cross-site request forgery
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &cookie)
+	return nil
+}
+
+// clearSessionCookie removes the session cookie from the client
+func (u *Users) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   u.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Logout ends the session of the requesting device
+// POST /users/logout
+func (u *Users) Logout(w http.ResponseWriter, r *http.Request) {
+	session := context.Session(r.Context())
+	if err := u.ss.Delete(session.ID); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error logging out"))
+		return
+	}
+	u.clearSessionCookie(w)
+	message := &ResponseMessage{
+		Message: "You have been logged out.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
+
+// LogoutAll ends every session of the user, on every device
+// POST /users/logout/all
+func (u *Users) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	if err := u.ss.DeleteByUserID(user.ID); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error logging out"))
+		return
+	}
+	u.clearSessionCookie(w)
+	message := &ResponseMessage{
+		Message: "You have been logged out on every device.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
+
+// Sessions lists the devices the user is signed in on
+// GET /users/sessions
+func (u *Users) Sessions(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	current := context.Session(r.Context())
+	sessions, err := u.ss.ByUserID(user.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching sessions"))
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
+	}
+	util.Respond(w, util.Success("success", sessions))
+}
+
+// RevokeSession signs the user out of one of their other devices
+// DELETE /users/sessions/:id
+func (u *Users) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	user := context.User(r.Context())
+	sessions, err := u.ss.ByUserID(user.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching sessions"))
+		return
+	}
+	for _, session := range sessions {
+		if session.ID != uint(id) {
+			continue
+		}
+		if err := u.ss.Delete(session.ID); err != nil {
+			slogger.InvalidRequest(r.Context(), err.Error())
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			util.Respond(w, util.Fail("fail", "Error revoking session"))
+			return
+		}
+		message := &ResponseMessage{
+			Message: "The device has been logged out.",
+		}
+		util.Respond(w, util.Success("success", message))
+		return
+	}
+	slogger.InvalidRequest(r.Context(), models.ErrNotFound.Error())
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	util.Respond(w, util.Fail("fail", "Session not found"))
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// Tokens controller structure
+type Tokens struct {
+	ts models.APITokenService
+}
+
+// NewTokens is used to create a new personal access tokens controller
+func NewTokens(ts models.APITokenService) *Tokens {
+	return &Tokens{
+		ts: ts,
+	}
+}
+
+// TokenForm holds the fields a user may set on a new token
+type TokenForm struct {
+	Name          string         `json:"name"`
+	Scopes        []models.Scope `json:"scopes"`
+	ExpiresInDays int            `json:"expires_in_days"`
+}
+
+// Create issues a new personal access token. The raw token is only
+// ever included in this response.
+// POST /users/tokens
+func (t *Tokens) Create(w http.ResponseWriter, r *http.Request) {
+	var form TokenForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", "Invalid request"))
+		return
+	}
+	if form.ExpiresInDays < 0 {
+		slogger.InvalidArgValue(r.Context(), "expires_in_days", strconv.Itoa(form.ExpiresInDays))
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", "expires_in_days must not be negative"))
+		return
+	}
+
+	user := context.User(r.Context())
+	token := models.APIToken{
+		UserID: user.ID,
+		Name:   form.Name,
+		Scopes: form.Scopes,
+	}
+	if form.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, form.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := t.ts.Create(&token); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", token))
+}
+
+// List returns the user's active personal access tokens
+// GET /users/tokens
+func (t *Tokens) List(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	tokens, err := t.ts.ByUserID(user.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching tokens"))
+		return
+	}
+	util.Respond(w, util.Success("success", tokens))
+}
+
+// Revoke disables one of the user's personal access tokens
+// DELETE /users/tokens/:id
+func (t *Tokens) Revoke(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		slogger.InvalidArg(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	user := context.User(r.Context())
+	if err := t.ts.Revoke(uint(id), user.ID); err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		if err == models.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			util.Respond(w, util.Fail("fail", "Token not found"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error revoking token"))
+		return
+	}
+	message := &ResponseMessage{
+		Message: "The token has been revoked.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// TwoFactorForm is used to enroll in, confirm and turn off two-factor
+// authentication. Code is either a code from the authenticator app or
+// a recovery code.
+type TwoFactorForm struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// TwoFactorLoginForm completes a login with the challenge returned by
+// Login and a code
+type TwoFactorLoginForm struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// TwoFactorChallenge is returned instead of the user when their
+// password was accepted but they still have to enter a code
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	Challenge         string    `json:"challenge"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// RecoveryCodes are shown once, when they are created
+type RecoveryCodes struct {
+	Message string   `json:"message"`
+	Codes   []string `json:"recovery_codes"`
+}
+
+// completeLogin signs user in, or when they have two-factor
+// authentication on, asks for their code first
+func (u *Users) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if user.TwoFactorEnabled {
+		token, err := u.tfs.Challenge(user)
+		if err != nil {
+			slogger.ServerError(r.Context(), err.Error())
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			util.Respond(w, util.Fail("fail", "Error logging in"))
+			return
+		}
+		challenge := &TwoFactorChallenge{
+			TwoFactorRequired: true,
+			Challenge:         token,
+			ExpiresAt:         time.Now().Add(models.ChallengeDuration),
+		}
+		util.Respond(w, util.Success("success", challenge))
+		return
+	}
+
+	err := u.signIn(w, r, user)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", user.Self()))
+}
+
+// LoginTwoFactor is the second step of logging in for users with
+// two-factor authentication on
+// POST /users/login/2fa
+func (u *Users) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	form := &TwoFactorLoginForm{}
+	err := json.NewDecoder(r.Body).Decode(form)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+
+	user, err := u.tfs.CompleteChallenge(form.Challenge, form.Code)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	err = u.signIn(w, r, user)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", user.Self()))
+}
+
+// TwoFactorStatus tells the signed in user whether two-factor
+// authentication is on
+// GET /users/2fa
+func (u *Users) TwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	status, err := u.tfs.Status(user)
+	if err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error fetching two-factor authentication status"))
+		return
+	}
+	util.Respond(w, util.Success("success", status))
+}
+
+// EnrollTwoFactor creates a secret for the signed in user to add to
+// their authenticator app. Their password is asked for again.
+// POST /users/2fa/enroll
+func (u *Users) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := u.twoFactorForm(w, r, true)
+	if !ok {
+		return
+	}
+
+	enrollment, err := u.tfs.Enroll(user)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	util.Respond(w, util.Success("success", enrollment))
+}
+
+// ConfirmTwoFactor turns two-factor authentication on once the user
+// enters a code from their app, and returns their recovery codes
+// POST /users/2fa/confirm
+func (u *Users) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, form, ok := u.twoFactorForm(w, r, false)
+	if !ok {
+		return
+	}
+
+	codes, err := u.tfs.Confirm(user, form.Code)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	recovery := &RecoveryCodes{
+		Message: "Two-factor authentication is now on. Keep these recovery codes somewhere safe, they will not be shown again.",
+		Codes:   codes,
+	}
+	util.Respond(w, util.Success("success", recovery))
+}
+
+// DisableTwoFactor turns two-factor authentication off. Both the
+// password and a code are asked for.
+// POST /users/2fa/disable
+func (u *Users) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, form, ok := u.twoFactorForm(w, r, true)
+	if !ok {
+		return
+	}
+
+	_, err := u.tfs.Disable(user, form.Code)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	message := &ResponseMessage{
+		Message: "Two-factor authentication has been turned off.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the signed in
+// user
+// POST /users/2fa/recovery-codes
+func (u *Users) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, form, ok := u.twoFactorForm(w, r, false)
+	if !ok {
+		return
+	}
+
+	codes, err := u.tfs.RegenerateRecoveryCodes(user, form.Code)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	recovery := &RecoveryCodes{
+		Message: "Your old recovery codes no longer work. Keep these somewhere safe, they will not be shown again.",
+		Codes:   codes,
+	}
+	util.Respond(w, util.Success("success", recovery))
+}
+
+// twoFactorForm reads a TwoFactorForm for the signed in user and,
+// when checkPassword is set, makes sure they typed their password. It
+// responds and returns false when the request cannot go on.
+func (u *Users) twoFactorForm(w http.ResponseWriter, r *http.Request, checkPassword bool) (*models.User, *TwoFactorForm, bool) {
+	user := context.User(r.Context())
+	form := &TwoFactorForm{}
+	err := json.NewDecoder(r.Body).Decode(form)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return nil, nil, false
+	}
+	if checkPassword {
+		if _, err := u.us.Authenticate(user.Email, form.Password); err != nil {
+			slogger.InvalidRequest(r.Context(), err.Error())
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			util.Respond(w, util.Fail("fail", models.ErrPasswordIncorrect.Error()))
+			return nil, nil, false
+		}
+	}
+	return user, form, true
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// sendUnlock emails the owner of an account that failed logins just
+// locked a link to unlock it. Failures are only logged, as the
+// lockout expires on its own.
+func (u *Users) sendUnlock(r *http.Request, user *models.User) {
+	token, err := u.us.InitiateUnlock(user)
+	if err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+		return
+	}
+	if err := u.emailer.Unlock(recipient(user), token); err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+	}
+}
+
+// Unlock lifts a login lockout with the token the owner was mailed
+// POST /users/unlock?token=
+func (u *Users) Unlock(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	_, err := u.us.CompleteUnlock(token)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	message := &ResponseMessage{
+		Message: "Your account has been unlocked. You can log in again.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
@@ -2,15 +2,17 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/sajicode/go-book/context"
 	"github.com/sajicode/go-book/email"
 	"github.com/sajicode/go-book/logger"
 	"github.com/sajicode/go-book/models"
-	"github.com/sajicode/go-book/rand"
 	util "github.com/sajicode/go-book/utils"
 )
 
@@ -20,104 +22,128 @@ var slogger = logger.NewLogger()
 // Users controller structure
 type Users struct {
 	us      models.UserService
+	ss      models.SessionService
+	tfs     models.TwoFactorService
 	emailer email.Client
 	bs      models.BookService
 	rs      models.ReviewService
+	// secureCookies marks session cookies Secure and lets the
+	// frontend on another site send them along
+	secureCookies bool
 }
 
 // NewUsers is used to create a new user controller
-func NewUsers(us models.UserService, emailer email.Client) *Users {
+func NewUsers(us models.UserService, ss models.SessionService, tfs models.TwoFactorService, emailer email.Client, secureCookies bool) *Users {
 	return &Users{
-		us:      us,
-		emailer: emailer,
+		us:            us,
+		ss:            ss,
+		tfs:           tfs,
+		emailer:       emailer,
+		secureCookies: secureCookies,
 	}
 }
 
+// UserForm is used to process the signup and update user forms.
+// Only the fields a user may set on their own account are read.
+type UserForm struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Avatar    string `json:"avatar"`
+	Bio       string `json:"bio"`
+	Locale    string `json:"locale"`
+
+	NotifyPreference models.NotifyPreference `json:"notify_preference"`
+}
+
+// LoginForm is used to process the login and restore account forms
+type LoginForm struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 // Create a new user
 // POST /users/signup
 func (u *Users) Create(w http.ResponseWriter, r *http.Request) {
-	user := &models.User{}
-	err := json.NewDecoder(r.Body).Decode(user)
+	form := &UserForm{}
+	err := json.NewDecoder(r.Body).Decode(form)
 	if err != nil {
 		util.Respond(w, util.Fail("fail", err.Error()))
-		slogger.InvalidRequest(string(models.ErrInvalidRequest))
+		slogger.InvalidRequest(r.Context(), string(models.ErrInvalidRequest))
 		return
 	}
+	user := &models.User{
+		FirstName: form.FirstName,
+		LastName:  form.LastName,
+		Email:     form.Email,
+		Password:  form.Password,
+		Avatar:    form.Avatar,
+		Bio:       form.Bio,
+		Locale:    form.Locale,
+
+		NotifyPreference: form.NotifyPreference,
+	}
+	if user.Locale == "" {
+		user.Locale = acceptedLocale(r)
+	}
 
 	newUser, err := u.us.Create(user)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		util.Respond(w, util.Fail("fail", err.Error()))
+		failUserForm(w, r, err)
 		return
 	}
-	err = u.emailer.Welcome(newUser.FirstName, newUser.Email)
+	//* the welcome email is sent once the address is verified
+	err = u.sendVerification(newUser)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 	}
 
-	err = u.signIn(w, newUser)
+	err = u.signIn(w, r, newUser)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
-	util.Respond(w, util.Success("success", newUser))
+	util.Respond(w, util.Success("success", newUser.Self()))
 }
 
 // Login is used to authenticate a user w/ their email & password
 // POST /users/login
 func (u *Users) Login(w http.ResponseWriter, r *http.Request) {
-	user := &models.User{}
-	err := json.NewDecoder(r.Body).Decode(user)
+	form := &LoginForm{}
+	err := json.NewDecoder(r.Body).Decode(form)
 	if err != nil {
 		util.Respond(w, util.Fail("fail", err.Error()))
-		slogger.InvalidRequest(string(models.ErrInvalidRequest))
+		slogger.InvalidRequest(r.Context(), string(models.ErrInvalidRequest))
 		return
 	}
 
-	foundUser, err := u.us.Authenticate(user.Email, user.Password)
+	foundUser, err := u.us.Login(form.Email, form.Password, util.ClientIP(r))
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		util.Respond(w, util.Fail("fail", err.Error()))
+		u.failLogin(w, r, err)
 		return
 	}
-	err = u.signIn(w, foundUser)
-	if err != nil {
-		slogger.InvalidRequest(err.Error())
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		util.Respond(w, util.Fail("fail", err.Error()))
-		return
-	}
-	util.Respond(w, util.Success("success", foundUser))
+	u.completeLogin(w, r, foundUser)
 }
 
-// signIn creates and returns a cookie for an authenticated user
-func (u *Users) signIn(w http.ResponseWriter, user *models.User) error {
-	if user.Remember == "" {
-		token, err := rand.RememberToken()
-		if err != nil {
-			return err
-		}
-		user.Remember = token
-		_, err = u.us.Update(user)
-		if err != nil {
-			return err
+// failLogin responds to a login, or account restore, that was refused
+func (u *Users) failLogin(w http.ResponseWriter, r *http.Request, err error) {
+	slogger.InvalidRequest(r.Context(), err.Error())
+	w.Header().Add("Content-Type", "application/json")
+	if throttled, ok := err.(*models.LoginThrottledError); ok {
+		if throttled.Account != nil {
+			u.sendUnlock(r, throttled.Account)
 		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		util.Respond(w, util.Fail("fail", throttled.Public()))
+		return
 	}
-	cookie := http.Cookie{
-		Name:  "remember_token",
-		Value: user.Remember,
-		Path:  "/",
-	}
-	http.SetCookie(w, &cookie)
-	return nil
+	w.WriteHeader(http.StatusUnauthorized)
+	util.Respond(w, util.Fail("fail", err.Error()))
 }
 
 // ResetPwForm is used to process the forgot password form
@@ -133,41 +159,47 @@ type ResponseMessage struct {
 	Message string `json:"message"`
 }
 
+// deletedMessage tells the client how long a deleted resource can be restored for
+func deletedMessage(resource string) *ResponseMessage {
+	days := int(models.RestoreWindow.Hours() / 24)
+	return &ResponseMessage{
+		Message: fmt.Sprintf("%s deleted. It can be restored within the next %d days.", resource, days),
+	}
+}
+
 // InitiateReset starts the process of resetting a user's password
 // POST /users/forgot
 func (u *Users) InitiateReset(w http.ResponseWriter, r *http.Request) {
 	form := &ResetPwForm{}
 	err := json.NewDecoder(r.Body).Decode(form)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
-		slogger.InvalidRequest(string(models.ErrInvalidRequest))
+		slogger.InvalidRequest(r.Context(), string(models.ErrInvalidRequest))
 		return
 	}
-	token, err := u.us.InitiateReset(form.Email)
-
+	//* the response is the same whether or not the email belongs to an
+	//* account, so that this cannot be used to find out who has one
+	message := &ResponseMessage{
+		Message: "If an account exists for that email address, instructions for resetting your password have been emailed to it.",
+	}
+	user, err := u.us.ByEmail(form.Email)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		util.Respond(w, util.Fail("fail", err.Error()))
-		slogger.InvalidRequest(string(models.ErrInvalidRequest))
+		slogger.InvalidRequest(r.Context(), err.Error())
+		util.Respond(w, util.Success("success", message))
 		return
 	}
-
-	err = u.emailer.ResetPw(form.Email, token)
+	token, err := u.us.InitiateReset(user.Email)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		util.Respond(w, util.Fail("fail", err.Error()))
-		slogger.InvalidRequest(string(models.ErrInvalidRequest))
+		slogger.ServerError(r.Context(), err.Error())
+		util.Respond(w, util.Success("success", message))
 		return
 	}
-	message := &ResponseMessage{
-		Message: "Instructions for resetting your password have been emailed to you.",
+	err = u.emailer.ResetPw(recipient(user), token)
+	if err != nil {
+		slogger.ServerError(r.Context(), err.Error())
 	}
 	util.Respond(w, util.Success("success", message))
 }
@@ -179,7 +211,7 @@ func (u *Users) CompleteReset(w http.ResponseWriter, r *http.Request) {
 	form := &ResetPwForm{}
 	err := json.NewDecoder(r.Body).Decode(form)
 	if err != nil {
-		slogger.InvalidRequest(string(models.ErrInvalidRequest))
+		slogger.InvalidRequest(r.Context(), string(models.ErrInvalidRequest))
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -187,21 +219,15 @@ func (u *Users) CompleteReset(w http.ResponseWriter, r *http.Request) {
 	}
 	user, err := u.us.CompleteReset(token, form.Password)
 	if err != nil {
-		slogger.InvalidRequest(string(models.ErrInvalidRequest))
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		util.Respond(w, util.Fail("fail", err.Error()))
+		failUserForm(w, r, err)
 		return
 	}
-	err = u.signIn(w, user)
+	// whoever knew the old password should not stay signed in
+	err = u.ss.DeleteByUserID(user.ID)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		util.Respond(w, util.Fail("fail", err.Error()))
-		return
+		slogger.ServerError(r.Context(), err.Error())
 	}
-	util.Respond(w, util.Success("success", user))
+	u.completeLogin(w, r, user)
 }
 
 // Update a user's details
@@ -209,7 +235,7 @@ func (u *Users) CompleteReset(w http.ResponseWriter, r *http.Request) {
 func (u *Users) Update(w http.ResponseWriter, r *http.Request) {
 	user, err := u.userByID(w, r)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
@@ -217,67 +243,183 @@ func (u *Users) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	authUser := context.User(r.Context())
 	if authUser.ID != user.ID {
-		slogger.InvalidRequest("Unauthorized request")
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		util.Respond(w, util.Fail("fail", "Invalid request"))
 		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(user)
+	// fields left out of the request keep their current values
+	form := &UserForm{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Avatar:    user.Avatar,
+		Bio:       user.Bio,
+		Locale:    user.Locale,
+
+		NotifyPreference: user.NotifyPreference,
+	}
+	err = json.NewDecoder(r.Body).Decode(form)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
+	previousEmail := user.Email
+	user.FirstName = form.FirstName
+	user.LastName = form.LastName
+	user.Email = form.Email
+	user.Password = form.Password
+	user.Avatar = form.Avatar
+	user.Bio = form.Bio
+	user.Locale = form.Locale
+	user.NotifyPreference = form.NotifyPreference
 
 	updatedUser, err := u.us.Update(user)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		failUserForm(w, r, err)
+		return
+	}
+	if updatedUser.Email != previousEmail {
+		if err := u.sendVerification(updatedUser); err != nil {
+			slogger.InvalidRequest(r.Context(), err.Error())
+		}
+	}
+	util.Respond(w, util.Success("success", updatedUser.Self()))
+}
+
+// Delete removes a user's account along with their books and reviews
+// DELETE /users/:id
+func (u *Users) Delete(w http.ResponseWriter, r *http.Request) {
+	user, err := u.userByID(w, r)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		util.Respond(w, util.Fail("fail", "User not found"))
+		return
+	}
+	authUser := context.User(r.Context())
+	if authUser.ID != user.ID {
+		slogger.InvalidRequest(r.Context(), "Unauthorized request")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		util.Respond(w, util.Fail("fail", "Invalid request"))
+		return
+	}
+
+	err = u.us.Delete(user.ID)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		util.Respond(w, util.Fail("fail", "Error deleting account"))
+		return
+	}
+	err = u.ss.DeleteByUserID(user.ID)
+	if err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+	}
+	u.clearSessionCookie(w)
+	util.Respond(w, util.Success("success", deletedMessage("Account")))
+}
+
+// Restore brings back a recently deleted account
+// POST /users/restore
+func (u *Users) Restore(w http.ResponseWriter, r *http.Request) {
+	form := &LoginForm{}
+	err := json.NewDecoder(r.Body).Decode(form)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
 
-	err = u.signIn(w, updatedUser)
-	if err != nil {
-		slogger.InvalidRequest(err.Error())
+	user, err := u.us.RestoreAccount(form.Email, form.Password, util.ClientIP(r))
+	if err == models.ErrRestoreExpired {
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
-	util.Respond(w, util.Success("success", updatedUser))
+	if err != nil {
+		u.failLogin(w, r, err)
+		return
+	}
+	u.completeLogin(w, r, user)
 }
 
 // GetUser returns a single user by id
 func (u *Users) GetUser(w http.ResponseWriter, r *http.Request) {
 	user, err := u.userByID(w, r)
 	if err != nil {
-		slogger.InvalidRequest(err.Error())
+		slogger.InvalidRequest(r.Context(), err.Error())
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		util.Respond(w, util.Fail("fail", err.Error()))
 		return
 	}
-	util.Respond(w, util.Success("success", user))
+	viewer := context.User(r.Context())
+	if viewer.ID == user.ID || viewer.HasRole(models.RoleAdmin) {
+		util.Respond(w, util.Success("success", user.Self()))
+		return
+	}
+	util.Respond(w, util.Success("success", user.Public()))
 }
 
-// UserByHash gets a user by the cookie hash
+// UserByHash returns the user signed in with the session cookie
+// GET /users/info
 func (u *Users) UserByHash(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	user, err := u.us.ByRemember(token)
-	if err != nil {
-		slogger.InvalidRequest(err.Error())
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		util.Respond(w, util.Fail("fail", err.Error()))
+	user := context.User(r.Context())
+	util.Respond(w, util.Success("success", user.Self()))
+}
+
+// failUserForm responds to a user that could not be saved. A password
+// that breaks the password policy comes with its code and limit, so the
+// frontend can explain the rule.
+func failUserForm(w http.ResponseWriter, r *http.Request, err error) {
+	slogger.InvalidRequest(r.Context(), err.Error())
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if pwErr, ok := err.(*models.PasswordError); ok {
+		util.Respond(w, util.FailWith("fail", pwErr.Error(), pwErr))
 		return
 	}
-	util.Respond(w, util.Success("success", user))
+	util.Respond(w, util.Fail("fail", err.Error()))
+}
+
+// recipient addresses an email to user in their language
+func recipient(user *models.User) email.Recipient {
+	return email.Recipient{
+		Name:   user.FirstName,
+		Email:  user.Email,
+		Locale: user.Locale,
+	}
+}
+
+// acceptedLocale returns the language the client prefers most
+// according to its Accept-Language header, or "" when it has none we
+// can use. Only the primary language is kept, so en-GB becomes en.
+func acceptedLocale(r *http.Request) string {
+	first := strings.Split(r.Header.Get("Accept-Language"), ",")[0]
+	first = strings.TrimSpace(strings.Split(first, ";")[0])
+	lang := strings.ToLower(strings.Split(first, "-")[0])
+	if len(lang) < 2 || len(lang) > 3 {
+		return ""
+	}
+	for _, c := range lang {
+		if c < 'a' || c > 'z' {
+			return ""
+		}
+	}
+	return lang
 }
 
 // userByID returns a user from the DB by their ID
@@ -286,18 +428,18 @@ func (u *Users) userByID(w http.ResponseWriter, r *http.Request) (*models.User,
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		slogger.InvalidArg(err.Error())
+		slogger.InvalidArg(r.Context(), err.Error())
 		return nil, err
 	}
 	user, err := u.us.ByID(uint(id))
 	if err != nil {
-		slogger.InvalidArg(err.Error())
+		slogger.InvalidArg(r.Context(), err.Error())
 		return nil, err
 	}
 
 	// books, err := u.bs.ByUserID(user.ID)
 	// if err != nil {
-	// 	slogger.InvalidArg(err.Error())
+	// 	slogger.InvalidArg(r.Context(), err.Error())
 	// 	return nil, err
 	// }
 	// user.Books = books
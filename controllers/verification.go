@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// sendVerification emails the user a link to verify their address
+func (u *Users) sendVerification(user *models.User) error {
+	token, err := u.us.InitiateVerification(user)
+	if err != nil {
+		return err
+	}
+	return u.emailer.VerifyEmail(recipient(user), token)
+}
+
+// Verify confirms a user's email address with the token they were mailed
+// POST /users/verify?token=
+func (u *Users) Verify(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	user, err := u.us.CompleteVerification(token)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		util.Respond(w, util.Fail("fail", err.Error()))
+		return
+	}
+	err = u.emailer.Welcome(recipient(user))
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+	}
+	message := &ResponseMessage{
+		Message: "Your email address has been verified.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
+
+// ResendVerification mails the signed in user a new verification link
+// POST /users/verify/resend
+func (u *Users) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	err := u.sendVerification(user)
+	if err != nil {
+		slogger.InvalidRequest(r.Context(), err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		switch err {
+		case models.ErrVerificationThrottled:
+			w.Header().Set("Retry-After", strconv.Itoa(int(models.VerificationResendInterval.Seconds())))
+			w.WriteHeader(http.StatusTooManyRequests)
+			util.Respond(w, util.Fail("fail", err.Error()))
+		case models.ErrEmailAlreadyVerified:
+			w.WriteHeader(http.StatusBadRequest)
+			util.Respond(w, util.Fail("fail", err.Error()))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			util.Respond(w, util.Fail("fail", "Error sending verification email"))
+		}
+		return
+	}
+	message := &ResponseMessage{
+		Message: "A verification link has been emailed to you.",
+	}
+	util.Respond(w, util.Success("success", message))
+}
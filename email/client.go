@@ -0,0 +1,236 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// DefaultBaseURL is where links in our emails point unless WithBaseURL
+// says otherwise
+const DefaultBaseURL = "https://revbook13420.herokuapp.com"
+
+// Recipient is who an email is addressed to. Locale selects the
+// language of the templates used.
+type Recipient struct {
+	Name   string
+	Email  string
+	Locale string
+}
+
+// WithSender helps us set the sender for our email
+func WithSender(name, email string) ClientConfig {
+	return func(c *Client) {
+		c.from = buildEmail(name, email)
+	}
+}
+
+// WithBaseURL sets the address of the frontend that links in our
+// emails point to
+func WithBaseURL(baseURL string) ClientConfig {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithTemplates replaces the default email templates
+func WithTemplates(t *Templates) ClientConfig {
+	return func(c *Client) {
+		c.templates = t
+	}
+}
+
+// ClientConfig function template
+type ClientConfig func(*Client)
+
+// NewClient creates an email client template
+func NewClient(opts ...ClientConfig) *Client {
+	client := Client{
+		// set a default from email address
+		from:      "support@literaryreviews.com",
+		baseURL:   DefaultBaseURL,
+		templates: DefaultTemplates(),
+	}
+	for _, opt := range opts {
+		opt(&client)
+	}
+	return &client
+}
+
+// Client struct for our email. It renders our messages from templates
+// and hands them to a Sender for delivery.
+type Client struct {
+	from      string
+	baseURL   string
+	templates *Templates
+	sender    Sender
+	queue     Enqueuer
+}
+
+// send queues msg for delivery when the client has a queue and
+// delivers it straight away otherwise
+func (c *Client) send(msg Message) error {
+	if c.queue != nil {
+		return c.queue.Enqueue(Queue, msg)
+	}
+	return c.deliver(msg)
+}
+
+// deliver hands msg to the configured Sender
+func (c *Client) deliver(msg Message) error {
+	if c.sender == nil {
+		return ErrNoSender
+	}
+	return c.sender.Send(msg)
+}
+
+// Deliver sends a message queued by a client using WithQueue. It is
+// the handler for jobs on the email Queue.
+func (c *Client) Deliver(payload []byte) error {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return err
+	}
+	return c.deliver(msg)
+}
+
+// sendTemplate renders the named template for to and sends it
+func (c *Client) sendTemplate(name string, to Recipient, data TemplateData) error {
+	data.Name = to.Name
+	data.Email = to.Email
+	data.BaseURL = c.baseURL
+	msg, err := c.templates.Render(to.Locale, name, data)
+	if err != nil {
+		return err
+	}
+	msg.From = c.from
+	msg.To = buildEmail(to.Name, to.Email)
+	return c.send(msg)
+}
+
+// link builds a frontend URL carrying token
+func (c *Client) link(path, token string) string {
+	v := url.Values{}
+	v.Set("token", token)
+	return c.baseURL + path + "?" + v.Encode()
+}
+
+// Welcome sends the welcome email to users
+func (c *Client) Welcome(to Recipient) error {
+	return c.sendTemplate("welcome", to, TemplateData{})
+}
+
+// ResetPw handles password reset mail
+func (c *Client) ResetPw(to Recipient, token string) error {
+	return c.sendTemplate("reset", to, TemplateData{
+		URL:   c.link("/reset", token),
+		Token: token,
+	})
+}
+
+// VerifyEmail sends the link used to verify a user's email address
+func (c *Client) VerifyEmail(to Recipient, token string) error {
+	return c.sendTemplate("verify", to, TemplateData{
+		URL:   c.link("/verify", token),
+		Token: token,
+	})
+}
+
+// Unlock sends the link that lifts a lockout caused by failed logins
+func (c *Client) Unlock(to Recipient, token string) error {
+	return c.sendTemplate("unlock", to, TemplateData{
+		URL:   c.link("/unlock", token),
+		Token: token,
+	})
+}
+
+// ReviewNotice describes a review posted on one of the recipient's books
+type ReviewNotice struct {
+	Reviewer string
+	Book     string
+	BookID   uint
+	Rating   int
+	Notes    string
+}
+
+// DigestItem is one notification listed in a daily digest
+type DigestItem struct {
+	Message string
+	BookID  uint
+}
+
+// NewReview tells a book's owner that someone reviewed it
+func (c *Client) NewReview(to Recipient, n ReviewNotice) error {
+	return c.sendTemplate("review", to, TemplateData{
+		URL:      c.bookURL(n.BookID),
+		Reviewer: n.Reviewer,
+		Book:     n.Book,
+		Rating:   n.Rating,
+		Notes:    n.Notes,
+	})
+}
+
+// Digest sends a summary of the recipient's unread notifications
+func (c *Client) Digest(to Recipient, items []DigestItem) error {
+	data := TemplateData{}
+	for _, item := range items {
+		data.Items = append(data.Items, TemplateData{
+			Message: item.Message,
+			URL:     c.bookURL(item.BookID),
+		})
+	}
+	return c.sendTemplate("digest", to, data)
+}
+
+// bookURL links to a book's page on the frontend
+func (c *Client) bookURL(id uint) string {
+	return fmt.Sprintf("%s/book/%d", c.baseURL, id)
+}
+
+// Preview renders every email in locale with sample data and writes
+// them to w, so template changes can be checked without sending mail
+func (c *Client) Preview(w io.Writer, locale string) error {
+	to := Recipient{Name: "Jane", Email: "jane@example.com", Locale: locale}
+	for _, name := range TemplateNames {
+		token := "sample-token"
+		link := c.bookURL(1)
+		if name == "reset" || name == "verify" || name == "unlock" {
+			link = c.link("/"+name, token)
+		}
+		msg, err := c.templates.Render(locale, name, TemplateData{
+			Name:     to.Name,
+			Email:    to.Email,
+			URL:      link,
+			Token:    token,
+			BaseURL:  c.baseURL,
+			Reviewer: "Sam Adeyemi",
+			Book:     "Things Fall Apart",
+			Rating:   5,
+			Notes:    "A classic that rewards every reread.",
+			Items: []TemplateData{
+				{Message: `Sam Adeyemi reviewed "Things Fall Apart"`, URL: c.bookURL(1)},
+				{Message: `Ada Obi reviewed "Half of a Yellow Sun"`, URL: c.bookURL(2)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "==== %s (%s) ====\n", name, locale)
+		fmt.Fprintf(w, "Subject: %s\n\n", msg.Subject)
+		fmt.Fprintf(w, "---- text ----\n%s\n", msg.Text)
+		fmt.Fprintf(w, "---- html ----\n%s\n", msg.HTML)
+	}
+	return nil
+}
+
+// buildEmail formats name and email as an address for the From or To
+// header, quoting the name when it needs it
+func buildEmail(name, email string) string {
+	if name == "" {
+		return headerValue(email)
+	}
+	return (&mail.Address{Name: headerValue(name), Address: headerValue(email)}).String()
+}
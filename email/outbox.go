@@ -0,0 +1,67 @@
+package email
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox keeps the messages it is given instead of delivering them, so
+// the server can run locally without mail credentials and tests can
+// assert on what was sent. When it has a directory, every message is
+// also written there as an .eml file.
+type Outbox struct {
+	dir      string
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewOutbox creates an outbox. An empty dir keeps messages in memory only.
+func NewOutbox(dir string) (*Outbox, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+// WithOutbox makes the client deliver mail into o
+func WithOutbox(o *Outbox) ClientConfig {
+	return WithTransport(o)
+}
+
+// Send stores msg in the outbox
+func (o *Outbox) Send(msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	if o.dir == "" {
+		return nil
+	}
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%04d.eml", time.Now().UnixNano(), len(o.messages))
+	return ioutil.WriteFile(filepath.Join(o.dir, name), body, 0644)
+}
+
+// Messages returns every message sent so far, oldest first
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	messages := make([]Message, len(o.messages))
+	copy(messages, o.messages)
+	return messages
+}
+
+// Reset empties the in-memory outbox
+func (o *Outbox) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = nil
+}
@@ -0,0 +1,122 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ErrNoSender is returned when a Client is asked to send mail without
+// a transport configured
+var ErrNoSender = errors.New("email: no sender configured")
+
+// Message is an email ready to be handed to a Sender
+type Message struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// Sender delivers messages built by Client. Mailgun, SMTP and the
+// Outbox all implement it.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Queue is the email queue jobs are stored on
+const Queue = "email"
+
+// Enqueuer stores a payload on a queue for a background worker. It is
+// satisfied by models.JobService.
+type Enqueuer interface {
+	Enqueue(queue string, payload interface{}) error
+}
+
+// WithQueue makes the client hand messages to a job queue instead of
+// sending them during the request. A worker passes them on to Deliver.
+func WithQueue(q Enqueuer) ClientConfig {
+	return func(c *Client) {
+		c.queue = q
+	}
+}
+
+// WithTransport makes the client deliver mail through s
+func WithTransport(s Sender) ClientConfig {
+	return func(c *Client) {
+		c.sender = s
+	}
+}
+
+// Bytes renders the message in RFC 5322 format with a plain text and,
+// when set, an HTML alternative
+func (m Message) Bytes() ([]byte, error) {
+	from, err := parseAddress(m.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseAddress(m.To)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(m.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(m.Text)
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// headerValue removes line breaks from s so that it cannot end the
+// header it is written in and start another
+func headerValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// parseAddress reads an address written by buildEmail
+func parseAddress(s string) (*mail.Address, error) {
+	return mail.ParseAddress(headerValue(s))
+}
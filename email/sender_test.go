@@ -0,0 +1,44 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMessageHeadersCannotBeInjected(t *testing.T) {
+	msg := Message{
+		From:    buildEmail("Literary Support", "support@example.com"),
+		To:      buildEmail("Ada\r\nBcc: victim@example.com", "ada@example.com"),
+		Subject: "Hello\r\nBcc: victim@example.com",
+		Text:    "Hi",
+	}
+	b, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := string(b)[:strings.Index(string(b), "\r\n\r\n")]
+	for _, line := range strings.Split(header, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("header has an injected line %q:\n%s", line, header)
+		}
+	}
+	if !strings.Contains(header, `To: "AdaBcc: victim@example.com" <ada@example.com>`) {
+		t.Errorf("header = %s, want the name quoted in To", header)
+	}
+}
+
+func TestBuildEmail(t *testing.T) {
+	tests := []struct {
+		name, email, want string
+	}{
+		{"", "ada@example.com", "ada@example.com"},
+		{"Ada Lovelace", "ada@example.com", `"Ada Lovelace" <ada@example.com>`},
+		{"Lovelace, Ada", "ada@example.com", `"Lovelace, Ada" <ada@example.com>`},
+		{"Ada\n", "ada@example.com\r\n", `"Ada" <ada@example.com>`},
+	}
+	for _, tt := range tests {
+		if got := buildEmail(tt.name, tt.email); got != tt.want {
+			t.Errorf("buildEmail(%q, %q) = %s, want %s", tt.name, tt.email, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package email
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+// WithSMTP delivers our mail through a plain SMTP server. The username
+// and password may be left empty for servers that need no auth.
+func WithSMTP(host string, port int, username, password string) ClientConfig {
+	return func(c *Client) {
+		c.sender = &smtpSender{
+			addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+			host:     host,
+			username: username,
+			password: password,
+		}
+	}
+}
+
+type smtpSender struct {
+	addr     string
+	host     string
+	username string
+	password string
+}
+
+// Send delivers msg to the SMTP server, upgrading to TLS when the
+// server supports it
+func (ss *smtpSender) Send(msg Message) error {
+	from, err := parseAddress(msg.From)
+	if err != nil {
+		return err
+	}
+	to, err := parseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if ss.username != "" {
+		auth = smtp.PlainAuth("", ss.username, ss.password, ss.host)
+	}
+	return smtp.SendMail(ss.addr, auth, from.Address, []string{to.Address}, body)
+}
@@ -0,0 +1,335 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used when there is no template in a recipient's locale
+const DefaultLocale = "en"
+
+// TemplateNames lists the emails we send. Each has a text template,
+// which also defines its "subject", and an HTML template.
+var TemplateNames = []string{"welcome", "verify", "reset", "unlock", "review", "digest"}
+
+// TemplateData is what every email template is rendered with. The
+// review fields describe a review notification, and Items holds one
+// entry per notification in a digest.
+type TemplateData struct {
+	Name     string
+	Email    string
+	URL      string
+	Token    string
+	BaseURL  string
+	Reviewer string
+	Book     string
+	Rating   int
+	Notes    string
+	Message  string
+	Items    []TemplateData
+}
+
+// defaultTemplates are compiled into the binary so mail can be sent
+// without a templates directory. They are keyed by locale and then by
+// file name.
+var defaultTemplates = map[string]map[string]string{
+	DefaultLocale: {
+		"welcome.txt": `{{define "subject"}}Welcome to Literary Reviews{{end}}Hi {{if .Name}}{{.Name}}{{else}}there{{end}}!
+
+Welcome to Literary Reviews! We hope you have a fun time!
+
+Best,
+Literary Support
+`,
+		"welcome.html": `Hi {{if .Name}}{{.Name}}{{else}}there{{end}}!<br/>
+<br/>
+Welcome to
+<a href="{{.BaseURL}}">Literary Reviews</a>! We hope you have a fun time!!<br/>
+<br/>
+Best,<br/>
+Literary Support
+`,
+		"verify.txt": `{{define "subject"}}Please verify your email address{{end}}Hi {{if .Name}}{{.Name}}{{else}}there{{end}},
+
+Thanks for signing up to Literary Reviews! Please confirm that this is your email address by following the link below:
+
+{{.URL}}
+
+The link expires in 24 hours. If you didn't create an account you can safely ignore this email.
+
+Best,
+Literary Support
+`,
+		"verify.html": `Hi {{if .Name}}{{.Name}}{{else}}there{{end}},<br/>
+<br/>
+Thanks for signing up to Literary Reviews! Please confirm that this is your email address by following the link below:<br/>
+<br/>
+<a href="{{.URL}}">{{.URL}}</a><br/>
+<br/>
+The link expires in 24 hours. If you didn't create an account you can safely ignore this email.<br/>
+<br/>
+Best,<br/>
+Literary Support<br/>
+`,
+		"reset.txt": `{{define "subject"}}Instructions for resetting your password.{{end}}Hi there!
+
+It appears that you have requested a password reset. If this was you, please follow the link below to update your password:
+
+{{.URL}}
+
+If you are asked for a token, please use the following value:
+
+{{.Token}}
+
+If you didn't request a password reset you can safely ignore this email and your account will not be changed.
+
+Best,
+Literary Support
+`,
+		"reset.html": `Hi there!<br/>
+<br/>
+It appears that you have requested a password reset. If this was you, please follow the link below to update your password:<br/>
+<br/>
+<a href="{{.URL}}">{{.URL}}</a><br/>
+<br/>
+If you are asked for a token, please use the following value:<br/>
+<br/>
+{{.Token}}<br/>
+<br/>
+If you didn't request a password reset you can safely ignore this email and your account will not be changed.<br/>
+<br/>
+Best,<br/>
+Literary Support<br/>
+`,
+		"unlock.txt": `{{define "subject"}}Your account has been locked{{end}}Hi {{if .Name}}{{.Name}}{{else}}there{{end}},
+
+There were too many failed attempts to log in to your account, so logging in has been locked for 15 minutes.
+
+If this was you, you can unlock your account now by following the link below:
+
+{{.URL}}
+
+If it wasn't you, someone may be trying to guess your password. Your account is safe, but you may want to reset your password to one that is harder to guess.
+
+Best,
+Literary Support
+`,
+		"unlock.html": `Hi {{if .Name}}{{.Name}}{{else}}there{{end}},<br/>
+<br/>
+There were too many failed attempts to log in to your account, so logging in has been locked for 15 minutes.<br/>
+<br/>
+If this was you, you can unlock your account now by following the link below:<br/>
+<br/>
+<a href="{{.URL}}">{{.URL}}</a><br/>
+<br/>
+If it wasn't you, someone may be trying to guess your password. Your account is safe, but you may want to reset your password to one that is harder to guess.<br/>
+<br/>
+Best,<br/>
+Literary Support<br/>
+`,
+		"review.txt": `{{define "subject"}}{{.Reviewer}} reviewed {{.Book}}{{end}}Hi {{if .Name}}{{.Name}}{{else}}there{{end}},
+
+{{.Reviewer}} gave {{.Book}} {{.Rating}} out of 5 stars:
+
+{{.Notes}}
+
+Read the review at {{.URL}}
+
+You can change how often we email you about reviews in your profile.
+
+Best,
+Literary Support
+`,
+		"review.html": `Hi {{if .Name}}{{.Name}}{{else}}there{{end}},<br/>
+<br/>
+{{.Reviewer}} gave <a href="{{.URL}}">{{.Book}}</a> {{.Rating}} out of 5 stars:<br/>
+<br/>
+<blockquote>{{.Notes}}</blockquote>
+<br/>
+You can change how often we email you about reviews in your profile.<br/>
+<br/>
+Best,<br/>
+Literary Support<br/>
+`,
+		"digest.txt": `{{define "subject"}}Your daily Literary Reviews digest{{end}}Hi {{if .Name}}{{.Name}}{{else}}there{{end}},
+
+Here is what happened to your books today:
+{{range .Items}}
+- {{.Message}}: {{.URL}}{{end}}
+
+You can change how often we email you about reviews in your profile.
+
+Best,
+Literary Support
+`,
+		"digest.html": `Hi {{if .Name}}{{.Name}}{{else}}there{{end}},<br/>
+<br/>
+Here is what happened to your books today:<br/>
+<ul>
+{{range .Items}}<li><a href="{{.URL}}">{{.Message}}</a></li>
+{{end}}</ul>
+You can change how often we email you about reviews in your profile.<br/>
+<br/>
+Best,<br/>
+Literary Support<br/>
+`,
+	},
+}
+
+// Templates holds the parsed email templates of every locale
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// templateKey identifies the template of an email in a locale
+func templateKey(locale, name string) string {
+	return locale + "/" + name
+}
+
+// DefaultTemplates returns the templates compiled into the binary
+func DefaultTemplates() *Templates {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	for locale, files := range defaultTemplates {
+		for file, src := range files {
+			if err := t.parse(locale, file, src); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return t
+}
+
+// LoadTemplates reads templates from dir on top of the defaults. dir
+// holds one directory per locale, e.g. dir/fr/welcome.txt and
+// dir/fr/welcome.html, so new locales can be added and the default
+// English copy can be overridden without a rebuild.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := DefaultTemplates()
+	locales, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(dir, locale.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			src, err := ioutil.ReadFile(filepath.Join(dir, locale.Name(), file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			err = t.parse(strings.ToLower(locale.Name()), file.Name(), string(src))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// parse adds the template in file, such as welcome.txt, for locale
+func (t *Templates) parse(locale, file, src string) error {
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+	if !knownTemplate(name) {
+		return fmt.Errorf("email: unknown template %s/%s", locale, file)
+	}
+	key := templateKey(locale, name)
+	switch ext {
+	case ".txt":
+		tmpl, err := texttemplate.New(key).Parse(src)
+		if err != nil {
+			return err
+		}
+		if tmpl.Lookup("subject") == nil {
+			return fmt.Errorf("email: template %s/%s does not define a subject", locale, file)
+		}
+		t.text[key] = tmpl
+	case ".html":
+		tmpl, err := htmltemplate.New(key).Parse(src)
+		if err != nil {
+			return err
+		}
+		t.html[key] = tmpl
+	default:
+		return fmt.Errorf("email: template %s/%s must be a .txt or .html file", locale, file)
+	}
+	return nil
+}
+
+func knownTemplate(name string) bool {
+	for _, known := range TemplateNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// locales returns the locales to try for a recipient, most specific
+// first: "pt-br" falls back to "pt" and then to DefaultLocale
+func locales(locale string) []string {
+	locale = strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, locale)
+		if i := strings.Index(locale, "-"); i > 0 {
+			candidates = append(candidates, locale[:i])
+		}
+	}
+	return append(candidates, DefaultLocale)
+}
+
+// Render builds the subject, text and HTML bodies of the named email in
+// the closest locale that has it. A locale with only a text template
+// sends a plain text email rather than mixing in another language.
+func (t *Templates) Render(locale, name string, data TemplateData) (Message, error) {
+	var msg Message
+	var textTmpl *texttemplate.Template
+	var htmlTmpl *htmltemplate.Template
+	for _, candidate := range locales(locale) {
+		key := templateKey(candidate, name)
+		if textTmpl = t.text[key]; textTmpl != nil {
+			htmlTmpl = t.html[key]
+			break
+		}
+	}
+	if textTmpl == nil {
+		return msg, fmt.Errorf("email: no template named %s", name)
+	}
+
+	var buf bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := textTmpl.Execute(&buf, data); err != nil {
+		return msg, err
+	}
+	msg.Text = strings.TrimLeft(buf.String(), "\n")
+	if htmlTmpl != nil {
+		buf.Reset()
+		if err := htmlTmpl.Execute(&buf, data); err != nil {
+			return msg, err
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
@@ -10,8 +10,11 @@ require (
 	github.com/jinzhu/gorm v1.9.12
 	github.com/joho/godotenv v1.3.0
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/lib/pq v1.1.1
+	github.com/pelletier/go-toml v1.9.5
 	github.com/sajicode/go-photo v0.0.0-20200402042021-093def52954e
 	github.com/sirupsen/logrus v1.5.0
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
 	gopkg.in/mailgun/mailgun-go.v1 v1.1.1
+	gopkg.in/yaml.v2 v2.2.4
 )
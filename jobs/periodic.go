@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Task is work run by a Periodic, given the time it runs at
+type Task func(now time.Time) error
+
+// Periodic runs a task once when started and then every interval until
+// stopped, such as deleting rows that are no longer needed
+type Periodic struct {
+	name     string
+	interval time.Duration
+	task     Task
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewPeriodic creates a Periodic for task. Call Start to begin.
+func NewPeriodic(name string, interval time.Duration, task Task) *Periodic {
+	return &Periodic{
+		name:     name,
+		interval: interval,
+		task:     task,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start launches the goroutine running the task
+func (p *Periodic) Start() {
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// Stop asks the task to stop and waits for a run in progress to finish
+func (p *Periodic) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+func (p *Periodic) loop() {
+	defer p.wg.Done()
+	for {
+		if err := p.task(time.Now()); err != nil {
+			slogger.ServerError(context.Background(), fmt.Sprintf("%s: %v", p.name, err))
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sajicode/go-book/logger"
+	"github.com/sajicode/go-book/models"
+)
+
+// * logger
+var slogger = logger.NewLogger()
+
+// DefaultPollInterval is how long an idle worker waits before checking
+// its queue again
+const DefaultPollInterval = 2 * time.Second
+
+// purgeInterval is how often a worker deletes the old jobs on its queue
+const purgeInterval = time.Hour
+
+// Handler runs the job with the given JSON payload. Returning an error
+// schedules the job to be retried.
+type Handler func(payload []byte) error
+
+// Worker runs goroutines that claim jobs from one queue and pass them
+// to a Handler
+type Worker struct {
+	js           models.JobService
+	queue        string
+	handler      Handler
+	concurrency  int
+	pollInterval time.Duration
+	retention    time.Duration
+	purger       *Periodic
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// WorkerConfig function template
+type WorkerConfig func(*Worker)
+
+// WithConcurrency sets how many jobs the worker handles at once
+func WithConcurrency(n int) WorkerConfig {
+	return func(w *Worker) {
+		if n > 0 {
+			w.concurrency = n
+		}
+	}
+}
+
+// WithPollInterval sets how often an idle worker checks for jobs
+func WithPollInterval(d time.Duration) WorkerConfig {
+	return func(w *Worker) {
+		if d > 0 {
+			w.pollInterval = d
+		}
+	}
+}
+
+// WithRetention sets how long done and dead jobs are kept before the
+// worker purges them
+func WithRetention(d time.Duration) WorkerConfig {
+	return func(w *Worker) {
+		if d > 0 {
+			w.retention = d
+		}
+	}
+}
+
+// NewWorker creates a worker for queue. Call Start to begin work.
+func NewWorker(js models.JobService, queue string, handler Handler, opts ...WorkerConfig) *Worker {
+	w := Worker{
+		js:           js,
+		queue:        queue,
+		handler:      handler,
+		concurrency:  1,
+		pollInterval: DefaultPollInterval,
+		retention:    models.DefaultJobRetention,
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&w)
+	}
+	w.purger = NewPeriodic("purging jobs on "+queue, purgeInterval, w.purge)
+	return &w
+}
+
+// Start launches the worker goroutines
+func (w *Worker) Start() {
+	for i := 0; i < w.concurrency; i++ {
+		w.wg.Add(1)
+		go w.loop()
+	}
+	w.purger.Start()
+}
+
+// Stop asks the worker to stop and waits for jobs in progress to finish
+func (w *Worker) Stop() {
+	close(w.stop)
+	w.purger.Stop()
+	w.wg.Wait()
+}
+
+// loop keeps claiming jobs until stopped, sleeping whenever the queue
+// is empty
+func (w *Worker) loop() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		worked, err := w.runNext()
+		if err != nil {
+			slogger.ServerError(context.Background(), err.Error())
+		}
+		if worked {
+			continue
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+// purge deletes the jobs on the queue that finished before the
+// retention period up to now
+func (w *Worker) purge(now time.Time) error {
+	n, err := w.js.Purge(w.queue, now.Add(-w.retention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		slogger.Infof("Purged %d finished jobs on %s", n, w.queue)
+	}
+	return nil
+}
+
+// runNext handles the next due job. It reports whether there was one.
+func (w *Worker) runNext() (bool, error) {
+	job, err := w.js.Claim(w.queue)
+	if err == models.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := w.handle(job); err != nil {
+		slogger.ServerError(context.Background(), fmt.Sprintf("job %d on %s failed attempt %d: %v", job.ID, job.Queue, job.Attempts, err))
+		return true, w.js.Fail(job, err)
+	}
+	return true, w.js.Complete(job)
+}
+
+// handle runs the handler, turning a panic into an error so one bad
+// job cannot take the worker down
+func (w *Worker) handle(job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.handler([]byte(job.Payload))
+}
@@ -1,10 +1,14 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 
+	appctx "github.com/sajicode/go-book/context"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,27 +23,136 @@ type MainLogger struct {
 	*logrus.Logger
 }
 
-func init() {
-	//* log as JSON instead of the default ASCII formatter
-	logrus.SetFormatter(&logrus.JSONFormatter{})
+//* the one logger shared by every package. It logs JSON to stdout
+//* until Configure is called.
+var std = newStd()
+
+var (
+	mu      sync.Mutex
+	closers []io.Closer
+)
+
+func newStd() *MainLogger {
+	baseLogger := logrus.New()
+	baseLogger.Formatter = &logrus.JSONFormatter{}
+	baseLogger.SetOutput(os.Stdout)
+	return &MainLogger{baseLogger}
 }
 
-// NewLogger initializes the standard logger
+// NewLogger returns the shared logger. Every caller gets the same one,
+// so configuring it once in main applies everywhere.
 func NewLogger() *MainLogger {
-	f, err := os.OpenFile("logrus.log", os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+	return std
+}
+
+// Config describes where and how the shared logger writes
+type Config struct {
+	// Level is the least severe level logged, e.g. info or debug
+	Level string
+	// Format is json or text
+	Format string
+	// Outputs lists the targets to write to: stdout, file and syslog
+	Outputs []string
+	// File is the path written to by the file output
+	File   string
+	Rotate RotateConfig
+	// SyslogTag names the app in syslog
+	SyslogTag string
+}
+
+// Configure applies cfg to the shared logger. Outputs opened by an
+// earlier call are closed.
+func Configure(cfg Config) error {
+	level, err := logrus.ParseLevel(cfg.Level)
 	if err != nil {
-		fmt.Printf("error opening file: %v", err)
+		return err
 	}
 
-	var baseLogger = logrus.New()
-	var standardLogger = &MainLogger{baseLogger}
+	var formatter logrus.Formatter
+	switch cfg.Format {
+	case "", "json":
+		formatter = &logrus.JSONFormatter{}
+	case "text":
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	default:
+		return fmt.Errorf("logger: unknown format %q", cfg.Format)
+	}
 
-	standardLogger.Formatter = &logrus.JSONFormatter{}
+	var writers []io.Writer
+	var opened []io.Closer
+	fail := func(err error) error {
+		for _, c := range opened {
+			c.Close()
+		}
+		return err
+	}
+	for _, output := range cfg.Outputs {
+		switch strings.TrimSpace(output) {
+		case "stdout":
+			writers = append(writers, os.Stdout)
+		case "file":
+			f, err := OpenRotatingFile(cfg.File, cfg.Rotate)
+			if err != nil {
+				return fail(err)
+			}
+			writers = append(writers, f)
+			opened = append(opened, f)
+		case "syslog":
+			w, err := openSyslog(cfg.SyslogTag)
+			if err != nil {
+				return fail(err)
+			}
+			writers = append(writers, w)
+			opened = append(opened, w)
+		case "":
+		default:
+			return fail(fmt.Errorf("logger: unknown output %q", output))
+		}
+	}
+	if len(writers) == 0 {
+		writers = append(writers, os.Stdout)
+	}
 
-	mw := io.MultiWriter(os.Stdout, f)
-	standardLogger.SetOutput(mw)
+	mu.Lock()
+	defer mu.Unlock()
+	std.SetFormatter(formatter)
+	std.SetLevel(level)
+	std.SetOutput(io.MultiWriter(writers...))
+	for _, c := range closers {
+		c.Close()
+	}
+	closers = opened
+	return nil
+}
+
+// SetLevel changes the level of the shared logger while the app runs
+func SetLevel(level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	std.SetLevel(lvl)
+	return nil
+}
+
+// Level returns the level the shared logger logs at
+func Level() string {
+	return std.GetLevel().String()
+}
 
-	return standardLogger
+// Close closes the files and connections the logger writes to
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	std.SetOutput(os.Stdout)
+	var err error
+	for _, c := range closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	closers = nil
+	return err
 }
 
 //* Variables to store our log messages as new events
@@ -51,27 +164,42 @@ var (
 	unknownServerError     = LogEvent{5, "Unknown Server Error: %s"}
 )
 
+// WithRequest returns an entry carrying the request ID and user ID
+// stored in ctx, so that every line logged for a request can be found
+func (l *MainLogger) WithRequest(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(l.Logger)
+	info := appctx.Request(ctx)
+	if info == nil {
+		return entry
+	}
+	fields := logrus.Fields{"request_id": info.ID}
+	if info.UserID != 0 {
+		fields["user_id"] = info.UserID
+	}
+	return entry.WithFields(fields)
+}
+
 // InvalidArg error message"
-func (l *MainLogger) InvalidArg(argumentName string) {
-	l.Errorf(invalidArgMessage.message, argumentName)
+func (l *MainLogger) InvalidArg(ctx context.Context, argumentName string) {
+	l.WithRequest(ctx).Errorf(invalidArgMessage.message, argumentName)
 }
 
 // InvalidArgValue error message"
-func (l *MainLogger) InvalidArgValue(argumentName string, argumentValue string) {
-	l.Errorf(invalidArgValueMessage.message, argumentName, argumentValue)
+func (l *MainLogger) InvalidArgValue(ctx context.Context, argumentName string, argumentValue string) {
+	l.WithRequest(ctx).Errorf(invalidArgValueMessage.message, argumentName, argumentValue)
 }
 
 // MissingArg error message"
-func (l *MainLogger) MissingArg(argumentName string) {
-	l.Errorf(missingArgMessage.message, argumentName)
+func (l *MainLogger) MissingArg(ctx context.Context, argumentName string) {
+	l.WithRequest(ctx).Errorf(missingArgMessage.message, argumentName)
 }
 
 // InvalidRequest error message"
-func (l *MainLogger) InvalidRequest(argumentName string) {
-	l.Errorf(invalidRequestMessage.message, argumentName)
+func (l *MainLogger) InvalidRequest(ctx context.Context, argumentName string) {
+	l.WithRequest(ctx).Errorf(invalidRequestMessage.message, argumentName)
 }
 
 // ServerError logs messages from unknown server errors
-func (l *MainLogger) ServerError(errorString string) {
-	l.Errorf(unknownServerError.message, errorString)
+func (l *MainLogger) ServerError(ctx context.Context, errorString string) {
+	l.WithRequest(ctx).Errorf(unknownServerError.message, errorString)
 }
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files. It sorts in time order.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateConfig says when a log file is rotated and how many of the
+// rotated files are kept. Zero values turn a rule off.
+type RotateConfig struct {
+	// MaxSize rotates the file once it would grow past this many bytes
+	MaxSize int64
+	// Interval rotates the file once it has been open this long
+	Interval time.Duration
+	// MaxBackups is how many rotated files to keep
+	MaxBackups int
+	// MaxAge removes rotated files older than this
+	MaxAge time.Duration
+}
+
+// RotatingFile is a log file that moves itself aside to
+// <path>.<timestamp> when it gets too big or too old
+type RotatingFile struct {
+	path string
+	cfg  RotateConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// OpenRotatingFile opens path for appending, creating it if needed
+func OpenRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	rf := RotatingFile{
+		path: path,
+		cfg:  cfg,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return &rf, nil
+}
+
+// Write appends p to the file, rotating it first if p would break one
+// of the rotation rules
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.shouldRotate(len(p)) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close closes the file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+func (rf *RotatingFile) open() error {
+	if dir := filepath.Dir(rf.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	rf.openedAt = time.Now()
+	return nil
+}
+
+func (rf *RotatingFile) shouldRotate(n int) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.cfg.MaxSize > 0 && rf.size+int64(n) > rf.cfg.MaxSize {
+		return true
+	}
+	return rf.cfg.Interval > 0 && time.Since(rf.openedAt) >= rf.cfg.Interval
+}
+
+// rotate moves the current file aside, opens a fresh one and removes
+// rotated files that are no longer kept
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	backup := rf.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(rf.path, backup); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return rf.prune()
+}
+
+func (rf *RotatingFile) prune() error {
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+	//* newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	cutoff := time.Now().Add(-rf.cfg.MaxAge)
+	kept := 0
+	for _, backup := range backups {
+		stamp := strings.TrimPrefix(backup, rf.path+".")
+		rotatedAt, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			//* not one of ours
+			continue
+		}
+		tooMany := rf.cfg.MaxBackups > 0 && kept >= rf.cfg.MaxBackups
+		tooOld := rf.cfg.MaxAge > 0 && rotatedAt.Before(cutoff)
+		if tooMany || tooOld {
+			if err := os.Remove(backup); err != nil {
+				return err
+			}
+			continue
+		}
+		kept++
+	}
+	return nil
+}
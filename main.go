@@ -1,101 +1,229 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
+	"github.com/sajicode/go-book/breached"
+	"github.com/sajicode/go-book/config"
 	"github.com/sajicode/go-book/controllers"
 	"github.com/sajicode/go-book/email"
+	"github.com/sajicode/go-book/jobs"
 	"github.com/sajicode/go-book/logger"
 	"github.com/sajicode/go-book/middleware"
+	"github.com/sajicode/go-book/migrate"
 	"github.com/sajicode/go-book/models"
+	"github.com/sajicode/go-book/notify"
+	"github.com/sajicode/go-book/oidc"
+	"github.com/sajicode/go-book/ratelimit"
+	util "github.com/sajicode/go-book/utils"
 )
 
 // * intialize logger
 var slogger = logger.NewLogger()
 
-func init() {
-	// loads values from .env into the system
-	if err := godotenv.Load(); err != nil {
-		slogger.ServerError("No env variable found")
+func main() {
+	// read the environment, .env and CONFIG_FILE
+	cfg, err := config.Load(".env")
+	exitOnError(err)
+
+	if len(os.Args) > 1 && os.Args[1] == "email:preview" {
+		exitOnError(previewEmails(cfg, os.Args[2:]))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		exitOnError(runMigrations(cfg, os.Args[2:]))
+		return
 	}
+
+	//* stop before touching the database if anything is missing
+	exitOnError(cfg.Validate())
+
+	exitOnError(serve(cfg))
 }
 
-func main() {
+// serve runs the app until it receives SIGINT or SIGTERM, then stops
+// taking requests, lets those in flight finish and stops the
+// background workers before closing the database
+func serve(cfg *config.Config) error {
+	if err := logger.Configure(cfg.Log); err != nil {
+		return err
+	}
+	defer logger.Close()
 
-	// Get environment variables
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	dbDriver := os.Getenv("DB_DRIVER")
-	mgDomain := os.Getenv("MG_DOMAIN")
-	mgAPIKey := os.Getenv("MG_API_KEY")
-	mgPublicKey := os.Getenv("MG_PUBLIC_KEY")
-
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
-
-	services, err := models.NewServices(dbDriver, psqlInfo)
-	must(err)
+	policy, err := passwordPolicy(cfg.Password)
+	if err != nil {
+		return err
+	}
+	services, err := models.NewServices(cfg.DB.Driver, cfg.DB.ConnectionInfo(), models.ServicesConfig{
+		Pepper:         cfg.Pepper,
+		HMACKey:        cfg.HMACKey,
+		PasswordPolicy: policy,
+		LogDB:          !cfg.IsProduction(),
+	})
+	if err != nil {
+		return err
+	}
 	defer services.Close()
 
-	//! to clear db
-	// services.DestructiveReset()
-
-	services.AutoMigrate()
+	// refuse to serve from a schema older than the code
+	pending, err := migrate.New(services.DB(), cfg.MigrationsDir).Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migrations are pending, run `go run main.go migrate up` first", len(pending))
+	}
 
 	// use emailer
+	transport, err := emailTransport(cfg.Email)
+	if err != nil {
+		return err
+	}
+	templates, err := emailTemplates(cfg.Email.TemplatesDir)
+	if err != nil {
+		return err
+	}
 	emailer := email.NewClient(
 		email.WithSender("Literary Support", "support@literaryreviews.co"),
-		email.WithMailgun(mgDomain, mgAPIKey, mgPublicKey),
+		email.WithBaseURL(cfg.BaseURL),
+		email.WithTemplates(templates),
+		email.WithQueue(services.Job),
+		transport,
 	)
 
-	// mock usage to prevent errors
-	// _ = emailer
+	// deliver queued email in the background
+	emailWorker := jobs.NewWorker(services.Job, email.Queue, emailer.Deliver, jobs.WithConcurrency(cfg.Email.Workers))
+	emailWorker.Start()
+	defer emailWorker.Stop()
+
+	// forget login attempts too old to slow anyone down
+	loginAttemptPruner := jobs.NewPeriodic("pruning login attempts", time.Hour, services.User.PruneLoginAttempts)
+	loginAttemptPruner.Start()
+	defer loginAttemptPruner.Stop()
+
+	// notify book owners about new reviews, by email once a day for those who want a digest
+	notifier := notify.NewNotifier(services.Notification, services.User, emailer)
+	digests := notify.NewDigestScheduler(notifier, cfg.DigestHour)
+	digests.Start()
+	defer digests.Stop()
 
 	r := mux.NewRouter()
 
-	usersController := controllers.NewUsers(services.User, *emailer)
+	usersController := controllers.NewUsers(services.User, services.Session, services.TwoFactor, *emailer, cfg.IsProduction())
 	booksController := controllers.NewBooks(services.Book)
-	reviewsController := controllers.NewReviews(services.Review, services.Book)
+	reviewsController := controllers.NewReviews(services.Review, services.Book, notifier)
+	adminController := controllers.NewAdmin(services.User, services.TwoFactor, services.Job)
+	tokensController := controllers.NewTokens(services.APIToken)
+	notificationsController := controllers.NewNotifications(services.Notification)
+	var providers []*oidc.Provider
+	for _, p := range cfg.OIDC {
+		providers = append(providers, oidc.NewProvider(p))
+	}
+	oidcController := controllers.NewOIDC(usersController, services.Identity, providers, cfg.HMACKey, cfg.BaseURL)
 
 	// auth middleware
 	userMw := middleware.User{
-		UserService: services.User,
+		UserService:     services.User,
+		SessionService:  services.Session,
+		APITokenService: services.APIToken,
 	}
+	adminMw := middleware.RequireRole{Role: models.RoleAdmin}
+	verifiedMw := middleware.RequireVerified{Enabled: cfg.RequireVerifiedEmail}
+	limitMw := middleware.RateLimit{Store: rateLimitStore(cfg.RateLimit, services)}
+	limits := cfg.RateLimit
 
 	// Non-existent pages
-	// r.NotFoundHandler = http.HandlerFunc(notFound)
+	r.NotFoundHandler = http.HandlerFunc(notFound)
 
 	api := r.PathPrefix("/api/").Subrouter()
+	//* find out who is signed in first, so the API wide limit is kept
+	//* per token or user rather than per IP address
+	api.Use(userMw.Identify)
+	api.Use(func(next http.Handler) http.Handler {
+		return limitMw.Apply(limits.API, next)
+	})
 
 	// index page
 	api.HandleFunc("/", hello).Methods("GET")
 
 	// user routes
-	api.HandleFunc("/users/signup", usersController.Create).Methods("POST")
-	api.HandleFunc("/users/login", usersController.Login).Methods("POST")
-	api.HandleFunc("/users/update/{id:[0-9]+}", userMw.ApplyFn(usersController.Update)).Methods("POST")
-	api.HandleFunc("/users/{id:[0-9]+}", userMw.ApplyFn(usersController.GetUser)).Methods("GET")
-	api.HandleFunc("/users/info", userMw.ApplyFn(usersController.UserByHash)).Methods("GET")
-	api.HandleFunc("/users/forgot", usersController.InitiateReset).Methods("POST")
-	api.HandleFunc("/users/reset", usersController.CompleteReset).Methods("POST")
+	api.HandleFunc("/users/signup", limitMw.ApplyFn(limits.Signup, usersController.Create)).Methods("POST")
+	api.HandleFunc("/users/login", limitMw.ApplyFn(limits.Login, usersController.Login)).Methods("POST")
+	api.HandleFunc("/users/login/2fa", limitMw.ApplyFn(limits.Login, usersController.LoginTwoFactor)).Methods("POST")
+	api.HandleFunc("/users/update/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeUsersWrite, usersController.Update)).Methods("POST")
+	api.HandleFunc("/users/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeUsersRead, usersController.GetUser)).Methods("GET")
+	api.HandleFunc("/users/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeUsersWrite, usersController.Delete)).Methods("DELETE")
+	api.HandleFunc("/users/restore", limitMw.ApplyFn(limits.Restore, usersController.Restore)).Methods("POST")
+	api.HandleFunc("/users/info", userMw.ApplyScopeFn(models.ScopeUsersRead, usersController.UserByHash)).Methods("GET")
+	api.HandleFunc("/users/forgot", limitMw.ApplyFn(limits.Forgot, usersController.InitiateReset)).Methods("POST")
+	api.HandleFunc("/users/logout", userMw.ApplyFn(usersController.Logout)).Methods("POST")
+	api.HandleFunc("/users/logout/all", userMw.ApplyFn(usersController.LogoutAll)).Methods("POST")
+	api.HandleFunc("/users/sessions", userMw.ApplyFn(usersController.Sessions)).Methods("GET")
+	api.HandleFunc("/users/sessions/{id:[0-9]+}", userMw.ApplyFn(usersController.RevokeSession)).Methods("DELETE")
+	api.HandleFunc("/users/2fa", userMw.ApplyFn(usersController.TwoFactorStatus)).Methods("GET")
+	api.HandleFunc("/users/2fa/enroll", userMw.ApplyFn(usersController.EnrollTwoFactor)).Methods("POST")
+	api.HandleFunc("/users/2fa/confirm", userMw.ApplyFn(usersController.ConfirmTwoFactor)).Methods("POST")
+	api.HandleFunc("/users/2fa/disable", userMw.ApplyFn(usersController.DisableTwoFactor)).Methods("POST")
+	api.HandleFunc("/users/2fa/recovery-codes", userMw.ApplyFn(usersController.RegenerateRecoveryCodes)).Methods("POST")
+	api.HandleFunc("/users/identities", userMw.ApplyScopeFn(models.ScopeUsersRead, oidcController.Identities)).Methods("GET")
+	api.HandleFunc("/users/identities/{id:[0-9]+}", userMw.ApplyFn(oidcController.Unlink)).Methods("DELETE")
+	api.HandleFunc("/users/tokens", userMw.ApplyFn(tokensController.Create)).Methods("POST")
+	api.HandleFunc("/users/tokens", userMw.ApplyFn(tokensController.List)).Methods("GET")
+	api.HandleFunc("/users/tokens/{id:[0-9]+}", userMw.ApplyFn(tokensController.Revoke)).Methods("DELETE")
+	api.HandleFunc("/users/reset", limitMw.ApplyFn(limits.EmailLink, usersController.CompleteReset)).Methods("POST")
+	api.HandleFunc("/users/verify", limitMw.ApplyFn(limits.EmailLink, usersController.Verify)).Methods("POST")
+	api.HandleFunc("/users/unlock", limitMw.ApplyFn(limits.EmailLink, usersController.Unlock)).Methods("POST")
+	api.HandleFunc("/users/verify/resend", userMw.ApplyScopeFn(models.ScopeUsersWrite, usersController.ResendVerification)).Methods("POST")
+
+	// identity provider routes
+	api.HandleFunc("/auth/providers", oidcController.Providers).Methods("GET")
+	api.HandleFunc("/auth/oidc/{provider:[a-z0-9]+}/login", limitMw.ApplyFn(limits.Login, oidcController.Login)).Methods("GET")
+	api.HandleFunc("/auth/oidc/{provider:[a-z0-9]+}/callback", limitMw.ApplyFn(limits.Login, oidcController.Callback)).Methods("GET")
 
 	// book routes
-	api.HandleFunc("/books/new", userMw.ApplyFn(booksController.Create)).Methods("POST")
+	api.HandleFunc("/books/new", userMw.ApplyScopeFn(models.ScopeBooksWrite, verifiedMw.ApplyFn(booksController.Create))).Methods("POST")
 	api.HandleFunc("/books", booksController.GetAllBooks).Methods("GET")
-	api.HandleFunc("/books/me", userMw.ApplyFn(booksController.ShowUserBooks)).Methods("GET")
-	api.HandleFunc("/books/{id:[0-9]+}", userMw.ApplyFn(booksController.GetOneBook)).Methods("GET")
-	api.HandleFunc("/books/update/{id:[0-9]+}", userMw.ApplyFn(booksController.Update)).Methods("POST")
+	api.HandleFunc("/books/search", booksController.Search).Methods("GET")
+	api.HandleFunc("/books/me", userMw.ApplyScopeFn(models.ScopeBooksRead, booksController.ShowUserBooks)).Methods("GET")
+	api.HandleFunc("/books/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeBooksRead, booksController.GetOneBook)).Methods("GET")
+	api.HandleFunc("/books/update/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeBooksWrite, booksController.Update)).Methods("POST")
+	api.HandleFunc("/books/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeBooksWrite, booksController.Delete)).Methods("DELETE")
+	api.HandleFunc("/books/{id:[0-9]+}/restore", userMw.ApplyScopeFn(models.ScopeBooksWrite, booksController.Restore)).Methods("POST")
 
 	// review routes
-	api.HandleFunc("/books/{id:[0-9]+}/review", userMw.ApplyFn(reviewsController.Create)).Methods("POST")
-	api.HandleFunc("/books/{id:[0-9]+}/reviews", userMw.ApplyFn(reviewsController.GetBookReviews)).Methods("GET")
+	api.HandleFunc("/books/{id:[0-9]+}/review", userMw.ApplyScopeFn(models.ScopeReviewsWrite, verifiedMw.ApplyFn(limitMw.ApplyFn(limits.Review, reviewsController.Create)))).Methods("POST")
+	api.HandleFunc("/books/{id:[0-9]+}/reviews", userMw.ApplyScopeFn(models.ScopeReviewsRead, reviewsController.GetBookReviews)).Methods("GET")
+	api.HandleFunc("/reviews/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeReviewsRead, reviewsController.GetReview)).Methods("GET")
+	api.HandleFunc("/reviews/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeReviewsWrite, reviewsController.Update)).Methods("PUT")
+	api.HandleFunc("/reviews/{id:[0-9]+}", userMw.ApplyScopeFn(models.ScopeReviewsWrite, reviewsController.Delete)).Methods("DELETE")
+	api.HandleFunc("/users/{id:[0-9]+}/reviews", userMw.ApplyScopeFn(models.ScopeReviewsRead, reviewsController.GetUserReviews)).Methods("GET")
+	api.HandleFunc("/reviews/{id:[0-9]+}/restore", userMw.ApplyScopeFn(models.ScopeReviewsWrite, reviewsController.Restore)).Methods("POST")
+
+	// notification routes
+	api.HandleFunc("/notifications", userMw.ApplyScopeFn(models.ScopeUsersRead, notificationsController.List)).Methods("GET")
+	api.HandleFunc("/notifications/read", userMw.ApplyScopeFn(models.ScopeUsersWrite, notificationsController.MarkAllRead)).Methods("POST")
+	api.HandleFunc("/notifications/{id:[0-9]+}/read", userMw.ApplyScopeFn(models.ScopeUsersWrite, notificationsController.MarkRead)).Methods("POST")
+
+	// admin routes
+	api.HandleFunc("/admin/users", userMw.ApplyFn(adminMw.ApplyFn(adminController.ListUsers))).Methods("GET")
+	api.HandleFunc("/admin/users/{id:[0-9]+}/suspend", userMw.ApplyFn(adminMw.ApplyFn(adminController.Suspend))).Methods("POST")
+	api.HandleFunc("/admin/users/{id:[0-9]+}/unsuspend", userMw.ApplyFn(adminMw.ApplyFn(adminController.Unsuspend))).Methods("POST")
+	api.HandleFunc("/admin/users/{id:[0-9]+}/2fa/reset", userMw.ApplyFn(adminMw.ApplyFn(adminController.ResetTwoFactor))).Methods("POST")
+	api.HandleFunc("/admin/users/{id:[0-9]+}/role", userMw.ApplyFn(adminMw.ApplyFn(adminController.SetRole))).Methods("PUT")
+	api.HandleFunc("/admin/jobs", userMw.ApplyFn(adminMw.ApplyFn(adminController.Jobs))).Methods("GET")
+	api.HandleFunc("/admin/log-level", userMw.ApplyFn(adminMw.ApplyFn(adminController.LogLevel))).Methods("GET")
+	api.HandleFunc("/admin/log-level", userMw.ApplyFn(adminMw.ApplyFn(adminController.SetLogLevel))).Methods("PUT")
 
 	// serve static files & frontend
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./client/build/static/"))))
@@ -104,15 +232,57 @@ func main() {
 		http.ServeFile(w, r, "./client/build/index.html")
 	})
 
-	appPort := fmt.Sprintf(":%s", os.Getenv("PORT"))
+	appPort := fmt.Sprintf(":%d", cfg.Port)
 	fmt.Println("Starting Server on PORT " + appPort)
 
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Set-Cookie", "Cookie"})
-	originsOk := handlers.AllowedOrigins([]string{os.Getenv("ORIGIN_ALLOWED"), "https://revbook13420.herokuapp.com", "https://revbooks.netlify.app"})
-	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"})
+	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Set-Cookie", "Cookie", "Authorization", middleware.RequestIDHeader})
+	originsOk := handlers.AllowedOrigins([]string{cfg.AllowedOrigin, "https://revbook13420.herokuapp.com", "https://revbooks.netlify.app"})
+	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"})
 	credOk := handlers.AllowCredentials()
+	exposedOk := handlers.ExposedHeaders([]string{
+		middleware.RequestIDHeader,
+		middleware.RateLimitLimitHeader,
+		middleware.RateLimitRemainingHeader,
+		middleware.RateLimitResetHeader,
+		"Retry-After",
+	})
+
+	requestLogger := middleware.RequestLogger{Router: r}
+	realIP := middleware.RealIP{TrustedProxies: cfg.TrustedProxies}
+	srv := &http.Server{
+		Addr:              appPort,
+		Handler:           requestLogger.Apply(realIP.Apply(handlers.CORS(headersOk, originsOk, methodsOk, credOk, exposedOk)(r))),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- srv.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
 
-	http.ListenAndServe(appPort, handlers.CORS(headersOk, originsOk, methodsOk, credOk)(r))
+	select {
+	case err := <-listenErr:
+		//* the server could not start, e.g. the port is taken
+		return err
+	case sig := <-stop:
+		slogger.Infof("Received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutting down: %v", err)
+	}
+	slogger.Info("Server stopped, waiting for background work to finish")
+	return nil
 }
 
 func hello(w http.ResponseWriter, r *http.Request) {
@@ -120,15 +290,177 @@ func hello(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "Hello Fellas")
 }
 
+// notFound answers requests for routes that do not exist
 func notFound(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
+	slogger.WithRequest(r.Context()).Warnf("Page %s does not exist", r.URL.Path)
+	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNotFound)
-	slogger.ServerError("Page does not exist")
-	fmt.Fprint(w, "Sorry, we couldn't get the page you requested")
+	util.Respond(w, util.Fail("fail", "Sorry, we couldn't get the page you requested"))
+}
+
+// rateLimitStore picks where rate limit buckets are kept from
+// RATE_LIMIT_STORE, or returns nil when rate limiting is disabled
+func rateLimitStore(cfg config.RateLimitConfig, services *models.Services) ratelimit.Store {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Store == "postgres" {
+		return ratelimit.NewPostgresStore(services.DB())
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// passwordPolicy builds the policy set with the PASSWORD_* variables
+func passwordPolicy(cfg config.PasswordConfig) (*models.PasswordPolicy, error) {
+	policy := &models.PasswordPolicy{
+		MinLength:        cfg.MinLength,
+		MaxLength:        cfg.MaxLength,
+		CharacterClasses: cfg.CharacterClasses,
+		RejectPersonal:   cfg.RejectPersonal,
+	}
+	if cfg.BreachedDir != "" {
+		list, err := breached.Open(cfg.BreachedDir)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = list
+	}
+	return policy, nil
+}
+
+// emailTransport picks how mail is delivered from EMAIL_TRANSPORT:
+// mailgun (the default), smtp or outbox
+func emailTransport(cfg config.EmailConfig) (email.ClientConfig, error) {
+	switch cfg.Transport {
+	case "mailgun":
+		return email.WithMailgun(cfg.MailgunDomain, cfg.MailgunAPIKey, cfg.MailgunPublicKey), nil
+	case "smtp":
+		return email.WithSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword), nil
+	case "outbox":
+		outbox, err := email.NewOutbox(cfg.OutboxDir)
+		if err != nil {
+			return nil, err
+		}
+		return email.WithOutbox(outbox), nil
+	default:
+		return nil, fmt.Errorf("EMAIL_TRANSPORT %q is not one of mailgun, smtp or outbox", cfg.Transport)
+	}
+}
+
+// emailTemplates loads the email templates from dir, falling back to
+// the built in ones
+func emailTemplates(dir string) (*email.Templates, error) {
+	if dir == "" {
+		return email.DefaultTemplates(), nil
+	}
+	return email.LoadTemplates(dir)
+}
+
+// previewEmails renders every email template with sample data
+// usage: go-book email:preview [-locale en]
+func previewEmails(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("email:preview", flag.ExitOnError)
+	locale := flags.String("locale", email.DefaultLocale, "locale to render the templates in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	templates, err := emailTemplates(cfg.Email.TemplatesDir)
+	if err != nil {
+		return err
+	}
+	emailer := email.NewClient(
+		email.WithBaseURL(cfg.BaseURL),
+		email.WithTemplates(templates),
+	)
+	return emailer.Preview(os.Stdout, *locale)
+}
+
+// runMigrations manages the database schema
+// usage: go-book migrate up [-n N] | down [-n N | -all] | status | create <name>
+func runMigrations(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up [-n N] | down [-n N | -all] | status | create <name>")
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	n := flags.Int("n", 0, "number of migrations to apply or roll back")
+	all := flags.Bool("all", false, "roll back every migration")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if args[0] == "create" {
+		if flags.NArg() != 1 {
+			return errors.New("usage: migrate create <name>")
+		}
+		up, down, err := migrate.Create(cfg.MigrationsDir, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\nCreated %s\n", up, down)
+		return nil
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	services, err := models.NewServices(cfg.DB.Driver, cfg.DB.ConnectionInfo(), models.ServicesConfig{
+		Pepper:  cfg.Pepper,
+		HMACKey: cfg.HMACKey,
+	})
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+	migrator := migrate.New(services.DB(), cfg.MigrationsDir)
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(*n)
+		for _, m := range done {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("Nothing to apply")
+		}
+		return err
+	case "down":
+		//* roll back one migration unless told otherwise
+		if *n == 0 && !*all {
+			*n = 1
+		}
+		done, err := migrator.Down(*n)
+		for _, m := range done {
+			fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Missing {
+				applied += " (file missing)"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
 }
 
-func must(err error) {
+// exitOnError prints err and exits instead of panicking, for problems
+// such as bad configuration that the operator has to fix
+func exitOnError(err error) {
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
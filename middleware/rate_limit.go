@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/ratelimit"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// Headers describing the rate limit of the route a request was sent to
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// RateLimit rejects requests once the client has used up its tokens
+// for a policy. Clients are told apart by API token, then by signed in
+// user and otherwise by IP address, so it should run after User, or
+// User.Identify when it wraps a whole router.
+type RateLimit struct {
+	// Store keeps the buckets. No requests are limited when it is nil.
+	Store ratelimit.Store
+	// Now tells the time, time.Now when nil
+	Now func() time.Time
+}
+
+// Apply limits next by policy
+func (rl *RateLimit) Apply(policy ratelimit.Policy, next http.Handler) http.HandlerFunc {
+	return rl.ApplyFn(policy, next.ServeHTTP)
+}
+
+// ApplyFn limits next by policy
+func (rl *RateLimit) ApplyFn(policy ratelimit.Policy, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.Store == nil {
+			next(w, r)
+			return
+		}
+
+		now := time.Now
+		if rl.Now != nil {
+			now = rl.Now
+		}
+		result, err := rl.Store.Take(policy.Name+":"+rateLimitKey(r), policy, now())
+		if err != nil {
+			//* let the request through rather than fail because the store is down
+			slogger.ServerError(r.Context(), err.Error())
+			next(w, r)
+			return
+		}
+
+		w.Header().Set(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+		w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		w.Header().Set(RateLimitResetHeader, strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			slogger.InvalidRequest(r.Context(), "Rate limit "+policy.Name+" exceeded")
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			util.Respond(w, util.Fail("fail", fmt.Sprintf("Too many requests, please try again in %ds", retryAfter)))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// rateLimitKey identifies who sent r
+func rateLimitKey(r *http.Request) string {
+	if token := context.APIToken(r.Context()); token != nil {
+		return "token:" + strconv.FormatUint(uint64(token.ID), 10)
+	}
+	if user := context.User(r.Context()); user != nil {
+		return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+	return "ip:" + util.ClientIP(r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
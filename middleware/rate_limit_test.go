@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sajicode/go-book/ratelimit"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	now := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	limitMw := RateLimit{
+		Store: ratelimit.NewMemoryStore(),
+		Now:   func() time.Time { return now },
+	}
+	policy := ratelimit.Policy{Name: "login", Limit: 2, Period: time.Minute}
+	handler := limitMw.ApplyFn(policy, func(w http.ResponseWriter, r *http.Request) {})
+	serve := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = "203.0.113.7:1234"
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		return rec
+	}
+
+	tests := []struct {
+		after      time.Duration
+		code       int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{0, http.StatusOK, "1", "30", ""},
+		{0, http.StatusOK, "0", "60", ""},
+		{0, http.StatusTooManyRequests, "0", "60", "30"},
+		//* a part of a second still to wait rounds up
+		{20*time.Second + 500*time.Millisecond, http.StatusTooManyRequests, "0", "40", "10"},
+		{10 * time.Second, http.StatusOK, "0", "60", ""},
+	}
+	for i, tt := range tests {
+		now = now.Add(tt.after)
+		rec := serve()
+		h := rec.Header()
+		if rec.Code != tt.code || h.Get(RateLimitLimitHeader) != "2" || h.Get(RateLimitRemainingHeader) != tt.remaining ||
+			h.Get(RateLimitResetHeader) != tt.reset || h.Get("Retry-After") != tt.retryAfter {
+			t.Errorf("request %d: status %d, headers %v, want %d with remaining %s, reset %s and Retry-After %q",
+				i+1, rec.Code, h, tt.code, tt.remaining, tt.reset, tt.retryAfter)
+		}
+	}
+}
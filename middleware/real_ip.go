@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP sets the RemoteAddr of requests that come through our own
+// reverse proxies to the address of the client, as the proxies report
+// it in X-Forwarded-For. Clients can put anything in that header, so it
+// is ignored on requests from anywhere else.
+type RealIP struct {
+	// TrustedProxies are the networks our proxies send requests from
+	TrustedProxies []*net.IPNet
+}
+
+// Apply wraps the whole app, so that everything after it sees the
+// client's address
+func (ri *RealIP) Apply(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(ri.TrustedProxies) > 0 {
+			r.RemoteAddr = ri.clientIP(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP walks X-Forwarded-For back from the proxy nearest to us.
+// Every proxy appends the address it got the request from, so the first
+// address we do not trust is the client and anything before it may
+// have been made up by them.
+func (ri *RealIP) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !ri.trusted(ip) {
+		return r.RemoteAddr
+	}
+
+	var hops []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		ip = hops[i]
+		if !ri.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func (ri *RealIP) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range ri.TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sajicode/go-book/context"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the request ID. An ID sent by a proxy in
+// front of the app is kept, otherwise a new one is assigned.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDRegex limits the IDs we accept from clients so that they
+// cannot write arbitrary text into the logs
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestLogger assigns every request an ID and logs a line for it
+// once it has been served
+type RequestLogger struct {
+	// Router is used to find the template of the route a request
+	// matched, e.g. /api/books/{id}, so requests can be grouped
+	Router *mux.Router
+}
+
+// Apply wraps the whole app, so it should be the outermost handler
+func (rl *RequestLogger) Apply(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDRegex.MatchString(id) {
+			id = newRequestID()
+		}
+		info := &context.RequestInfo{ID: id}
+		r = r.WithContext(context.WithRequest(r.Context(), info))
+		w.Header().Set(RequestIDHeader, id)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		fields := logrus.Fields{
+			"method":     r.Method,
+			"route":      rl.route(r),
+			"path":       r.URL.Path,
+			"status":     rec.status,
+			"bytes":      rec.bytes,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+		}
+		slogger.WithRequest(r.Context()).WithFields(fields).Info("request served")
+	})
+}
+
+// route returns the path template of the route r matches
+func (rl *RequestLogger) route(r *http.Request) string {
+	if rl.Router == nil {
+		return ""
+	}
+	var match mux.RouteMatch
+	if !rl.Router.Match(r, &match) || match.Route == nil {
+		return ""
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return template
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
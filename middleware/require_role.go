@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// RequireRole only lets through users holding at least Role
+type RequireRole struct {
+	Role models.Role
+}
+
+// Apply assumes that User middleware has already been run,
+// otherwise it will not work correctly
+func (mw *RequireRole) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn assumes that User middleware has already been run
+func (mw *RequireRole) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.User(r.Context())
+		if user == nil {
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			util.Respond(w, util.Fail("fail", "Unauthorized. Login to access this page"))
+			return
+		}
+		if !user.HasRole(mw.Role) {
+			slogger.InvalidRequest(r.Context(), "Forbidden request")
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			util.Respond(w, util.Fail("fail", "You do not have permission to access this page"))
+			return
+		}
+		next(w, r)
+	})
+}
@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/sajicode/go-book/context"
 	"github.com/sajicode/go-book/logger"
@@ -13,9 +15,33 @@ import (
 //* logger
 var slogger = logger.NewLogger()
 
-// User struct
+// User struct resolves the signed in user from their session cookie
+// or from a personal access token sent as a bearer token
 type User struct {
 	models.UserService
+	SessionService  models.SessionService
+	APITokenService models.APITokenService
+}
+
+// authError is why a request could not be authenticated, along with
+// the response to send
+type authError struct {
+	status  int
+	message string
+	err     error
+}
+
+// Identify resolves the signed in user like ApplyScopeFn but lets
+// every request through, signed in or not. It runs on the router so
+// that middleware before the routes, such as RateLimit, can tell users
+// apart. ApplyScopeFn then uses what it found.
+func (u *User) Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signedIn, aerr := u.authenticate(r); aerr == nil {
+			r = signedIn
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // Apply middleware takes http handler as arg and returns ApplyFn function
@@ -23,42 +49,116 @@ func (u *User) Apply(next http.Handler) http.HandlerFunc {
 	return u.ApplyFn(next.ServeHTTP)
 }
 
-// ApplyFn middleware to controller
+// ApplyFn middleware to controller. Only session cookies are accepted;
+// routes that personal access tokens may call use ApplyScopeFn instead.
 func (u *User) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return u.ApplyScopeFn("", next)
+}
 
-		cookie, err := r.Cookie("remember_token")
-		if err != nil {
-			slogger.InvalidRequest(err.Error())
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			util.Respond(w, util.Fail("fail", "Unauthorized. Login to access this page"))
-			return
-		}
-		cookieData, err := url.QueryUnescape(cookie.Value)
-		if err != nil {
-			slogger.InvalidRequest(err.Error())
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			util.Respond(w, util.Fail("fail", "Unauthorized. Login to access this page"))
-			return
+// ApplyScopeFn works like ApplyFn but also accepts personal access
+// tokens holding scope. Session cookies are granted every scope.
+func (u *User) ApplyScopeFn(scope models.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if context.User(r.Context()) == nil {
+			signedIn, aerr := u.authenticate(r)
+			if aerr != nil {
+				failAuth(w, r, aerr)
+				return
+			}
+			r = signedIn
 		}
-
-		user, err := u.UserService.ByRemember(cookieData)
-		if err != nil {
-			slogger.InvalidRequest(err.Error())
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			util.Respond(w, util.Fail("fail", "Unauthorized. Login to access this page"))
-			return
+		if token := context.APIToken(r.Context()); token != nil {
+			if scope == "" {
+				failAuth(w, r, &authError{http.StatusForbidden, "Personal access tokens cannot be used on this page",
+					errors.New("Personal access token used on a session only route")})
+				return
+			}
+			if !token.Scopes.Has(scope) {
+				failAuth(w, r, &authError{http.StatusForbidden, "Token does not have the " + string(scope) + " scope",
+					errors.New("Token is missing scope " + string(scope))})
+				return
+			}
 		}
-		ctx := r.Context()
-		ctx = context.WithUser(ctx, user)
-		r = r.WithContext(ctx)
 		next(w, r)
 	})
 }
 
+// authenticate looks up who sent r by their bearer token or session
+// cookie and returns r with them in its context
+func (u *User) authenticate(r *http.Request) (*http.Request, *authError) {
+	if r.Header.Get("Authorization") != "" {
+		return u.authenticateToken(r)
+	}
+
+	unauthorized := func(err error) *authError {
+		return &authError{http.StatusUnauthorized, "Unauthorized. Login to access this page", err}
+	}
+	cookie, err := r.Cookie("remember_token")
+	if err != nil {
+		return nil, unauthorized(err)
+	}
+	cookieData, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return nil, unauthorized(err)
+	}
+	session, err := u.SessionService.ByToken(cookieData)
+	if err != nil {
+		return nil, unauthorized(err)
+	}
+	user, err := u.UserService.ByID(session.UserID)
+	if err != nil {
+		return nil, unauthorized(err)
+	}
+	if user.Suspended() {
+		return nil, &authError{http.StatusForbidden, models.ErrAccountSuspended.Public(), models.ErrAccountSuspended}
+	}
+	if err := u.SessionService.Touch(session); err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+	}
+	ctx := r.Context()
+	ctx = context.WithUser(ctx, user)
+	ctx = context.WithSession(ctx, session)
+	return r.WithContext(ctx), nil
+}
+
+// authenticateToken looks up who sent r by their bearer token
+func (u *User) authenticateToken(r *http.Request) (*http.Request, *authError) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, &authError{http.StatusUnauthorized, "Unauthorized. Authorization header must be a bearer token",
+			errors.New("Malformed authorization header")}
+	}
+
+	invalid := func(err error) *authError {
+		return &authError{http.StatusUnauthorized, "Unauthorized. Token is not valid", err}
+	}
+	apiToken, err := u.APITokenService.ByToken(strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+	if err != nil {
+		return nil, invalid(err)
+	}
+	user, err := u.UserService.ByID(apiToken.UserID)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	if user.Suspended() {
+		return nil, &authError{http.StatusForbidden, models.ErrAccountSuspended.Public(), models.ErrAccountSuspended}
+	}
+	if err := u.APITokenService.Touch(apiToken); err != nil {
+		slogger.ServerError(r.Context(), err.Error())
+	}
+	ctx := r.Context()
+	ctx = context.WithUser(ctx, user)
+	ctx = context.WithAPIToken(ctx, apiToken)
+	return r.WithContext(ctx), nil
+}
+
+func failAuth(w http.ResponseWriter, r *http.Request, aerr *authError) {
+	slogger.InvalidRequest(r.Context(), aerr.err.Error())
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(aerr.status)
+	util.Respond(w, util.Fail("fail", aerr.message))
+}
+
 //TODO we might not need the functions below
 
 // RequireUser struct holds the fields required
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	"github.com/sajicode/go-book/ratelimit"
+)
+
+type fakeUsers struct {
+	models.UserService
+	users map[uint]*models.User
+}
+
+func (f *fakeUsers) ByID(id uint) (*models.User, error) {
+	if user, ok := f.users[id]; ok {
+		return user, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+type fakeSessions struct {
+	models.SessionService
+	sessions map[string]*models.Session
+	lookups  int
+}
+
+func (f *fakeSessions) ByToken(token string) (*models.Session, error) {
+	f.lookups++
+	if session, ok := f.sessions[token]; ok {
+		return session, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeSessions) Touch(session *models.Session) error { return nil }
+
+type fakeTokens struct {
+	models.APITokenService
+	tokens map[string]*models.APIToken
+}
+
+func (f *fakeTokens) ByToken(token string) (*models.APIToken, error) {
+	if apiToken, ok := f.tokens[token]; ok {
+		return apiToken, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeTokens) Touch(token *models.APIToken) error { return nil }
+
+func newTestUserMw() (*User, *fakeSessions) {
+	sessions := &fakeSessions{sessions: map[string]*models.Session{
+		"alice-session": {ID: 1, UserID: 1},
+		"bob-session":   {ID: 2, UserID: 2},
+	}}
+	return &User{
+		UserService: &fakeUsers{users: map[uint]*models.User{
+			1: {ID: 1, Email: "alice@example.com"},
+			2: {ID: 2, Email: "bob@example.com"},
+		}},
+		SessionService: sessions,
+		APITokenService: &fakeTokens{tokens: map[string]*models.APIToken{
+			"alice-token": {ID: 7, UserID: 1, Scopes: models.Scopes{models.ScopeBooksRead}},
+		}},
+	}, sessions
+}
+
+func newRequest(cookie, bearer string) *http.Request {
+	r := httptest.NewRequest("GET", "/api/books", nil)
+	r.RemoteAddr = "203.0.113.7:4000"
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: "remember_token", Value: cookie})
+	}
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return r
+}
+
+func TestIdentifyKeysRateLimitPerUser(t *testing.T) {
+	userMw, _ := newTestUserMw()
+	limitMw := RateLimit{Store: ratelimit.NewMemoryStore()}
+	policy := ratelimit.Policy{Name: "api", Limit: 1, Period: time.Minute}
+	handler := userMw.Identify(limitMw.Apply(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name   string
+		cookie string
+		bearer string
+		want   int
+	}{
+		{"alice", "alice-session", "", http.StatusOK},
+		{"bob from the same address", "bob-session", "", http.StatusOK},
+		{"alice again", "alice-session", "", http.StatusTooManyRequests},
+		{"alice's token has its own bucket", "", "alice-token", http.StatusOK},
+		{"signed out", "", "", http.StatusOK},
+		{"signed out again", "", "", http.StatusTooManyRequests},
+		{"a forged session counts against the address", "forged", "", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(tt.cookie, tt.bearer))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestApplyScopeFnReusesIdentify(t *testing.T) {
+	userMw, sessions := newTestUserMw()
+	var got *models.User
+	handler := userMw.Identify(userMw.ApplyFn(func(w http.ResponseWriter, r *http.Request) {
+		got = context.User(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("bob-session", ""))
+	if rec.Code != http.StatusOK || got == nil || got.ID != 2 {
+		t.Fatalf("status = %d, user = %v, want bob", rec.Code, got)
+	}
+	if sessions.lookups != 1 {
+		t.Errorf("session looked up %d times, want 1", sessions.lookups)
+	}
+}
+
+func TestApplyScopeFn(t *testing.T) {
+	userMw, _ := newTestUserMw()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		cookie  string
+		bearer  string
+		want    int
+	}{
+		{"session", userMw.ApplyFn(ok), "alice-session", "", http.StatusOK},
+		{"no credentials", userMw.ApplyFn(ok), "", "", http.StatusUnauthorized},
+		{"unknown session", userMw.ApplyFn(ok), "forged", "", http.StatusUnauthorized},
+		{"token on a session only route", userMw.ApplyFn(ok), "", "alice-token", http.StatusForbidden},
+		{"token with the scope", userMw.ApplyScopeFn(models.ScopeBooksRead, ok), "", "alice-token", http.StatusOK},
+		{"token without the scope", userMw.ApplyScopeFn(models.ScopeBooksWrite, ok), "", "alice-token", http.StatusForbidden},
+		{"identified token without the scope", userMw.Identify(userMw.ApplyScopeFn(models.ScopeBooksWrite, ok)), "", "alice-token", http.StatusForbidden},
+		{"identified token on a session only route", userMw.Identify(userMw.ApplyFn(ok)), "", "alice-token", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rec, newRequest(tt.cookie, tt.bearer))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/sajicode/go-book/context"
+	"github.com/sajicode/go-book/models"
+	util "github.com/sajicode/go-book/utils"
+)
+
+// RequireVerified only lets through users who have verified their
+// email address. It lets everyone through unless Enabled is set.
+type RequireVerified struct {
+	Enabled bool
+}
+
+// Apply assumes that User middleware has already been run,
+// otherwise it will not work correctly
+func (mw *RequireVerified) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn assumes that User middleware has already been run
+func (mw *RequireVerified) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !mw.Enabled {
+			next(w, r)
+			return
+		}
+		user := context.User(r.Context())
+		if user == nil {
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			util.Respond(w, util.Fail("fail", "Unauthorized. Login to access this page"))
+			return
+		}
+		if !user.EmailVerified {
+			slogger.InvalidRequest(r.Context(), models.ErrEmailNotVerified.Error())
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			util.Respond(w, util.Fail("fail", models.ErrEmailNotVerified.Public()))
+			return
+		}
+		next(w, r)
+	})
+}
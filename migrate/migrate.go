@@ -0,0 +1,350 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDir is where migration files are kept
+const DefaultDir = "migrations"
+
+// noTransaction marks a migration that must run outside a transaction,
+// e.g. one using CREATE INDEX CONCURRENTLY. It must be the first line.
+const noTransaction = "-- migrate:no-transaction"
+
+// lockID is the Postgres advisory lock held while migrating, so that
+// two deploys cannot migrate at once
+const lockID = 7343921
+
+var (
+	// ErrNoDown is returned when rolling back a migration without a
+	// down file
+	ErrNoDown = errors.New("migrate: migration has no down file")
+
+	fileRegex = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	nameRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Migration is one numbered schema change read from
+// <version>_<name>.up.sql and <version>_<name>.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, if it was
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	// Missing is set for migrations recorded as applied whose files
+	// are gone
+	Missing bool
+}
+
+// Migrator applies the migrations in a directory to a database
+type Migrator struct {
+	db  *sql.DB
+	dir string
+}
+
+// New creates a migrator for the files in dir
+func New(db *sql.DB, dir string) *Migrator {
+	return &Migrator{
+		db:  db,
+		dir: dir,
+	}
+}
+
+// Load reads the migrations in dir, ordered by version
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, file := range files {
+		match := fileRegex.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+		body, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migrate: %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Create writes empty up and down files for a new migration named
+// name, numbered after the last one in dir. It returns their paths.
+func Create(dir, name string) (string, string, error) {
+	if !nameRegex.MatchString(name) {
+		return "", "", fmt.Errorf("migrate: name %q must only hold lower case letters, digits and _", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var version int64 = 1
+	if n := len(migrations); n > 0 {
+		version = migrations[n-1].Version + 1
+	}
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	if err := ioutil.WriteFile(up, []byte("-- "+name+"\n"), 0644); err != nil {
+		return "", "", err
+	}
+	if err := ioutil.WriteFile(down, []byte("-- undo "+name+"\n"), 0644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
+
+// Status lists every migration, applied or not, by version
+func (m *Migrator) Status() ([]Status, error) {
+	migrations, err := Load(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ensureTable(m.db); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+	return merge(migrations, applied), nil
+}
+
+// merge lists migrations with when they were applied, followed by the
+// applied migrations whose files are gone, all ordered by version
+func merge(migrations []Migration, applied map[int64]Status) []Status {
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		status := Status{Migration: migration}
+		if s, ok := applied[migration.Version]; ok {
+			status.AppliedAt = s.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, s := range applied {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses
+}
+
+// Pending lists the migrations that have not been applied yet
+func (m *Migrator) Pending() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	return pending(statuses), nil
+}
+
+// pending picks the migrations that have not been applied from statuses
+func pending(statuses []Status) []Migration {
+	var migrations []Migration
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			migrations = append(migrations, s.Migration)
+		}
+	}
+	return migrations
+}
+
+// Up applies up to n pending migrations, oldest first, or all of them
+// when n is 0. It returns the migrations applied.
+func (m *Migrator) Up(n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(conn *sql.Conn) error {
+		pending, err := m.Pending()
+		if err != nil {
+			return err
+		}
+		if n > 0 && n < len(pending) {
+			pending = pending[:n]
+		}
+		for _, migration := range pending {
+			record := func(q querier) error {
+				_, err := q.ExecContext(context.Background(),
+					`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+					migration.Version, migration.Name)
+				return err
+			}
+			if err := run(conn, migration.Up, record); err != nil {
+				return fmt.Errorf("migrate: %d_%s up: %v", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back up to n applied migrations, newest first, or all of
+// them when n is 0. It returns the migrations rolled back.
+func (m *Migrator) Down(n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(conn *sql.Conn) error {
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		var applied []Status
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if statuses[i].AppliedAt != nil {
+				applied = append(applied, statuses[i])
+			}
+		}
+		if n > 0 && n < len(applied) {
+			applied = applied[:n]
+		}
+		for _, s := range applied {
+			migration := s.Migration
+			if s.Missing || strings.TrimSpace(migration.Down) == "" {
+				return fmt.Errorf("%v: %d_%s", ErrNoDown, migration.Version, migration.Name)
+			}
+			record := func(q querier) error {
+				_, err := q.ExecContext(context.Background(),
+					`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+				return err
+			}
+			if err := run(conn, migration.Down, record); err != nil {
+				return fmt.Errorf("migrate: %d_%s down: %v", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// querier is what both a connection and a transaction can run
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// run executes body and then record, both in one transaction unless
+// body opts out with noTransaction
+func run(conn *sql.Conn, body string, record func(querier) error) error {
+	ctx := context.Background()
+	if strings.HasPrefix(strings.TrimSpace(body), noTransaction) {
+		if _, err := conn.ExecContext(ctx, body); err != nil {
+			return err
+		}
+		return record(conn)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked runs fn on one connection holding the migration lock
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockID)
+
+	if err := m.ensureTable(conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) ensureTable(q querier) error {
+	_, err := q.ExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+// applied returns the migrations recorded in schema_migrations
+func (m *Migrator) applied(db *sql.DB) (map[int64]Status, error) {
+	rows, err := db.Query(`SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]Status{}
+	for rows.Next() {
+		var s Status
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		s.AppliedAt = &appliedAt
+		s.Missing = true
+		applied[s.Version] = s
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,177 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileRegex(t *testing.T) {
+	tests := []struct {
+		name  string
+		match bool
+	}{
+		{"0001_baseline.up.sql", true},
+		{"0012_add_index_2.down.sql", true},
+		{"1_short.up.sql", true},
+		{"0001_Baseline.up.sql", false},
+		{"0001-baseline.up.sql", false},
+		{"0001_baseline.sql", false},
+		{"0001_baseline.up.sql.bak", false},
+		{"baseline.up.sql", false},
+		{"0001_.up.sql", false},
+		{"README.md", false},
+	}
+	for _, tt := range tests {
+		if got := fileRegex.MatchString(tt.name); got != tt.match {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.match)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"0010_later.up.sql":     "CREATE TABLE later ();",
+		"0002_second.up.sql":    "CREATE TABLE second ();",
+		"0002_second.down.sql":  "DROP TABLE second;",
+		"0001_first.up.sql":     "CREATE TABLE first ();",
+		"0001_first.down.sql":   "DROP TABLE first;",
+		"README.md":             "not a migration",
+		"0003_draft.up.sql.bak": "ignored",
+	})
+
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.Name)
+	}
+	if strings.Join(got, ",") != "first,second,later" {
+		t.Fatalf("migrations = %v, want first, second and later in order", got)
+	}
+	if migrations[1].Version != 2 || migrations[1].Up != "CREATE TABLE second ();" || migrations[1].Down != "DROP TABLE second;" {
+		t.Errorf("second = %+v", migrations[1])
+	}
+	if migrations[2].Version != 10 || migrations[2].Down != "" {
+		t.Errorf("later = %+v, want version 10 without a down file", migrations[2])
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"version used twice", map[string]string{
+			"0001_first.up.sql": "SELECT 1;",
+			"0001_other.up.sql": "SELECT 1;",
+		}, "version 1 is used by both"},
+		{"down without up", map[string]string{
+			"0001_first.down.sql": "SELECT 1;",
+		}, "1_first has no up file"},
+		{"empty up", map[string]string{
+			"0001_first.up.sql": "  \n",
+		}, "1_first has no up file"},
+	}
+	for _, tt := range tests {
+		dir := tempDir(t)
+		writeFiles(t, dir, tt.files)
+		_, err := Load(dir)
+		os.RemoveAll(dir)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"", "Add Index", "add-index", "../escape"} {
+		if _, _, err := Create(dir, name); err == nil {
+			t.Errorf("name %q was accepted", name)
+		}
+	}
+
+	up, down, err := Create(dir, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0001_first.up.sql" || filepath.Base(down) != "0001_first.down.sql" {
+		t.Errorf("files = %s and %s, want 0001_first", up, down)
+	}
+	writeFiles(t, dir, map[string]string{"0007_jump.up.sql": "SELECT 1;"})
+	up, _, err = Create(dir, "add_index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0008_add_index.up.sql" {
+		t.Errorf("file = %s, want it numbered after the last migration", up)
+	}
+}
+
+func TestMergeAndPending(t *testing.T) {
+	applied := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+	migrations := []Migration{
+		{Version: 1, Name: "first"},
+		{Version: 2, Name: "second"},
+		{Version: 4, Name: "fourth"},
+	}
+	statuses := merge(migrations, map[int64]Status{
+		1: {Migration: Migration{Version: 1, Name: "first"}, AppliedAt: &applied, Missing: true},
+		3: {Migration: Migration{Version: 3, Name: "removed"}, AppliedAt: &applied, Missing: true},
+	})
+
+	want := []struct {
+		version int64
+		applied bool
+		missing bool
+	}{
+		{1, true, false},
+		{2, false, false},
+		{3, true, true},
+		{4, false, false},
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("statuses = %+v, want %d of them", statuses, len(want))
+	}
+	for i, w := range want {
+		s := statuses[i]
+		if s.Version != w.version || (s.AppliedAt != nil) != w.applied || s.Missing != w.missing {
+			t.Errorf("status %d = %+v, want version %d applied %v missing %v", i, s, w.version, w.applied, w.missing)
+		}
+	}
+
+	var names []string
+	for _, m := range pending(statuses) {
+		names = append(names, m.Name)
+	}
+	if strings.Join(names, ",") != "second,fourth" {
+		t.Errorf("pending = %v, want second and fourth", names)
+	}
+}
@@ -0,0 +1,192 @@
+-- The schema as it was created by gorm's AutoMigrate before migrations
+-- were introduced. Everything is created only if missing, so databases
+-- set up by AutoMigrate can adopt it. Those only have the users, books,
+-- reviews and pw_resets tables as they first were, so the columns added
+-- to them since are added here too when missing.
+
+CREATE TABLE IF NOT EXISTS users (
+	id serial,
+	avatar varchar(255) DEFAULT 'https://res.cloudinary.com/sajicode/image/upload/v1549973773/avatar.png',
+	first_name varchar(255) NOT NULL,
+	last_name varchar(255) NOT NULL,
+	email text NOT NULL,
+	email_verified boolean NOT NULL DEFAULT false,
+	locale varchar(16) NOT NULL DEFAULT 'en',
+	bio text DEFAULT NULL,
+	password_hash text NOT NULL,
+	remember_hash text NOT NULL,
+	role text NOT NULL DEFAULT 'reader',
+	notify_preference varchar(16) NOT NULL DEFAULT 'immediate',
+	suspended_at timestamp with time zone DEFAULT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+	deleted_at timestamp with time zone DEFAULT NULL,
+	PRIMARY KEY (id)
+);
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS locale varchar(16) NOT NULL DEFAULT 'en',
+	ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'reader',
+	ADD COLUMN IF NOT EXISTS notify_preference varchar(16) NOT NULL DEFAULT 'immediate',
+	ADD COLUMN IF NOT EXISTS suspended_at timestamp with time zone DEFAULT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uix_users_email ON users (email);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_users_remember_hash ON users (remember_hash);
+
+CREATE TABLE IF NOT EXISTS books (
+	id serial,
+	user_id integer,
+	title text,
+	author text,
+	category text,
+	summary text,
+	image text,
+	rating_average numeric NOT NULL DEFAULT 0,
+	rating_count integer NOT NULL DEFAULT 0,
+	rating_one integer NOT NULL DEFAULT 0,
+	rating_two integer NOT NULL DEFAULT 0,
+	rating_three integer NOT NULL DEFAULT 0,
+	rating_four integer NOT NULL DEFAULT 0,
+	rating_five integer NOT NULL DEFAULT 0,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+	deleted_at timestamp with time zone DEFAULT NULL,
+	PRIMARY KEY (id)
+);
+ALTER TABLE books
+	ADD COLUMN IF NOT EXISTS rating_average numeric NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS rating_one integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS rating_two integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS rating_three integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS rating_four integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS rating_five integer NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_books_user_id ON books (user_id);
+
+CREATE TABLE IF NOT EXISTS reviews (
+	id serial,
+	user_id integer,
+	book_id integer,
+	notes text,
+	rating integer NOT NULL DEFAULT 0,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+	deleted_at timestamp with time zone DEFAULT NULL,
+	edited_at timestamp with time zone DEFAULT NULL,
+	PRIMARY KEY (id)
+);
+ALTER TABLE reviews
+	ADD COLUMN IF NOT EXISTS rating integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS edited_at timestamp with time zone DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_reviews_user_id ON reviews (user_id);
+CREATE INDEX IF NOT EXISTS idx_reviews_book_id ON reviews (book_id);
+
+CREATE TABLE IF NOT EXISTS review_edits (
+	id serial,
+	review_id integer NOT NULL,
+	notes text NOT NULL,
+	rating integer NOT NULL DEFAULT 0,
+	edited_at timestamp with time zone NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_review_edits_review_id ON review_edits (review_id);
+
+CREATE TABLE IF NOT EXISTS pw_resets (
+	id serial,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	token_hash text NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_pw_resets_deleted_at ON pw_resets (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_pw_resets_token_hash ON pw_resets (token_hash);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+	id serial,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	email text NOT NULL,
+	token_hash text NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_deleted_at ON email_verifications (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_email_verifications_token_hash ON email_verifications (token_hash);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id serial,
+	user_id integer NOT NULL,
+	token_hash text NOT NULL,
+	user_agent varchar(512),
+	ip varchar(64),
+	created_at timestamp with time zone,
+	last_seen_at timestamp with time zone,
+	expires_at timestamp with time zone NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_sessions_token_hash ON sessions (token_hash);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id serial,
+	user_id integer NOT NULL,
+	name varchar(255) NOT NULL,
+	token_hash text NOT NULL,
+	scopes text NOT NULL,
+	last_used_at timestamp with time zone DEFAULT NULL,
+	expires_at timestamp with time zone DEFAULT NULL,
+	created_at timestamp with time zone,
+	revoked_at timestamp with time zone DEFAULT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_api_tokens_token_hash ON api_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id serial,
+	queue varchar(64) NOT NULL,
+	payload text NOT NULL,
+	status varchar(16) NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	max_attempts integer NOT NULL,
+	last_error text,
+	run_at timestamp with time zone NOT NULL,
+	locked_at timestamp with time zone DEFAULT NULL,
+	finished_at timestamp with time zone DEFAULT NULL,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_queue ON jobs (queue);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs (status);
+CREATE INDEX IF NOT EXISTS idx_jobs_run_at ON jobs (run_at);
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id serial,
+	user_id integer NOT NULL,
+	actor_id integer NOT NULL,
+	type varchar(32) NOT NULL,
+	book_id integer NOT NULL,
+	review_id integer,
+	message text NOT NULL,
+	read_at timestamp with time zone DEFAULT NULL,
+	emailed_at timestamp with time zone DEFAULT NULL,
+	created_at timestamp with time zone,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id);
+
+-- full-text search, see bookDocument and reviewDocument in models/search.go
+CREATE INDEX IF NOT EXISTS books_search_idx ON books USING GIN ((
+	setweight(to_tsvector('english', coalesce(books.title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(books.author, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(books.category, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(books.summary, '')), 'C')
+));
+CREATE INDEX IF NOT EXISTS reviews_search_idx ON reviews USING GIN ((
+	to_tsvector('english', coalesce(reviews.notes, ''))
+));
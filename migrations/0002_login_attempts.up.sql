@@ -0,0 +1,24 @@
+CREATE TABLE login_attempts (
+	id serial,
+	email varchar(255) NOT NULL,
+	ip varchar(64) NOT NULL,
+	success boolean NOT NULL DEFAULT false,
+	created_at timestamp with time zone NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX idx_login_attempts_email ON login_attempts (email);
+CREATE INDEX idx_login_attempts_ip ON login_attempts (ip);
+CREATE INDEX idx_login_attempts_created_at ON login_attempts (created_at);
+
+CREATE TABLE account_unlocks (
+	id serial,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	token_hash text NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX idx_account_unlocks_deleted_at ON account_unlocks (deleted_at);
+CREATE INDEX idx_account_unlocks_user_id ON account_unlocks (user_id);
+CREATE UNIQUE INDEX uix_account_unlocks_token_hash ON account_unlocks (token_hash);
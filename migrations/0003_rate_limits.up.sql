@@ -0,0 +1,8 @@
+CREATE TABLE rate_limits (
+	key text NOT NULL,
+	tokens double precision NOT NULL,
+	updated_at timestamp with time zone NOT NULL,
+	full_at timestamp with time zone NOT NULL,
+	PRIMARY KEY (key)
+);
+CREATE INDEX idx_rate_limits_full_at ON rate_limits (full_at);
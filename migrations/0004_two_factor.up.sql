@@ -0,0 +1,35 @@
+ALTER TABLE users ADD COLUMN two_factor_enabled boolean NOT NULL DEFAULT false;
+
+CREATE TABLE two_factors (
+	id serial,
+	user_id integer NOT NULL,
+	secret text NOT NULL,
+	confirmed_at timestamp with time zone,
+	last_step bigint NOT NULL DEFAULT 0,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX uix_two_factors_user_id ON two_factors (user_id);
+
+CREATE TABLE recovery_codes (
+	id serial,
+	user_id integer NOT NULL,
+	code_hash text NOT NULL,
+	used_at timestamp with time zone,
+	created_at timestamp with time zone,
+	PRIMARY KEY (id)
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+CREATE UNIQUE INDEX uix_recovery_codes_code_hash ON recovery_codes (code_hash);
+
+CREATE TABLE login_challenges (
+	id serial,
+	user_id integer NOT NULL,
+	token_hash text NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	created_at timestamp with time zone,
+	PRIMARY KEY (id)
+);
+CREATE INDEX idx_login_challenges_user_id ON login_challenges (user_id);
+CREATE UNIQUE INDEX uix_login_challenges_token_hash ON login_challenges (token_hash);
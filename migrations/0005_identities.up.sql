@@ -0,0 +1,12 @@
+CREATE TABLE identities (
+	id serial,
+	user_id integer NOT NULL,
+	provider varchar(64) NOT NULL,
+	subject varchar(255) NOT NULL,
+	email varchar(255),
+	created_at timestamp with time zone,
+	last_login_at timestamp with time zone,
+	PRIMARY KEY (id)
+);
+CREATE INDEX idx_identities_user_id ON identities (user_id);
+CREATE UNIQUE INDEX uix_identities_provider_subject ON identities (provider, subject);
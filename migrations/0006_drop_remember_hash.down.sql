@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN remember_hash text;
+UPDATE users SET remember_hash = md5(random()::text || id::text);
+ALTER TABLE users ALTER COLUMN remember_hash SET NOT NULL;
+CREATE UNIQUE INDEX uix_users_remember_hash ON users (remember_hash);
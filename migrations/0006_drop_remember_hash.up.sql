@@ -0,0 +1,4 @@
+-- Sessions replaced the remember token kept on users, so nothing reads
+-- or writes it any more
+DROP INDEX IF EXISTS uix_users_remember_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS remember_hash;
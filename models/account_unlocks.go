@@ -0,0 +1,161 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sajicode/go-book/hash"
+	"github.com/sajicode/go-book/rand"
+)
+
+// UnlockDuration is how long an unlock link stays valid
+const UnlockDuration = time.Hour
+
+// accountUnlock lets the owner of an account locked by failed logins
+// lift the lockout before it expires
+type accountUnlock struct {
+	gorm.Model
+	UserID    uint   `gorm:"not null;index"`
+	Token     string `gorm:"-"`
+	TokenHash string `gorm:"not null;unique_index"`
+}
+
+type accountUnlockDB interface {
+	ByToken(token string) (*accountUnlock, error)
+	Create(au *accountUnlock) error
+	DeleteByUserID(userID uint) error
+}
+
+func newAccountUnlockValidator(db accountUnlockDB, hmac hash.HMAC) *accountUnlockValidator {
+	return &accountUnlockValidator{
+		accountUnlockDB: db,
+		hmac:            hmac,
+	}
+}
+
+type accountUnlockValidator struct {
+	accountUnlockDB
+	hmac hash.HMAC
+}
+
+func (auv *accountUnlockValidator) ByToken(token string) (*accountUnlock, error) {
+	au := accountUnlock{Token: token}
+	err := runAccountUnlockValFns(&au, auv.requireToken, auv.hmacToken)
+	if err != nil {
+		return nil, err
+	}
+	return auv.accountUnlockDB.ByToken(au.TokenHash)
+}
+
+func (auv *accountUnlockValidator) Create(au *accountUnlock) error {
+	err := runAccountUnlockValFns(au,
+		auv.requireUserID,
+		auv.setTokenIfUnset,
+		auv.hmacToken,
+	)
+	if err != nil {
+		return err
+	}
+	return auv.accountUnlockDB.Create(au)
+}
+
+type accountUnlockGorm struct {
+	db *gorm.DB
+}
+
+func (aug *accountUnlockGorm) ByToken(tokenHash string) (*accountUnlock, error) {
+	var au accountUnlock
+	err := first(aug.db.Where("token_hash = ?", tokenHash), &au)
+	if err != nil {
+		return nil, err
+	}
+	return &au, nil
+}
+
+func (aug *accountUnlockGorm) Create(au *accountUnlock) error {
+	return aug.db.Create(au).Error
+}
+
+func (aug *accountUnlockGorm) DeleteByUserID(userID uint) error {
+	return aug.db.Where("user_id = ?", userID).Delete(&accountUnlock{}).Error
+}
+
+func (auv *accountUnlockValidator) requireUserID(au *accountUnlock) error {
+	if au.UserID <= 0 {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+func (auv *accountUnlockValidator) requireToken(au *accountUnlock) error {
+	if au.Token == "" {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func (auv *accountUnlockValidator) setTokenIfUnset(au *accountUnlock) error {
+	if au.Token != "" {
+		return nil
+	}
+	token, err := rand.RememberToken()
+	if err != nil {
+		return err
+	}
+	au.Token = token
+	return nil
+}
+
+func (auv *accountUnlockValidator) hmacToken(au *accountUnlock) error {
+	if au.Token == "" {
+		return nil
+	}
+	au.TokenHash = auv.hmac.Hash(au.Token)
+	return nil
+}
+
+type accountUnlockValFn func(*accountUnlock) error
+
+func runAccountUnlockValFns(au *accountUnlock, fns ...accountUnlockValFn) error {
+	for _, fn := range fns {
+		if err := fn(au); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitiateUnlock creates a token that lifts the login lockout on user
+func (us *userService) InitiateUnlock(user *User) (string, error) {
+	au := accountUnlock{UserID: user.ID}
+	if err := us.accountUnlockDB.Create(&au); err != nil {
+		return "", err
+	}
+	return au.Token, nil
+}
+
+// CompleteUnlock forgets the failed logins of the user the token was
+// sent to, so that they can log in again straight away
+func (us *userService) CompleteUnlock(token string) (*User, error) {
+	au, err := us.accountUnlockDB.ByToken(token)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, ErrTokenInvalid
+		}
+		return nil, err
+	}
+	if time.Since(au.CreatedAt) > UnlockDuration {
+		return nil, ErrTokenInvalid
+	}
+	user, err := us.ByID(au.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := us.loginAttemptDB.ClearFailures(user.Email); err != nil {
+		return nil, err
+	}
+	if err := us.accountUnlockDB.DeleteByUserID(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,302 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sajicode/go-book/hash"
+	"github.com/sajicode/go-book/rand"
+)
+
+// apiTokenPrefix marks personal access tokens so they are easy to
+// recognise, e.g. by secret scanners
+const apiTokenPrefix = "gb_"
+
+// Scope is a permission granted to a personal access token
+type Scope string
+
+// The scopes a personal access token can hold
+const (
+	ScopeBooksRead    Scope = "books:read"
+	ScopeBooksWrite   Scope = "books:write"
+	ScopeReviewsRead  Scope = "reviews:read"
+	ScopeReviewsWrite Scope = "reviews:write"
+	ScopeUsersRead    Scope = "users:read"
+	ScopeUsersWrite   Scope = "users:write"
+)
+
+// validScopes holds every scope a token may be granted
+var validScopes = map[Scope]bool{
+	ScopeBooksRead:    true,
+	ScopeBooksWrite:   true,
+	ScopeReviewsRead:  true,
+	ScopeReviewsWrite: true,
+	ScopeUsersRead:    true,
+	ScopeUsersWrite:   true,
+}
+
+// Scopes is a set of scopes stored as a space separated column
+type Scopes []Scope
+
+// Has reports whether scope is one of the scopes
+func (s Scopes) Has(scope Scope) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Value stores the scopes as a space separated string
+func (s Scopes) Value() (driver.Value, error) {
+	parts := make([]string, len(s))
+	for i, scope := range s {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// Scan reads scopes stored by Value
+func (s *Scopes) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	case nil:
+		raw = ""
+	default:
+		return ErrScopeInvalid
+	}
+	*s = nil
+	for _, part := range strings.Fields(raw) {
+		*s = append(*s, Scope(part))
+	}
+	return nil
+}
+
+// MarshalJSON keeps the scopes a list even when empty
+func (s Scopes) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Scope(s))
+}
+
+// APIToken is a personal access token that lets scripts and apps act
+// on behalf of a user through an Authorization: Bearer header. Like
+// sessions, only the HMAC of the token is stored.
+type APIToken struct {
+	ID         uint       `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"size:255;not null" json:"name"`
+	Token      string     `gorm:"-" json:"token,omitempty"`
+	TokenHash  string     `gorm:"not null;unique_index" json:"-"`
+	Scopes     Scopes     `gorm:"type:text;not null" json:"scopes"`
+	LastUsedAt *time.Time `gorm:"default:NULL" json:"last_used_at"`
+	ExpiresAt  *time.Time `gorm:"default:NULL" json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `gorm:"default:NULL" json:"-"`
+}
+
+// APITokenDB is used to interact with the api_tokens table
+type APITokenDB interface {
+	// ByToken looks up an active token by its raw value
+	ByToken(token string) (*APIToken, error)
+	ByUserID(userID uint) ([]APIToken, error)
+	Create(token *APIToken) error
+	// Touch records that the token was just used
+	Touch(token *APIToken) error
+	// Revoke disables the token with the given ID if it belongs
+	// to the user
+	Revoke(id, userID uint) error
+}
+
+// APITokenService is a set of methods used to work with personal
+// access tokens
+type APITokenService interface {
+	APITokenDB
+}
+
+// NewAPITokenService handles connection to the DB
+func NewAPITokenService(db *gorm.DB, hmacKey string) APITokenService {
+	return &apiTokenService{
+		APITokenDB: newAPITokenValidator(&apiTokenGorm{db}, hash.NewHMAC(hmacKey)),
+	}
+}
+
+type apiTokenService struct {
+	APITokenDB
+}
+
+func newAPITokenValidator(db APITokenDB, hmac hash.HMAC) *apiTokenValidator {
+	return &apiTokenValidator{
+		APITokenDB: db,
+		hmac:       hmac,
+	}
+}
+
+type apiTokenValidator struct {
+	APITokenDB
+	hmac hash.HMAC
+}
+
+func (atv *apiTokenValidator) ByToken(token string) (*APIToken, error) {
+	apiToken := APIToken{Token: token}
+	err := runAPITokenValFns(&apiToken, atv.requirePrefix, atv.hmacToken)
+	if err != nil {
+		return nil, err
+	}
+	return atv.APITokenDB.ByToken(apiToken.TokenHash)
+}
+
+func (atv *apiTokenValidator) Create(token *APIToken) error {
+	err := runAPITokenValFns(token,
+		atv.requireUserID,
+		atv.requireName,
+		atv.scopesValid,
+		atv.setToken,
+		atv.hmacToken,
+	)
+	if err != nil {
+		return err
+	}
+	return atv.APITokenDB.Create(token)
+}
+
+func (atv *apiTokenValidator) Touch(token *APIToken) error {
+	if token.LastUsedAt != nil && time.Since(*token.LastUsedAt) < sessionTouchInterval {
+		return nil
+	}
+	return atv.APITokenDB.Touch(token)
+}
+
+func (atv *apiTokenValidator) Revoke(id, userID uint) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	if userID <= 0 {
+		return ErrUserIDRequired
+	}
+	return atv.APITokenDB.Revoke(id, userID)
+}
+
+func (atv *apiTokenValidator) requireUserID(t *APIToken) error {
+	if t.UserID <= 0 {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+func (atv *apiTokenValidator) requireName(t *APIToken) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return ErrTokenNameRequired
+	}
+	return nil
+}
+
+func (atv *apiTokenValidator) scopesValid(t *APIToken) error {
+	if len(t.Scopes) == 0 {
+		return ErrScopeRequired
+	}
+	for _, scope := range t.Scopes {
+		if !validScopes[scope] {
+			return ErrScopeInvalid
+		}
+	}
+	return nil
+}
+
+// setToken always generates the token; callers cannot choose it
+func (atv *apiTokenValidator) setToken(t *APIToken) error {
+	token, err := rand.RememberToken()
+	if err != nil {
+		return err
+	}
+	t.Token = apiTokenPrefix + token
+	return nil
+}
+
+func (atv *apiTokenValidator) requirePrefix(t *APIToken) error {
+	if !strings.HasPrefix(t.Token, apiTokenPrefix) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (atv *apiTokenValidator) hmacToken(t *APIToken) error {
+	if t.Token == "" {
+		return nil
+	}
+	t.TokenHash = atv.hmac.Hash(t.Token)
+	return nil
+}
+
+type apiTokenValFn func(*APIToken) error
+
+func runAPITokenValFns(t *APIToken, fns ...apiTokenValFn) error {
+	for _, fn := range fns {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ APITokenDB = &apiTokenGorm{}
+
+type apiTokenGorm struct {
+	db *gorm.DB
+}
+
+// active limits a query to tokens that are neither revoked nor expired
+func (atg *apiTokenGorm) active() *gorm.DB {
+	return atg.db.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+}
+
+func (atg *apiTokenGorm) ByToken(tokenHash string) (*APIToken, error) {
+	var token APIToken
+	err := first(atg.active().Where("token_hash = ?", tokenHash), &token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (atg *apiTokenGorm) ByUserID(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	err := atg.active().Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (atg *apiTokenGorm) Create(token *APIToken) error {
+	return atg.db.Create(token).Error
+}
+
+func (atg *apiTokenGorm) Touch(token *APIToken) error {
+	now := time.Now()
+	token.LastUsedAt = &now
+	return atg.db.Model(token).UpdateColumn("last_used_at", now).Error
+}
+
+func (atg *apiTokenGorm) Revoke(id, userID uint) error {
+	res := atg.db.Model(&APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		UpdateColumn("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
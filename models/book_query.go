@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// BookSort is the order in which a book listing is returned
+type BookSort string
+
+// The sort orders supported by BookDB.Query
+const (
+	SortNewest       BookSort = "newest"
+	SortOldest       BookSort = "oldest"
+	SortTitle        BookSort = "title"
+	SortMostReviewed BookSort = "most-reviewed"
+	SortHighestRated BookSort = "highest-rated"
+)
+
+// bookSortOrders maps each sort to its ORDER BY clauses. Every order
+// ends on the primary key so pages are stable when values tie.
+var bookSortOrders = map[BookSort][]string{
+	SortNewest: {"books.created_at DESC", "books.id DESC"},
+	SortOldest: {"books.created_at ASC", "books.id ASC"},
+	SortTitle:  {"LOWER(books.title) ASC", "books.id ASC"},
+	SortMostReviewed: {
+		"(SELECT COUNT(*) FROM reviews WHERE reviews.book_id = books.id AND reviews.deleted_at IS NULL) DESC",
+		"books.id DESC",
+	},
+	SortHighestRated: {"books.rating_average DESC", "books.rating_count DESC", "books.id DESC"},
+}
+
+// BookQuery holds the filters, sort order and page of a book listing.
+// Zero values mean the filter is not applied. Cursor pagination is only
+// available for the newest and oldest sorts.
+type BookQuery struct {
+	Pagination
+	Category      string
+	Author        string
+	UserID        uint
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Sort          BookSort
+}
+
+// keyset reports whether the sort follows the (created_at, id) order
+// that cursor pagination is keyed on
+func (s BookSort) keyset() bool {
+	return s == SortNewest || s == SortOldest
+}
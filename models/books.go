@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -10,16 +11,17 @@ import (
 type Book struct {
 	ID        uint       `gorm:"primary_key;auto_increment" json:"id"`
 	UserID    uint       `gorm:"not_null;index;auto_preload" json:"user_id"`
-	Title     string     `gorm:"not_null"json:"title"`
-	Author    string     `gorm:"not_null"json:"author"`
-	Category  string     `gorm:"not_null"json:"category"`
-	Summary   string     `gorm:"not_null"json:"summary"`
-	Image     string     `gorm:"not_null"json:"image"`
+	Title     string     `gorm:"not_null" json:"title"`
+	Author    string     `gorm:"not_null" json:"author"`
+	Category  string     `gorm:"not_null" json:"category"`
+	Summary   string     `gorm:"not_null" json:"summary"`
+	Image     string     `gorm:"not_null" json:"image"`
+	Rating    BookRating `gorm:"embedded;embedded_prefix:rating_" json:"rating"`
 	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 	DeletedAt *time.Time `gorm:"default:NULL" json:"deleted_at"`
 	Reviews   []Review   `gorm:"-" json:"reviews"`
-	User      User       `gorm:"ForeignKey:user_id"json:"user"`
+	User      User       `gorm:"ForeignKey:user_id" json:"user"`
 }
 
 // BookDB interface
@@ -28,24 +30,53 @@ type BookDB interface {
 	Create(book *Book) (*Book, error)
 	Update(book *Book) (*Book, error)
 	Delete(id uint) error
+	DeletedByID(id uint) (*Book, error)
+	Restore(id uint) error
 	ByUserID(id uint) ([]Book, error)
-	AllBooks(limit, page int) ([]Book, error)
+	AllBooks(p Pagination) ([]Book, *PageInfo, error)
+	// Query returns the books matching the filters of the query
+	// in the requested sort order.
+	Query(q BookQuery) ([]Book, *PageInfo, error)
 }
 
 // NewBookService tells the DB to create a new Book
 func NewBookService(db *gorm.DB) BookService {
 	return &bookService{
-		BookDB: &bookValidator{&bookGorm{db}},
+		BookDB:   &bookValidator{&bookGorm{db}},
+		searcher: newBookSearcher(db),
 	}
 }
 
 // BookService interface
 type BookService interface {
 	BookDB
+	// Search returns the books whose title, author, summary or
+	// category (and optionally review notes) match the query,
+	// ordered by relevance, a page at a time.
+	Search(s BookSearch) ([]Book, *PageInfo, error)
 }
 
 type bookService struct {
 	BookDB
+	searcher bookSearcher
+}
+
+// Search validates the search parameters and runs the search
+func (bs *bookService) Search(s BookSearch) ([]Book, *PageInfo, error) {
+	s.Query = strings.TrimSpace(s.Query)
+	if s.Query == "" {
+		return nil, nil, ErrSearchQueryRequired
+	}
+	p := Pagination{Limit: s.Limit, Page: s.Page}
+	if err := p.normalize(); err != nil {
+		return nil, nil, err
+	}
+	s.Limit, s.Page = p.Limit, p.Page
+	books, total, err := bs.searcher.Search(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return books, &PageInfo{Total: total, Limit: s.Limit, Page: s.Page}, nil
 }
 
 type bookValidationFunc func(*Book) error
@@ -107,6 +138,42 @@ func (bv *bookValidator) Delete(id uint) error {
 	return bv.BookDB.Delete(id)
 }
 
+// Restore validator for restoring a deleted book
+func (bv *bookValidator) Restore(id uint) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	return bv.BookDB.Restore(id)
+}
+
+// AllBooks validator for paging through books
+func (bv *bookValidator) AllBooks(p Pagination) ([]Book, *PageInfo, error) {
+	if err := p.normalize(); err != nil {
+		return nil, nil, err
+	}
+	return bv.BookDB.AllBooks(p)
+}
+
+// Query validator for filtering and sorting books
+func (bv *bookValidator) Query(q BookQuery) ([]Book, *PageInfo, error) {
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+	if _, ok := bookSortOrders[q.Sort]; !ok {
+		return nil, nil, ErrSortInvalid
+	}
+	if err := q.Pagination.normalize(); err != nil {
+		return nil, nil, err
+	}
+	if q.usesCursor() && !q.Sort.keyset() {
+		return nil, nil, ErrCursorSortInvalid
+	}
+	if !q.CreatedAfter.IsZero() && !q.CreatedBefore.IsZero() && q.CreatedBefore.Before(q.CreatedAfter) {
+		return nil, nil, ErrDateRangeInvalid
+	}
+	return bv.BookDB.Query(q)
+}
+
 // userIDRequired makes sure a userid is available while creating a book
 func (bv *bookValidator) userIDRequired(b *Book) error {
 	if b.UserID <= 0 {
@@ -179,19 +246,62 @@ func (bg *bookGorm) Create(book *Book) (*Book, error) {
 	return book, nil
 }
 
-// Update func updates a book in the DB
+// Update func updates a book in the DB. The rating columns are
+// maintained from reviews, so they are never written here.
 func (bg *bookGorm) Update(book *Book) (*Book, error) {
-	err := bg.db.Save(&book).Error
+	err := bg.db.Omit(bookRatingColumns...).Save(&book).Error
 	if err != nil {
 		return nil, err
 	}
 	return book, nil
 }
 
-// Delete will delete the book with the provided ID
+// Delete soft-deletes the book with the provided ID along with its
+// reviews. Both share the same deletion time so that Restore can tell
+// the cascaded reviews apart from ones deleted earlier.
 func (bg *bookGorm) Delete(id uint) error {
-	book := Book{ID: id}
-	return bg.db.Delete(&book).Error
+	now := gorm.NowFunc()
+	return transaction(bg.db, func(tx *gorm.DB) error {
+		res := tx.Model(&Book{}).Where("id = ?", id).UpdateColumn("deleted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Model(&Review{}).Where("book_id = ?", id).UpdateColumn("deleted_at", now).Error
+	})
+}
+
+// DeletedByID gets a soft-deleted book by it's ID
+func (bg *bookGorm) DeletedByID(id uint) (*Book, error) {
+	var book Book
+	err := first(bg.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id), &book)
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// Restore brings back a deleted book and the reviews that were
+// deleted along with it, as long as it is within RestoreWindow
+func (bg *bookGorm) Restore(id uint) error {
+	book, err := bg.DeletedByID(id)
+	if err != nil {
+		return err
+	}
+	if err := restorable(book.DeletedAt); err != nil {
+		return err
+	}
+	return transaction(bg.db, func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&Book{}).Where("id = ?", id).UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&Review{}).
+			Where("book_id = ? AND deleted_at = ?", id, *book.DeletedAt).
+			UpdateColumn("deleted_at", nil).Error
+	})
 }
 
 // ByUserID fetches all books by a user
@@ -204,13 +314,68 @@ func (bg *bookGorm) ByUserID(userID uint) ([]Book, error) {
 	return books, nil
 }
 
-// AllBooks returns all books in the DB based on pagination
-func (bg *bookGorm) AllBooks(limit, page int) ([]Book, error) {
-	dataOffset := (limit * page) - limit
+// AllBooks returns a page of books, newest first
+func (bg *bookGorm) AllBooks(p Pagination) ([]Book, *PageInfo, error) {
+	return bg.Query(BookQuery{Pagination: p, Sort: SortNewest})
+}
+
+// Query returns books filtered and sorted in SQL according to the query,
+// along with the total number of matching books
+func (bg *bookGorm) Query(q BookQuery) ([]Book, *PageInfo, error) {
+	db := bg.db.Model(&Book{})
+	if q.Category != "" {
+		db = db.Where("LOWER(books.category) = LOWER(?)", q.Category)
+	}
+	if q.Author != "" {
+		db = db.Where("LOWER(books.author) = LOWER(?)", q.Author)
+	}
+	if q.UserID > 0 {
+		db = db.Where("books.user_id = ?", q.UserID)
+	}
+	if !q.CreatedAfter.IsZero() {
+		db = db.Where("books.created_at >= ?", q.CreatedAfter)
+	}
+	if !q.CreatedBefore.IsZero() {
+		db = db.Where("books.created_at < ?", q.CreatedBefore)
+	}
+
+	var total int
+	if err := db.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if q.Sort.keyset() {
+		paged, err := pageQuery(db, "books", q.Sort == SortNewest, q.Pagination)
+		if err != nil {
+			return nil, nil, err
+		}
+		db = paged
+	} else {
+		for _, order := range bookSortOrders[q.Sort] {
+			db = db.Order(order)
+		}
+		db = db.Offset(offset(q.Limit, q.Page)).Limit(q.Limit + 1)
+	}
+
 	var books []Book
-	err := bg.db.Preload("User").Limit(limit).Offset(dataOffset).Order("created_at DESC", true).Find(&books).Error
-	if err != nil {
-		return nil, err
+	if err := db.Preload("User").Find(&books).Error; err != nil {
+		return nil, nil, err
 	}
-	return books, nil
+
+	keys := make([]cursor, len(books))
+	for i, book := range books {
+		keys[i] = cursor{CreatedAt: book.CreatedAt, ID: book.ID}
+	}
+	info, n := newPageInfo(q.Pagination, total, keys)
+	books = books[:n]
+	if q.Before != "" {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			books[i], books[j] = books[j], books[i]
+		}
+	}
+	if !q.Sort.keyset() {
+		// cursors only make sense for the (created_at, id) orders
+		info.NextCursor, info.PrevCursor = "", ""
+	}
+	return books, info, nil
 }
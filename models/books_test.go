@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+// recordingSearcher remembers the search it was asked to run
+type recordingSearcher struct {
+	got BookSearch
+}
+
+func (rs *recordingSearcher) Search(s BookSearch) ([]Book, int, error) {
+	rs.got = s
+	return []Book{{ID: 1}}, 250, nil
+}
+
+func TestSearchPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		search    BookSearch
+		wantLimit int
+		wantPage  int
+	}{
+		{"defaults", BookSearch{Query: "dune"}, DefaultPageLimit, 1},
+		{"clamps the limit", BookSearch{Query: "dune", Limit: 10000, Page: 3}, MaxPageLimit, 3},
+		{"keeps a valid limit", BookSearch{Query: "dune", Limit: 5, Page: 2}, 5, 2},
+	}
+	for _, tt := range tests {
+		searcher := &recordingSearcher{}
+		bs := &bookService{searcher: searcher}
+		_, page, err := bs.Search(tt.search)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if searcher.got.Limit != tt.wantLimit || searcher.got.Page != tt.wantPage {
+			t.Errorf("%s: searched with limit %d page %d, want %d and %d", tt.name, searcher.got.Limit, searcher.got.Page, tt.wantLimit, tt.wantPage)
+		}
+		if page.Total != 250 || page.Limit != tt.wantLimit || page.Page != tt.wantPage {
+			t.Errorf("%s: page = %+v", tt.name, page)
+		}
+	}
+
+	if _, _, err := (&bookService{}).Search(BookSearch{Query: "  "}); err != ErrSearchQueryRequired {
+		t.Errorf("blank query: err = %v, want ErrSearchQueryRequired", err)
+	}
+}
@@ -13,6 +13,10 @@ const (
 	// ErrPasswordIncorrect is used when attempting to authenticate a user.
 	ErrPasswordIncorrect modelError = "incorrect password provided"
 
+	// ErrLoginFailed is returned by Login for both an unknown email and
+	// a wrong password, so that it cannot be used to find accounts
+	ErrLoginFailed modelError = "incorrect email or password"
+
 	// ErrEmailRequired is returned when an email address is
 	// not provided when creating a user
 	ErrEmailRequired modelError = "email address is required"
@@ -25,13 +29,37 @@ const (
 	// with an email address that is already in use.
 	ErrEmailTaken modelError = "email address is already taken"
 
+	// ErrEmailDeleted is returned when an update or create is attempted
+	// with the email address of a deleted account, which can still be
+	// restored and so keeps its address.
+	ErrEmailDeleted modelError = "email address belongs to a deleted account, which can be restored instead"
+
 	// ErrPasswordRequired is returned when a create is attempted
 	// without a user password provided.
 	ErrPasswordRequired modelError = "password is required"
 
-	// ErrPasswordTooShort is returned when an update or create is
-	// attempted with a user password that is less than 8 characters.
-	ErrPasswordTooShort modelError = "password must be at least 8 characters long"
+	// ErrEmailAlreadyVerified is returned when verification is requested
+	// for an email address that has already been verified
+	ErrEmailAlreadyVerified modelError = "email address is already verified"
+
+	// ErrEmailNotVerified is returned when an action requires a verified email address
+	ErrEmailNotVerified modelError = "please verify your email address first"
+
+	// ErrVerificationThrottled is returned when verification emails are
+	// requested more often than VerificationResendInterval allows
+	ErrVerificationThrottled modelError = "a verification email was sent recently, please wait a minute and try again"
+
+	// ErrLocaleInvalid is returned when a user's locale is not a language tag
+	ErrLocaleInvalid modelError = "locale must be a language code such as en or pt-br"
+
+	// ErrNotifyPreferenceInvalid is returned when a user picks an unknown notification preference
+	ErrNotifyPreferenceInvalid modelError = "notification preference must be one of immediate, digest or off"
+
+	// ErrRoleInvalid is returned when a user is given a role that does not exist
+	ErrRoleInvalid modelError = "role must be one of reader, moderator or admin"
+
+	// ErrAccountSuspended is returned when a suspended user attempts to sign in
+	ErrAccountSuspended modelError = "account has been suspended"
 
 	// ErrTitleRequired is returned when a title is not added to a book
 	ErrTitleRequired modelError = "book title is required"
@@ -48,18 +76,70 @@ const (
 	// ErrBookImageRequired is returned when an image is not added to a book
 	ErrBookImageRequired modelError = "book image is required"
 
+	// ErrRatingInvalid is returned when a review rating is not between 1 and 5
+	ErrRatingInvalid modelError = "rating must be between 1 and 5 stars"
+
+	// ErrSearchQueryRequired is returned when a search is attempted without a query
+	ErrSearchQueryRequired modelError = "search query is required"
+
+	// ErrSortInvalid is returned when books are requested in an unknown sort order
+	ErrSortInvalid modelError = "sort must be one of newest, oldest, title, most-reviewed or highest-rated"
+
+	// ErrDateRangeInvalid is returned when a date range ends before it starts
+	ErrDateRangeInvalid modelError = "date range is not valid"
+
+	// ErrCursorInvalid is returned when a pagination cursor cannot be decoded
+	// or both a before and an after cursor are given
+	ErrCursorInvalid modelError = "pagination cursor is not valid"
+
+	// ErrCursorSortInvalid is returned when a cursor is used with a sort
+	// that is not ordered by creation date
+	ErrCursorSortInvalid modelError = "cursor pagination is only supported for the newest and oldest sorts"
+
+	// ErrRestoreExpired is returned when a deleted resource is restored
+	// after RestoreWindow has passed
+	ErrRestoreExpired modelError = "restore window has expired"
+
+	// ErrTokenNameRequired is returned when a personal access token is created without a name
+	ErrTokenNameRequired modelError = "token name is required"
+
+	// ErrScopeRequired is returned when a personal access token is created without scopes
+	ErrScopeRequired modelError = "at least one scope is required"
+
+	// ErrScopeInvalid is returned when a personal access token is given a scope that does not exist
+	ErrScopeInvalid modelError = "scope must be one of books:read, books:write, reviews:read, reviews:write, users:read or users:write"
+
+	// ErrJobStatusInvalid is returned when jobs are filtered by a status that does not exist
+	ErrJobStatusInvalid modelError = "status must be one of pending, running, done or dead"
+
+	// ErrTwoFactorEnabled is returned when enrolling in two-factor
+	// authentication while it is already on
+	ErrTwoFactorEnabled modelError = "two-factor authentication is already enabled"
+
+	// ErrTwoFactorNotEnabled is returned when turning off two-factor
+	// authentication, or using it, while it is off
+	ErrTwoFactorNotEnabled modelError = "two-factor authentication is not enabled"
+
+	// ErrTwoFactorNotEnrolled is returned when confirming two-factor
+	// authentication before enrolling
+	ErrTwoFactorNotEnrolled modelError = "two-factor authentication has not been set up, please enroll first"
+
+	// ErrTwoFactorCodeInvalid is returned when a two-factor or recovery
+	// code is wrong, expired or already used
+	ErrTwoFactorCodeInvalid modelError = "two-factor code is not valid"
+
+	// ErrChallengeInvalid is returned when the second login step is
+	// attempted with an unknown or expired challenge
+	ErrChallengeInvalid modelError = "login has expired, please log in again"
+
+	// ErrIdentityEmailUnverified is returned when signing in with an
+	// identity provider that has not verified the user's email address
+	ErrIdentityEmailUnverified modelError = "your email address must be verified with the identity provider before you can sign in with it"
+
 	// ErrInvalidID is returned when an invalid ID is provided
 	// to a method like Delete.
 	ErrInvalidID privateError = "ID provided was invalid"
 
-	// ErrRememberRequired is returned when a create or update
-	// is attempted without a user remember token hash
-	ErrRememberRequired privateError = "remember token is required"
-
-	// ErrRememberTooShort is returned when a remember token is
-	// not at least 32 bytes
-	ErrRememberTooShort privateError = "remember token must be at least 32 bytes"
-
 	// ErrUserIDRequired is returned when a user ID is not passed in for comment creation
 	ErrUserIDRequired privateError = "user ID is required"
 
@@ -72,6 +152,10 @@ const (
 	// ErrReviewRequired is returned when a review note is not passed in for comment creation
 	ErrReviewRequired privateError = "review note is required"
 
+	// ErrTwoFactorSecretInvalid is returned when a stored TOTP secret
+	// cannot be decrypted, e.g. after HMAC_SECRET_KEY was changed
+	ErrTwoFactorSecretInvalid privateError = "two-factor secret cannot be decrypted"
+
 	// ErrTokenInvalid const for invalid token errors
 	ErrTokenInvalid modelError = "token provided is not valid"
 )
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sajicode/go-book/rand"
+)
+
+// Identity links an account at an external identity provider to a
+// user. A user may have identities at several providers.
+type Identity struct {
+	ID        uint      `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Provider  string    `gorm:"size:64;not null" json:"provider"`
+	Subject   string    `gorm:"size:255;not null" json:"-"`
+	Email     string    `gorm:"size:255" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastLoginAt is when the identity was last used to sign in
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// ExternalUser is who an identity provider says signed in
+type ExternalUser struct {
+	Provider string
+	// Subject is the ID of the user at the provider. Unlike the
+	// email address it never changes.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Avatar        string
+}
+
+// IdentityService signs users in with external identity providers
+type IdentityService interface {
+	// Login returns the user linked to ext. An identity seen for the
+	// first time is linked to the user with the same email address,
+	// and a user is created when there is none. Either needs the
+	// provider to have verified the address.
+	Login(ext *ExternalUser) (*User, error)
+	// ByUserID lists the identities linked to a user
+	ByUserID(userID uint) ([]Identity, error)
+	// Unlink removes an identity of a user
+	Unlink(userID, id uint) error
+}
+
+// identityDB is used to interact with the identities table
+type identityDB interface {
+	ByProvider(provider, subject string) (*Identity, error)
+	ByUserID(userID uint) ([]Identity, error)
+	Create(identity *Identity) error
+	Update(identity *Identity) error
+	// Delete removes the identity with the given ID if it belongs to
+	// the user, and returns ErrNotFound otherwise
+	Delete(userID, id uint) error
+}
+
+// NewIdentityService creates an IdentityService. users creates the
+// accounts of new users.
+func NewIdentityService(db *gorm.DB, users UserDB) IdentityService {
+	return &identityService{
+		db:    &identityGorm{db},
+		users: users,
+	}
+}
+
+var _ IdentityService = &identityService{}
+
+type identityService struct {
+	db    identityDB
+	users UserDB
+}
+
+func (is *identityService) Login(ext *ExternalUser) (*User, error) {
+	identity, err := is.db.ByProvider(ext.Provider, ext.Subject)
+	switch err {
+	case nil:
+		user, err := is.users.ByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		identity.Email = ext.Email
+		identity.LastLoginAt = time.Now()
+		if err := is.db.Update(identity); err != nil {
+			return nil, err
+		}
+		return is.checkUser(user)
+	case ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	//* an unverified address could belong to anyone, so it must not
+	//* reach an existing account
+	if ext.Email == "" || !ext.EmailVerified {
+		return nil, ErrIdentityEmailUnverified
+	}
+	user, err := is.users.ByEmail(strings.ToLower(ext.Email))
+	switch err {
+	case nil:
+		//* whoever registered an unverified address may not own it, and
+		//* would keep their password on the account once it is linked
+		if !user.EmailVerified {
+			return nil, ErrEmailNotVerified
+		}
+	case ErrNotFound:
+		user, err = is.createUser(ext)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	identity = &Identity{
+		UserID:      user.ID,
+		Provider:    ext.Provider,
+		Subject:     ext.Subject,
+		Email:       ext.Email,
+		LastLoginAt: time.Now(),
+	}
+	if err := is.db.Create(identity); err != nil {
+		return nil, err
+	}
+	return is.checkUser(user)
+}
+
+// createUser creates the account of someone who signed up through a
+// provider. They get a random password, which they can replace with
+// the password reset flow if they want to sign in without it. It is
+// not one they chose, so the password policy does not apply.
+func (is *identityService) createUser(ext *ExternalUser) (*User, error) {
+	password, err := rand.String(32)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{
+		FirstName:     ext.FirstName,
+		LastName:      ext.LastName,
+		Email:         ext.Email,
+		EmailVerified: true,
+		Password:      password,
+
+		generatedPassword: true,
+	}
+	if ext.Avatar != "" {
+		user.Avatar = ext.Avatar
+	}
+	return is.users.Create(user)
+}
+
+func (is *identityService) checkUser(user *User) (*User, error) {
+	if user.Suspended() {
+		return nil, ErrAccountSuspended
+	}
+	return user, nil
+}
+
+func (is *identityService) ByUserID(userID uint) ([]Identity, error) {
+	return is.db.ByUserID(userID)
+}
+
+func (is *identityService) Unlink(userID, id uint) error {
+	return is.db.Delete(userID, id)
+}
+
+var _ identityDB = &identityGorm{}
+
+type identityGorm struct {
+	db *gorm.DB
+}
+
+func (ig *identityGorm) ByProvider(provider, subject string) (*Identity, error) {
+	var identity Identity
+	err := first(ig.db.Where("provider = ? AND subject = ?", provider, subject), &identity)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (ig *identityGorm) ByUserID(userID uint) ([]Identity, error) {
+	var identities []Identity
+	err := ig.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (ig *identityGorm) Create(identity *Identity) error {
+	return ig.db.Create(identity).Error
+}
+
+func (ig *identityGorm) Update(identity *Identity) error {
+	return ig.db.Save(identity).Error
+}
+
+func (ig *identityGorm) Delete(userID, id uint) error {
+	result := ig.db.Where("id = ? AND user_id = ?", id, userID).Delete(&Identity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
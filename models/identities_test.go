@@ -0,0 +1,140 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// memoryIdentities keeps identities in memory
+type memoryIdentities struct {
+	identityDB
+	identities []*Identity
+}
+
+func (m *memoryIdentities) ByProvider(provider, subject string) (*Identity, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryIdentities) Create(identity *Identity) error {
+	identity.ID = uint(len(m.identities) + 1)
+	m.identities = append(m.identities, identity)
+	return nil
+}
+
+func (m *memoryIdentities) Update(identity *Identity) error { return nil }
+
+// memoryUsers is a UserDB holding users by ID
+type memoryUsers struct {
+	UserDB
+	users map[uint]*User
+}
+
+func (m *memoryUsers) ByID(id uint) (*User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryUsers) ByEmail(email string) (*User, error) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryUsers) Create(user *User) (*User, error) {
+	user.ID = uint(len(m.users) + 1)
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func newIdentityService() (*identityService, *memoryIdentities) {
+	suspended := time.Now()
+	identities := &memoryIdentities{identities: []*Identity{
+		{ID: 1, UserID: 3, Provider: "google", Subject: "suspended-sub"},
+	}}
+	return &identityService{
+		db: identities,
+		users: &memoryUsers{users: map[uint]*User{
+			1: {ID: 1, Email: "verified@example.com", EmailVerified: true},
+			2: {ID: 2, Email: "unverified@example.com"},
+			3: {ID: 3, Email: "suspended@example.com", EmailVerified: true, SuspendedAt: &suspended},
+		}},
+	}, identities
+}
+
+func TestIdentityLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		ext      ExternalUser
+		wantUser uint
+		wantErr  error
+		linked   bool
+	}{
+		{
+			name:     "links to a verified account",
+			ext:      ExternalUser{Provider: "google", Subject: "a", Email: "Verified@example.com", EmailVerified: true},
+			wantUser: 1,
+			linked:   true,
+		},
+		{
+			name:    "refuses an account whose address was never verified",
+			ext:     ExternalUser{Provider: "google", Subject: "b", Email: "unverified@example.com", EmailVerified: true},
+			wantErr: ErrEmailNotVerified,
+		},
+		{
+			name:    "refuses an address the provider did not verify",
+			ext:     ExternalUser{Provider: "google", Subject: "c", Email: "verified@example.com"},
+			wantErr: ErrIdentityEmailUnverified,
+		},
+		{
+			name:    "refuses an identity without an address",
+			ext:     ExternalUser{Provider: "google", Subject: "d", EmailVerified: true},
+			wantErr: ErrIdentityEmailUnverified,
+		},
+		{
+			name:     "creates an account for a new address",
+			ext:      ExternalUser{Provider: "google", Subject: "e", Email: "new@example.com", EmailVerified: true},
+			wantUser: 4,
+			linked:   true,
+		},
+		{
+			name:    "refuses a suspended account that is already linked",
+			ext:     ExternalUser{Provider: "google", Subject: "suspended-sub"},
+			wantErr: ErrAccountSuspended,
+		},
+	}
+	for _, tt := range tests {
+		is, identities := newIdentityService()
+		user, err := is.Login(&tt.ext)
+		if err != tt.wantErr {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && user.ID != tt.wantUser {
+			t.Errorf("%s: user = %d, want %d", tt.name, user.ID, tt.wantUser)
+		}
+		if linked := len(identities.identities) > 1; linked != tt.linked {
+			t.Errorf("%s: linked = %v, want %v", tt.name, linked, tt.linked)
+		}
+	}
+}
+
+func TestIdentityLoginCreatesVerifiedUser(t *testing.T) {
+	is, _ := newIdentityService()
+	user, err := is.Login(&ExternalUser{Provider: "google", Subject: "e", Email: "new@example.com", EmailVerified: true, FirstName: "New"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified || user.Password == "" || !user.generatedPassword {
+		t.Errorf("user = %+v, want a verified user with a generated password", user)
+	}
+}
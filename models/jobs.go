@@ -0,0 +1,332 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// JobStatus is where a job is in its lifecycle
+type JobStatus string
+
+// A job is pending until a worker claims it and running while the
+// worker handles it. It is then done, or pending again to be retried
+// after a backoff, or dead once it has used up its attempts.
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobDead    JobStatus = "dead"
+)
+
+const (
+	// DefaultJobAttempts is how many times a job is tried before it
+	// is dead-lettered
+	DefaultJobAttempts = 8
+
+	// jobBackoffBase is the delay before the first retry. Each retry
+	// after that waits twice as long, up to jobBackoffMax.
+	jobBackoffBase = 30 * time.Second
+	jobBackoffMax  = time.Hour
+
+	// jobLockTimeout is how long a job may stay running before it is
+	// assumed its worker died and another may claim it
+	jobLockTimeout = 10 * time.Minute
+
+	// DefaultJobRetention is how long finished jobs are kept before
+	// they are purged
+	DefaultJobRetention = 7 * 24 * time.Hour
+)
+
+// Valid reports whether s is one of the known job statuses
+func (s JobStatus) Valid() bool {
+	switch s {
+	case JobPending, JobRunning, JobDone, JobDead:
+		return true
+	}
+	return false
+}
+
+// Job is a unit of background work, such as an email to deliver,
+// stored so that it survives restarts and can be retried
+type Job struct {
+	ID          uint       `gorm:"primary_key;auto_increment" json:"id"`
+	Queue       string     `gorm:"size:64;not null;index" json:"queue"`
+	Payload     string     `gorm:"type:text;not null" json:"-"`
+	Status      JobStatus  `gorm:"size:16;not null;index" json:"status"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int        `gorm:"not null" json:"max_attempts"`
+	LastError   string     `gorm:"type:text" json:"last_error"`
+	RunAt       time.Time  `gorm:"not null;index" json:"run_at"`
+	LockedAt    *time.Time `gorm:"default:NULL" json:"locked_at"`
+	FinishedAt  *time.Time `gorm:"default:NULL" json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// JobCount is the number of jobs in a queue with a status
+type JobCount struct {
+	Queue  string    `json:"queue"`
+	Status JobStatus `json:"status"`
+	Count  int       `json:"count"`
+}
+
+// JobDB is used to interact with the jobs table
+type JobDB interface {
+	Create(job *Job) error
+	Update(job *Job) error
+	// Claim takes the next job due in queue and marks it running.
+	// It returns ErrNotFound when there is nothing to do.
+	Claim(queue string) (*Job, error)
+	// ByStatus lists jobs with status, or every job when status is empty
+	ByStatus(status JobStatus, p Pagination) ([]Job, *PageInfo, error)
+	Counts() ([]JobCount, error)
+	// Purge deletes the done and dead jobs in queue that finished
+	// before the given time and returns how many there were
+	Purge(queue string, before time.Time) (int64, error)
+}
+
+// JobService is a set of methods used to work with background jobs
+type JobService interface {
+	JobDB
+	// Enqueue stores payload as JSON in a new job on queue
+	Enqueue(queue string, payload interface{}) error
+	// Complete marks a claimed job as done and clears its payload
+	Complete(job *Job) error
+	// Fail records why a claimed job failed and either schedules a
+	// retry or, once its attempts are used up, dead-letters it and
+	// clears its payload
+	Fail(job *Job, cause error) error
+}
+
+// NewJobService handles connection to the DB
+func NewJobService(db *gorm.DB) JobService {
+	return &jobService{
+		JobDB: &jobValidator{&jobGorm{db}},
+	}
+}
+
+var _ JobService = &jobService{}
+
+type jobService struct {
+	JobDB
+}
+
+func (js *jobService) Enqueue(queue string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return js.Create(&Job{Queue: queue, Payload: string(data)})
+}
+
+func (js *jobService) Complete(job *Job) error {
+	now := time.Now()
+	job.Status = JobDone
+	//* payloads can hold secrets, such as the links in emails, so they
+	//* are not kept once nothing will run them again
+	job.Payload = ""
+	job.LastError = ""
+	job.LockedAt = nil
+	job.FinishedAt = &now
+	return js.Update(job)
+}
+
+func (js *jobService) Fail(job *Job, cause error) error {
+	now := time.Now()
+	job.LastError = cause.Error()
+	job.LockedAt = nil
+	if job.Attempts >= job.MaxAttempts {
+		job.Status = JobDead
+		job.Payload = ""
+		job.FinishedAt = &now
+	} else {
+		job.Status = JobPending
+		job.RunAt = now.Add(jobBackoff(job.Attempts))
+	}
+	return js.Update(job)
+}
+
+// jobBackoff is how long to wait before retrying a job that has
+// failed attempts times
+func jobBackoff(attempts int) time.Duration {
+	delay := jobBackoffBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= jobBackoffMax {
+			return jobBackoffMax
+		}
+	}
+	return delay
+}
+
+type jobValidator struct {
+	JobDB
+}
+
+func (jv *jobValidator) Create(job *Job) error {
+	err := runJobValFns(job,
+		jv.requireQueue,
+		jv.setDefaults,
+		jv.statusValid,
+	)
+	if err != nil {
+		return err
+	}
+	return jv.JobDB.Create(job)
+}
+
+func (jv *jobValidator) Update(job *Job) error {
+	err := runJobValFns(job,
+		jv.requireQueue,
+		jv.statusValid,
+	)
+	if err != nil {
+		return err
+	}
+	return jv.JobDB.Update(job)
+}
+
+func (jv *jobValidator) ByStatus(status JobStatus, p Pagination) ([]Job, *PageInfo, error) {
+	if status != "" && !status.Valid() {
+		return nil, nil, ErrJobStatusInvalid
+	}
+	if err := p.normalize(); err != nil {
+		return nil, nil, err
+	}
+	return jv.JobDB.ByStatus(status, p)
+}
+
+func (jv *jobValidator) requireQueue(job *Job) error {
+	if job.Queue == "" {
+		return ErrInvalidRequest
+	}
+	return nil
+}
+
+func (jv *jobValidator) setDefaults(job *Job) error {
+	if job.Status == "" {
+		job.Status = JobPending
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultJobAttempts
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	return nil
+}
+
+func (jv *jobValidator) statusValid(job *Job) error {
+	if !job.Status.Valid() {
+		return ErrJobStatusInvalid
+	}
+	return nil
+}
+
+type jobValFn func(*Job) error
+
+func runJobValFns(job *Job, fns ...jobValFn) error {
+	for _, fn := range fns {
+		if err := fn(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ JobDB = &jobGorm{}
+
+type jobGorm struct {
+	db *gorm.DB
+}
+
+func (jg *jobGorm) Create(job *Job) error {
+	return jg.db.Create(job).Error
+}
+
+func (jg *jobGorm) Update(job *Job) error {
+	return jg.db.Save(job).Error
+}
+
+// Claim locks the next due job so that concurrent workers, even in
+// other processes, never pick up the same one. Jobs left running past
+// jobLockTimeout by a worker that died are claimed again.
+func (jg *jobGorm) Claim(queue string) (*Job, error) {
+	var job Job
+	err := transaction(jg.db, func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Where("queue = ?", queue).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_at < ?)",
+				JobPending, now, JobRunning, now.Add(-jobLockTimeout)).
+			Order("run_at ASC").Order("id ASC")
+		if isPostgres(tx) {
+			query = query.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+		}
+		if err := first(query, &job); err != nil {
+			return err
+		}
+		job.Status = JobRunning
+		job.Attempts++
+		job.LockedAt = &now
+		return tx.Save(&job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (jg *jobGorm) ByStatus(status JobStatus, p Pagination) ([]Job, *PageInfo, error) {
+	db := jg.db.Model(&Job{})
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+
+	var total int
+	if err := db.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	db, err := pageQuery(db, "jobs", true, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	var jobs []Job
+	if err := db.Find(&jobs).Error; err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]cursor, len(jobs))
+	for i, job := range jobs {
+		keys[i] = cursor{CreatedAt: job.CreatedAt, ID: job.ID}
+	}
+	info, n := newPageInfo(p, total, keys)
+	jobs = jobs[:n]
+	if p.Before != "" {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			jobs[i], jobs[j] = jobs[j], jobs[i]
+		}
+	}
+	return jobs, info, nil
+}
+
+func (jg *jobGorm) Counts() ([]JobCount, error) {
+	var counts []JobCount
+	err := jg.db.Model(&Job{}).
+		Select("queue, status, COUNT(*) AS count").
+		Group("queue, status").
+		Order("queue, status").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (jg *jobGorm) Purge(queue string, before time.Time) (int64, error) {
+	db := jg.db.Where("queue = ? AND status IN (?) AND finished_at < ?", queue, []JobStatus{JobDone, JobDead}, before).
+		Delete(&Job{})
+	return db.RowsAffected, db.Error
+}
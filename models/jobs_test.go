@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// memoryJobs records the jobs saved through it
+type memoryJobs struct {
+	JobDB
+	saved []Job
+}
+
+func (m *memoryJobs) Update(job *Job) error {
+	m.saved = append(m.saved, *job)
+	return nil
+}
+
+func TestFinishedJobsDropPayload(t *testing.T) {
+	js := &jobService{JobDB: &memoryJobs{}}
+	tests := []struct {
+		name        string
+		attempts    int
+		finish      func(job *Job) error
+		wantStatus  JobStatus
+		wantPayload string
+	}{
+		{"done", 1, js.Complete, JobDone, ""},
+		{"retried", 1, func(job *Job) error { return js.Fail(job, errors.New("timeout")) }, JobPending, `{"token":"secret"}`},
+		{"dead", 8, func(job *Job) error { return js.Fail(job, errors.New("timeout")) }, JobDead, ""},
+	}
+	for _, tt := range tests {
+		job := &Job{Queue: "email", Payload: `{"token":"secret"}`, Status: JobRunning, Attempts: tt.attempts, MaxAttempts: DefaultJobAttempts}
+		if err := tt.finish(job); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if job.Status != tt.wantStatus || job.Payload != tt.wantPayload {
+			t.Errorf("%s: status = %s, payload = %q, want %s and %q", tt.name, job.Status, job.Payload, tt.wantStatus, tt.wantPayload)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loginPolicy says how failed logins from one source slow it down.
+// After delayAfter failures each attempt must wait baseDelay, doubling
+// with every further failure up to maxDelay. After lockAfter failures
+// the source is locked out for lockFor. Failures older than lockFor
+// are forgotten.
+type loginPolicy struct {
+	delayAfter int
+	lockAfter  int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	lockFor    time.Duration
+}
+
+var (
+	// accountLoginPolicy limits guessing the password of one account
+	accountLoginPolicy = loginPolicy{
+		delayAfter: 3,
+		lockAfter:  10,
+		baseDelay:  time.Second,
+		maxDelay:   30 * time.Second,
+		lockFor:    15 * time.Minute,
+	}
+
+	// ipLoginPolicy limits one address trying many accounts. It is
+	// looser as many users may share an address.
+	ipLoginPolicy = loginPolicy{
+		delayAfter: 20,
+		lockAfter:  100,
+		baseDelay:  time.Second,
+		maxDelay:   30 * time.Second,
+		lockFor:    15 * time.Minute,
+	}
+)
+
+// wait returns how long the source must wait before its next attempt,
+// given its failures and when the last one happened
+func (p loginPolicy) wait(failures int, last, now time.Time) time.Duration {
+	var delay time.Duration
+	switch {
+	case failures >= p.lockAfter:
+		delay = p.lockFor
+	case failures >= p.delayAfter:
+		delay = p.baseDelay << uint(failures-p.delayAfter)
+		if delay > p.maxDelay {
+			delay = p.maxDelay
+		}
+	default:
+		return 0
+	}
+	if wait := last.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// LoginAttempt records one try at logging in. Attempts are tracked by
+// the email that was typed, whether or not it belongs to an account,
+// so that lockouts do not reveal which addresses are registered.
+type LoginAttempt struct {
+	ID        uint      `gorm:"primary_key;auto_increment"`
+	Email     string    `gorm:"size:255;not null;index"`
+	IP        string    `gorm:"size:64;not null;index"`
+	Success   bool      `gorm:"not null;default:false"`
+	CreatedAt time.Time `gorm:"not null;index"`
+}
+
+// LoginThrottledError is returned by Login when attempts for an email
+// or from an address came too fast
+type LoginThrottledError struct {
+	// RetryAfter is how long to wait before trying again
+	RetryAfter time.Duration
+	// Locked is set once the lockout threshold has been reached
+	Locked bool
+	// Account is set on the attempt that locked an existing account,
+	// so that its owner can be emailed an unlock link
+	Account *User
+}
+
+func (e *LoginThrottledError) Error() string {
+	return e.Public()
+}
+
+// Public is the message shown to the client
+func (e *LoginThrottledError) Public() string {
+	wait := e.RetryAfter.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if e.Locked {
+		return fmt.Sprintf("too many failed login attempts, login is locked for %s", wait)
+	}
+	return fmt.Sprintf("too many failed login attempts, please try again in %s", wait)
+}
+
+type loginAttemptDB interface {
+	Create(attempt *LoginAttempt) error
+	// Delete forgets one attempt
+	Delete(id uint) error
+	// Failures counts the failed attempts for email, or from ip, made
+	// since since and recorded before the attempt with ID before, and
+	// returns when the latest one happened
+	FailuresByEmail(email string, since time.Time, before uint) (int, time.Time, error)
+	FailuresByIP(ip string, since time.Time, before uint) (int, time.Time, error)
+	// ClearFailures forgets the failed attempts for email, after a
+	// successful login, password reset or unlock
+	ClearFailures(email string) error
+	// Prune deletes every attempt made before before
+	Prune(before time.Time) (int64, error)
+}
+
+type loginAttemptGorm struct {
+	db *gorm.DB
+}
+
+func (lag *loginAttemptGorm) Create(attempt *LoginAttempt) error {
+	return lag.db.Create(attempt).Error
+}
+
+func (lag *loginAttemptGorm) Delete(id uint) error {
+	return lag.db.Where("id = ?", id).Delete(&LoginAttempt{}).Error
+}
+
+func (lag *loginAttemptGorm) FailuresByEmail(email string, since time.Time, before uint) (int, time.Time, error) {
+	return lag.failures(lag.db.Where("email = ?", email), since, before)
+}
+
+func (lag *loginAttemptGorm) FailuresByIP(ip string, since time.Time, before uint) (int, time.Time, error) {
+	return lag.failures(lag.db.Where("ip = ?", ip), since, before)
+}
+
+func (lag *loginAttemptGorm) failures(db *gorm.DB, since time.Time, before uint) (int, time.Time, error) {
+	var result struct {
+		Count int
+		Last  *time.Time
+	}
+	err := db.Model(&LoginAttempt{}).
+		Select("COUNT(*) AS count, MAX(created_at) AS last").
+		Where("success = ? AND created_at > ? AND id < ?", false, since, before).
+		Scan(&result).Error
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if result.Last == nil {
+		return result.Count, time.Time{}, nil
+	}
+	return result.Count, *result.Last, nil
+}
+
+func (lag *loginAttemptGorm) ClearFailures(email string) error {
+	return lag.db.Where("email = ? AND success = ?", email, false).Delete(&LoginAttempt{}).Error
+}
+
+func (lag *loginAttemptGorm) Prune(before time.Time) (int64, error) {
+	db := lag.db.Where("created_at < ?", before).Delete(&LoginAttempt{})
+	return db.RowsAffected, db.Error
+}
+
+// loginAttemptRetention is how long login attempts are kept. It must
+// be longer than the lockFor of every loginPolicy.
+const loginAttemptRetention = 24 * time.Hour
+
+// PruneLoginAttempts deletes the login attempts that are too old to
+// count towards any limit
+func (us *userService) PruneLoginAttempts(now time.Time) error {
+	_, err := us.loginAttemptDB.Prune(now.Add(-loginAttemptRetention))
+	return err
+}
+
+// Login checks the attempts made for email and from ip before calling
+// Authenticate, and records the outcome. A wrong password and an
+// unknown email both return ErrLoginFailed.
+func (us *userService) Login(email, password, ip string) (*User, error) {
+	return us.throttledLogin(email, password, ip, us.Authenticate)
+}
+
+// throttledLogin does the work of Login with authenticate checking the
+// password, so that every way of proving a password shares the same
+// attempts and lockout
+func (us *userService) throttledLogin(email, password, ip string, authenticate func(email, password string) (*User, error)) (*User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	now := time.Now()
+
+	//* the attempt is recorded as a failure before anything is checked
+	//* and only counts the failures recorded before it, so concurrent
+	//* attempts each see the others and cannot all slip under a limit
+	attempt := &LoginAttempt{Email: email, IP: ip}
+	if err := us.loginAttemptDB.Create(attempt); err != nil {
+		return nil, err
+	}
+	emailFailures, emailLast, err := us.loginAttemptDB.FailuresByEmail(email, now.Add(-accountLoginPolicy.lockFor), attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+	ipFailures, ipLast, err := us.loginAttemptDB.FailuresByIP(ip, now.Add(-ipLoginPolicy.lockFor), attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+	throttled := &LoginThrottledError{
+		RetryAfter: accountLoginPolicy.wait(emailFailures, emailLast, now),
+		Locked:     emailFailures >= accountLoginPolicy.lockAfter,
+	}
+	if wait := ipLoginPolicy.wait(ipFailures, ipLast, now); wait > throttled.RetryAfter {
+		throttled.RetryAfter = wait
+		throttled.Locked = ipFailures >= ipLoginPolicy.lockAfter
+	}
+	if throttled.RetryAfter > 0 {
+		//* a refused attempt never checked a password, so it does not
+		//* count as a failure
+		if err := us.loginAttemptDB.Delete(attempt.ID); err != nil {
+			return nil, err
+		}
+		return nil, throttled
+	}
+
+	user, err := authenticate(email, password)
+	switch err {
+	case nil:
+		if err := us.loginAttemptDB.ClearFailures(email); err != nil {
+			return nil, err
+		}
+		if err := us.loginAttemptDB.Create(&LoginAttempt{Email: email, IP: ip, Success: true}); err != nil {
+			return nil, err
+		}
+		return user, nil
+	case ErrNotFound, ErrPasswordIncorrect:
+	default:
+		us.loginAttemptDB.Delete(attempt.ID)
+		return nil, err
+	}
+
+	if err == ErrNotFound {
+		//* spend as long as a wrong password would, so response times
+		//* do not tell registered addresses apart
+		bcrypt.CompareHashAndPassword(missingUserHash(), []byte(password+us.pepper))
+	}
+	if emailFailures+1 >= accountLoginPolicy.lockAfter {
+		locked := &LoginThrottledError{RetryAfter: accountLoginPolicy.lockFor, Locked: true}
+		if err == ErrPasswordIncorrect {
+			locked.Account, _ = us.ByEmail(email)
+		}
+		return nil, locked
+	}
+	return nil, ErrLoginFailed
+}
+
+var (
+	missingUserHashOnce  sync.Once
+	missingUserHashValue []byte
+)
+
+// missingUserHash is a bcrypt hash to compare passwords against when
+// the email belongs to nobody
+func missingUserHash() []byte {
+	missingUserHashOnce.Do(func() {
+		missingUserHashValue, _ = bcrypt.GenerateFromPassword([]byte("missing user"), bcrypt.DefaultCost)
+	})
+	return missingUserHashValue
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryLoginAttempts keeps login attempts in memory
+type memoryLoginAttempts struct {
+	attempts []LoginAttempt
+	lastID   uint
+}
+
+func (m *memoryLoginAttempts) Create(attempt *LoginAttempt) error {
+	m.lastID++
+	attempt.ID = m.lastID
+	attempt.CreatedAt = time.Now()
+	m.attempts = append(m.attempts, *attempt)
+	return nil
+}
+
+func (m *memoryLoginAttempts) Delete(id uint) error {
+	return m.remove(func(a LoginAttempt) bool { return a.ID == id })
+}
+
+func (m *memoryLoginAttempts) Prune(before time.Time) (int64, error) {
+	n := len(m.attempts)
+	m.remove(func(a LoginAttempt) bool { return a.CreatedAt.Before(before) })
+	return int64(n - len(m.attempts)), nil
+}
+
+func (m *memoryLoginAttempts) remove(match func(LoginAttempt) bool) error {
+	kept := m.attempts[:0]
+	for _, attempt := range m.attempts {
+		if !match(attempt) {
+			kept = append(kept, attempt)
+		}
+	}
+	m.attempts = kept
+	return nil
+}
+
+func (m *memoryLoginAttempts) failures(match func(LoginAttempt) bool, since time.Time, before uint) (int, time.Time, error) {
+	var count int
+	var last time.Time
+	for _, attempt := range m.attempts {
+		if !attempt.Success && match(attempt) && attempt.CreatedAt.After(since) && attempt.ID < before {
+			count++
+			last = attempt.CreatedAt
+		}
+	}
+	return count, last, nil
+}
+
+func (m *memoryLoginAttempts) FailuresByEmail(email string, since time.Time, before uint) (int, time.Time, error) {
+	return m.failures(func(a LoginAttempt) bool { return a.Email == email }, since, before)
+}
+
+func (m *memoryLoginAttempts) FailuresByIP(ip string, since time.Time, before uint) (int, time.Time, error) {
+	return m.failures(func(a LoginAttempt) bool { return a.IP == ip }, since, before)
+}
+
+func (m *memoryLoginAttempts) ClearFailures(email string) error {
+	return m.remove(func(a LoginAttempt) bool { return !a.Success && a.Email == email })
+}
+
+// deletedUsers is a UserDB holding one deleted user
+type deletedUsers struct {
+	UserDB
+	deleted  *User
+	restored bool
+}
+
+func (d *deletedUsers) ByEmail(email string) (*User, error) {
+	return nil, ErrNotFound
+}
+
+func (d *deletedUsers) DeletedByEmail(email string) (*User, error) {
+	if d.restored || email != d.deleted.Email {
+		return nil, ErrNotFound
+	}
+	return d.deleted, nil
+}
+
+func (d *deletedUsers) Restore(id uint) error {
+	d.restored = true
+	return nil
+}
+
+func (d *deletedUsers) ByID(id uint) (*User, error) {
+	return d.deleted, nil
+}
+
+func newRestoreService(t *testing.T) (*userService, *deletedUsers) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"+"pepper"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &deletedUsers{deleted: &User{ID: 1, Email: "reader@example.com", PasswordHash: string(hash)}}
+	return &userService{
+		UserDB:         users,
+		pepper:         "pepper",
+		loginAttemptDB: &memoryLoginAttempts{},
+	}, users
+}
+
+func TestRestoreAccountIsThrottledLikeLogin(t *testing.T) {
+	us, users := newRestoreService(t)
+
+	for i := 0; i < accountLoginPolicy.delayAfter; i++ {
+		if _, err := us.RestoreAccount("reader@example.com", "wrong", "203.0.113.7"); err != ErrLoginFailed {
+			t.Fatalf("attempt %d: err = %v, want ErrLoginFailed", i+1, err)
+		}
+	}
+	_, err := us.RestoreAccount("reader@example.com", "correct horse", "203.0.113.7")
+	if _, ok := err.(*LoginThrottledError); !ok {
+		t.Fatalf("err = %v, want a *LoginThrottledError", err)
+	}
+	if users.restored {
+		t.Error("account was restored while attempts were throttled")
+	}
+}
+
+func TestRestoreAccountFailsLikeLogin(t *testing.T) {
+	us, users := newRestoreService(t)
+
+	if _, err := us.RestoreAccount("nobody@example.com", "correct horse", "203.0.113.7"); err != ErrLoginFailed {
+		t.Errorf("unknown email: err = %v, want ErrLoginFailed", err)
+	}
+	if _, err := us.RestoreAccount("reader@example.com", "wrong", "203.0.113.8"); err != ErrLoginFailed {
+		t.Errorf("wrong password: err = %v, want ErrLoginFailed", err)
+	}
+	user, err := us.RestoreAccount("READER@example.com ", "correct horse", "203.0.113.9")
+	if err != nil {
+		t.Fatalf("correct password: err = %v", err)
+	}
+	if user.ID != 1 || !users.restored {
+		t.Errorf("user = %v, restored = %v, want user 1 restored", user, users.restored)
+	}
+}
+
+func TestLoginLocksOnce(t *testing.T) {
+	attempts := &memoryLoginAttempts{}
+	us := &userService{UserDB: &deletedUsers{}, loginAttemptDB: attempts}
+	wrong := func(email, password string) (*User, error) { return nil, ErrPasswordIncorrect }
+	//* earlier failures, old enough for their delays to have passed
+	for i := 0; i < accountLoginPolicy.lockAfter-1; i++ {
+		attempts.Create(&LoginAttempt{Email: "reader@example.com", IP: "203.0.113.7"})
+		attempts.attempts[i].CreatedAt = time.Now().Add(-time.Minute)
+	}
+
+	_, err := us.throttledLogin("reader@example.com", "wrong", "203.0.113.7", wrong)
+	if locked, ok := err.(*LoginThrottledError); !ok || !locked.Locked {
+		t.Fatalf("err = %v, want the attempt to lock the account", err)
+	}
+	n := len(attempts.attempts)
+	_, err = us.throttledLogin("reader@example.com", "wrong", "203.0.113.7", wrong)
+	if locked, ok := err.(*LoginThrottledError); !ok || !locked.Locked || locked.Account != nil {
+		t.Fatalf("err = %v, want the attempt refused without notifying again", err)
+	}
+	if len(attempts.attempts) != n {
+		t.Errorf("%d attempts recorded, want the refused one forgotten", len(attempts.attempts)-n)
+	}
+}
+
+func TestLoginCountsAttemptsInProgress(t *testing.T) {
+	attempts := &memoryLoginAttempts{}
+	us := &userService{UserDB: &deletedUsers{}, loginAttemptDB: attempts}
+	var inProgress int
+	//* each check of the password starts another login, as concurrent
+	//* requests would, before the first has finished
+	var authenticate func(email, password string) (*User, error)
+	authenticate = func(email, password string) (*User, error) {
+		inProgress++
+		if inProgress < 2*accountLoginPolicy.delayAfter {
+			us.throttledLogin(email, password, "203.0.113.7", authenticate)
+		}
+		return nil, ErrPasswordIncorrect
+	}
+	us.throttledLogin("reader@example.com", "wrong", "203.0.113.7", authenticate)
+	if inProgress != accountLoginPolicy.delayAfter {
+		t.Errorf("%d passwords checked, want %d before attempts are delayed", inProgress, accountLoginPolicy.delayAfter)
+	}
+}
+
+func TestPruneLoginAttempts(t *testing.T) {
+	attempts := &memoryLoginAttempts{}
+	us := &userService{loginAttemptDB: attempts}
+	attempts.Create(&LoginAttempt{Email: "old@example.com"})
+	attempts.Create(&LoginAttempt{Email: "new@example.com"})
+	attempts.attempts[0].CreatedAt = time.Now().Add(-2 * loginAttemptRetention)
+
+	if err := us.PruneLoginAttempts(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts.attempts) != 1 || attempts.attempts[0].Email != "new@example.com" {
+		t.Errorf("attempts = %+v, want only the new one kept", attempts.attempts)
+	}
+}
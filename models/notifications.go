@@ -0,0 +1,246 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// NotificationType says what a notification is about
+type NotificationType string
+
+// NotificationNewReview is sent to a book's owner when someone
+// reviews the book
+const NotificationNewReview NotificationType = "new_review"
+
+// NotifyPreference is how a user wants to be emailed about their
+// notifications. They always appear in the app.
+type NotifyPreference string
+
+// Users are emailed about each notification as it happens, in one
+// daily digest, or not at all
+const (
+	NotifyImmediate NotifyPreference = "immediate"
+	NotifyDigest    NotifyPreference = "digest"
+	NotifyOff       NotifyPreference = "off"
+)
+
+// Valid reports whether p is one of the known preferences
+func (p NotifyPreference) Valid() bool {
+	switch p {
+	case NotifyImmediate, NotifyDigest, NotifyOff:
+		return true
+	}
+	return false
+}
+
+// defaultNotifyPreference emails new users about each notification
+func (uv *userValidator) defaultNotifyPreference(user *User) error {
+	if user.NotifyPreference == "" {
+		user.NotifyPreference = NotifyImmediate
+	}
+	return nil
+}
+
+// notifyPreferenceValid makes sure a user holds one of the known preferences
+func (uv *userValidator) notifyPreferenceValid(user *User) error {
+	if !user.NotifyPreference.Valid() {
+		return ErrNotifyPreferenceInvalid
+	}
+	return nil
+}
+
+// Notification tells a user that something happened to their content
+type Notification struct {
+	ID        uint             `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint             `gorm:"not null;index" json:"-"`
+	ActorID   uint             `gorm:"not null" json:"actor_id"`
+	Type      NotificationType `gorm:"size:32;not null" json:"type"`
+	BookID    uint             `gorm:"not null" json:"book_id"`
+	ReviewID  uint             `json:"review_id"`
+	Message   string           `gorm:"not null" json:"message"`
+	ReadAt    *time.Time       `gorm:"default:NULL" json:"read_at"`
+	EmailedAt *time.Time       `gorm:"default:NULL" json:"-"`
+	CreatedAt time.Time        `json:"created_at"`
+	Actor     User             `gorm:"ForeignKey:actor_id" json:"actor"`
+}
+
+// NotificationDB is used to interact with the notifications table
+type NotificationDB interface {
+	Create(n *Notification) error
+	// ByUserID lists a user's notifications, newest first
+	ByUserID(userID uint, unreadOnly bool, p Pagination) ([]Notification, *PageInfo, error)
+	UnreadCount(userID uint) (int, error)
+	// MarkRead marks one of the user's notifications as read
+	MarkRead(id, userID uint) error
+	MarkAllRead(userID uint) error
+	MarkEmailed(id uint) error
+	// DigestUserIDs returns the users on the daily digest who have
+	// notifications that have not been emailed yet
+	DigestUserIDs() ([]uint, error)
+	// ClaimDigest returns a user's notifications that have not been
+	// emailed and marks them as emailed
+	ClaimDigest(userID uint) ([]Notification, error)
+}
+
+// NotificationService is a set of methods used to work with notifications
+type NotificationService interface {
+	NotificationDB
+}
+
+// NewNotificationService handles connection to the DB
+func NewNotificationService(db *gorm.DB) NotificationService {
+	return &notificationService{
+		NotificationDB: &notificationValidator{&notificationGorm{db}},
+	}
+}
+
+type notificationService struct {
+	NotificationDB
+}
+
+type notificationValidator struct {
+	NotificationDB
+}
+
+func (nv *notificationValidator) Create(n *Notification) error {
+	if n.UserID <= 0 {
+		return ErrUserIDRequired
+	}
+	if n.BookID <= 0 {
+		return ErrBookIDRequired
+	}
+	if n.Type == "" || n.Message == "" {
+		return ErrInvalidRequest
+	}
+	return nv.NotificationDB.Create(n)
+}
+
+func (nv *notificationValidator) ByUserID(userID uint, unreadOnly bool, p Pagination) ([]Notification, *PageInfo, error) {
+	if err := p.normalize(); err != nil {
+		return nil, nil, err
+	}
+	return nv.NotificationDB.ByUserID(userID, unreadOnly, p)
+}
+
+func (nv *notificationValidator) MarkRead(id, userID uint) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	return nv.NotificationDB.MarkRead(id, userID)
+}
+
+var _ NotificationDB = &notificationGorm{}
+
+type notificationGorm struct {
+	db *gorm.DB
+}
+
+func (ng *notificationGorm) Create(n *Notification) error {
+	return ng.db.Set("gorm:save_associations", false).Create(n).Error
+}
+
+func (ng *notificationGorm) ByUserID(userID uint, unreadOnly bool, p Pagination) ([]Notification, *PageInfo, error) {
+	db := ng.db.Model(&Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		db = db.Where("read_at IS NULL")
+	}
+
+	var total int
+	if err := db.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	db, err := pageQuery(db, "notifications", true, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	var notifications []Notification
+	if err := db.Preload("Actor").Find(&notifications).Error; err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]cursor, len(notifications))
+	for i, n := range notifications {
+		keys[i] = cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+	}
+	info, n := newPageInfo(p, total, keys)
+	notifications = notifications[:n]
+	if p.Before != "" {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			notifications[i], notifications[j] = notifications[j], notifications[i]
+		}
+	}
+	return notifications, info, nil
+}
+
+func (ng *notificationGorm) UnreadCount(userID uint) (int, error) {
+	var count int
+	err := ng.db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (ng *notificationGorm) MarkRead(id, userID uint) error {
+	res := ng.db.Model(&Notification{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		UpdateColumn("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now()))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (ng *notificationGorm) MarkAllRead(userID uint) error {
+	return ng.db.Model(&Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		UpdateColumn("read_at", time.Now()).Error
+}
+
+func (ng *notificationGorm) MarkEmailed(id uint) error {
+	return ng.db.Model(&Notification{}).
+		Where("id = ?", id).
+		UpdateColumn("emailed_at", time.Now()).Error
+}
+
+func (ng *notificationGorm) DigestUserIDs() ([]uint, error) {
+	var ids []uint
+	err := ng.db.Table("notifications").
+		Joins("JOIN users ON users.id = notifications.user_id").
+		Where("notifications.emailed_at IS NULL AND notifications.read_at IS NULL").
+		Where("users.notify_preference = ? AND users.deleted_at IS NULL", NotifyDigest).
+		Pluck("DISTINCT notifications.user_id", &ids).Error
+	return ids, err
+}
+
+// ClaimDigest locks the rows it returns so that two servers sending
+// digests at once do not email the same notifications twice
+func (ng *notificationGorm) ClaimDigest(userID uint) ([]Notification, error) {
+	var notifications []Notification
+	err := transaction(ng.db, func(tx *gorm.DB) error {
+		query := tx.Where("user_id = ? AND emailed_at IS NULL AND read_at IS NULL", userID).
+			Order("created_at ASC")
+		if isPostgres(tx) {
+			query = query.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+		}
+		if err := query.Find(&notifications).Error; err != nil {
+			return err
+		}
+		if len(notifications) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(notifications))
+		for i, n := range notifications {
+			ids[i] = n.ID
+		}
+		return tx.Model(&Notification{}).
+			Where("id IN (?)", ids).
+			UpdateColumn("emailed_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
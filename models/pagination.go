@@ -0,0 +1,178 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// DefaultPageLimit is the page size used when none is requested
+	DefaultPageLimit = 20
+
+	// MaxPageLimit is the largest page size a caller may request
+	MaxPageLimit = 100
+)
+
+// Pagination selects a page of a listing. After and Before are opaque
+// cursors taken from a previous PageInfo and select the rows following
+// or preceding that page, keyed on (created_at, id). When neither is
+// set, Page selects a 1-based page by offset.
+type Pagination struct {
+	Limit  int
+	Page   int
+	After  string
+	Before string
+}
+
+// PageInfo describes a page of results and how to reach its neighbours
+type PageInfo struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Page       int    `json:"page,omitempty"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+}
+
+// normalize fills in the default limit and page and clamps the limit
+func (p *Pagination) normalize() error {
+	if p.After != "" && p.Before != "" {
+		return ErrCursorInvalid
+	}
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+	return nil
+}
+
+// usesCursor reports whether the page is selected by a cursor
+func (p Pagination) usesCursor() bool {
+	return p.After != "" || p.Before != ""
+}
+
+// cursor identifies a row by its position in a (created_at, id) ordering
+type cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// encodeCursor returns the opaque form of a cursor handed to clients
+func encodeCursor(c cursor) string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrCursorInvalid
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return cursor{}, ErrCursorInvalid
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return cursor{}, ErrCursorInvalid
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return cursor{}, ErrCursorInvalid
+	}
+	return cursor{CreatedAt: time.Unix(0, nanos), ID: uint(id)}, nil
+}
+
+// pageQuery applies keyset or offset pagination on (created_at, id) to
+// db. It asks for one row more than the limit so the caller can tell
+// whether there is another page. Rows selected with a Before cursor come
+// back in reverse and must be flipped by the caller.
+func pageQuery(db *gorm.DB, table string, desc bool, p Pagination) (*gorm.DB, error) {
+	forward, backward := "<", ">"
+	order, reverse := "DESC", "ASC"
+	if !desc {
+		forward, backward = backward, forward
+		order, reverse = reverse, order
+	}
+	keyset := "%[1]s.created_at %[2]s ? OR (%[1]s.created_at = ? AND %[1]s.id %[2]s ?)"
+
+	switch {
+	case p.After != "":
+		c, err := decodeCursor(p.After)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(fmt.Sprintf(keyset, table, forward), c.CreatedAt, c.CreatedAt, c.ID)
+	case p.Before != "":
+		c, err := decodeCursor(p.Before)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(fmt.Sprintf(keyset, table, backward), c.CreatedAt, c.CreatedAt, c.ID)
+		order = reverse
+	default:
+		db = db.Offset(offset(p.Limit, p.Page))
+	}
+	return db.Order(table + ".created_at " + order).Order(table + ".id " + order).Limit(p.Limit + 1), nil
+}
+
+// newPageInfo works out the cursors around a page fetched by pageQuery.
+// keys holds the (created_at, id) of every fetched row in fetch order.
+// It returns how many rows belong on the page; the caller should keep
+// that many and, for Before cursors, reverse them.
+func newPageInfo(p Pagination, total int, keys []cursor) (*PageInfo, int) {
+	info := &PageInfo{Total: total, Limit: p.Limit}
+	if !p.usesCursor() {
+		info.Page = p.Page
+	}
+	hasMore := len(keys) > p.Limit
+	if hasMore {
+		keys = keys[:p.Limit]
+	}
+	n := len(keys)
+	if n == 0 {
+		return info, 0
+	}
+
+	first, last := keys[0], keys[n-1]
+	switch {
+	case p.After != "":
+		info.PrevCursor = encodeCursor(first)
+		if hasMore {
+			info.NextCursor = encodeCursor(last)
+		}
+	case p.Before != "":
+		// rows were fetched walking backwards, so the last fetched
+		// row is the first one on the page
+		info.NextCursor = encodeCursor(first)
+		if hasMore {
+			info.PrevCursor = encodeCursor(last)
+		}
+	default:
+		if hasMore {
+			info.NextCursor = encodeCursor(last)
+		}
+		if p.Page > 1 {
+			info.PrevCursor = encodeCursor(first)
+		}
+	}
+	return info, n
+}
+
+// offset converts a limit and a 1-based page number to a row offset
+func offset(limit, page int) int {
+	if page < 1 {
+		return 0
+	}
+	return (limit * page) - limit
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPasswordBytes is the most bcrypt hashes. Anything after it would
+// be ignored, so longer passwords are refused rather than cut short.
+const MaxPasswordBytes = 72
+
+// minPersonalLength is the shortest part of a name or email address
+// that a password may not contain, so short names like Al do not rule
+// out half the dictionary
+const minPersonalLength = 4
+
+// DefaultPasswordPolicy is used when no policy is configured
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      MaxPasswordBytes,
+	RejectPersonal: true,
+}
+
+// BreachedPasswords is a list of passwords known from data breaches
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
+// PasswordPolicy is what a password must be like. It applies whenever a
+// user sets their password: on signup, on update and on reset.
+type PasswordPolicy struct {
+	// MinLength is counted in characters
+	MinLength int
+	// MaxLength is counted in bytes, as bcrypt is, and is never more
+	// than MaxPasswordBytes
+	MaxLength int
+	// CharacterClasses is how many of lower case letters, upper case
+	// letters, digits and symbols a password must mix
+	CharacterClasses int
+	// RejectPersonal refuses passwords built from the user's name or
+	// email address
+	RejectPersonal bool
+	// Breached refuses passwords on the list when it is set
+	Breached BreachedPasswords
+}
+
+// PasswordErrorCode tells which rule of the PasswordPolicy a password
+// broke
+type PasswordErrorCode string
+
+// The rules a password can break
+const (
+	PasswordTooShort  PasswordErrorCode = "password_too_short"
+	PasswordTooLong   PasswordErrorCode = "password_too_long"
+	PasswordTooSimple PasswordErrorCode = "password_too_simple"
+	PasswordPersonal  PasswordErrorCode = "password_personal"
+	PasswordBreached  PasswordErrorCode = "password_breached"
+)
+
+// PasswordError is returned when a password does not meet the
+// PasswordPolicy. It is sent to clients as is, so that they can explain
+// the rule in their own words.
+type PasswordError struct {
+	Code PasswordErrorCode `json:"code"`
+	// Limit is the length or number of character classes the rule
+	// asks for, where there is one
+	Limit int `json:"limit,omitempty"`
+}
+
+func (e *PasswordError) Error() string {
+	switch e.Code {
+	case PasswordTooShort:
+		return fmt.Sprintf("password must be at least %d characters long", e.Limit)
+	case PasswordTooLong:
+		return fmt.Sprintf("password must be at most %d bytes long", e.Limit)
+	case PasswordTooSimple:
+		return fmt.Sprintf("password must mix at least %d of lower case letters, upper case letters, digits and symbols", e.Limit)
+	case PasswordPersonal:
+		return "password must not contain your name or email address"
+	case PasswordBreached:
+		return "password has appeared in a data breach, please choose another one"
+	default:
+		return "password is not allowed"
+	}
+}
+
+// Public returns the error message to show users
+func (e *PasswordError) Public() string {
+	return modelError(e.Error()).Public()
+}
+
+// Check returns a *PasswordError when user's new password breaks the
+// policy. Errors reading the breached password list are returned as is.
+func (p PasswordPolicy) Check(password string, user *User) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PasswordError{Code: PasswordTooShort, Limit: p.MinLength}
+	}
+	maxLength := p.MaxLength
+	if maxLength <= 0 || maxLength > MaxPasswordBytes {
+		maxLength = MaxPasswordBytes
+	}
+	if len(password) > maxLength {
+		return &PasswordError{Code: PasswordTooLong, Limit: maxLength}
+	}
+	if characterClasses(password) < p.CharacterClasses {
+		return &PasswordError{Code: PasswordTooSimple, Limit: p.CharacterClasses}
+	}
+	if p.RejectPersonal && personal(password, user) {
+		return &PasswordError{Code: PasswordPersonal}
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return &PasswordError{Code: PasswordBreached}
+		}
+	}
+	return nil
+}
+
+// characterClasses counts the classes of characters in password.
+// Letters without case, as in many scripts, count as lower case.
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsLetter(r):
+			lower = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// personal reports whether password contains a part of user's name or
+// email address, or is itself part of them, e.g. johnsmith for John
+// Smith
+func personal(password string, user *User) bool {
+	local := user.Email
+	if i := strings.LastIndexByte(local, '@'); i >= 0 {
+		local = local[:i]
+	}
+	plain := alphanumeric(password)
+	words := strings.FieldsFunc(strings.ToLower(local+" "+user.FirstName+" "+user.LastName), notAlphanumeric)
+	words = append(words, alphanumeric(local), alphanumeric(user.FirstName+user.LastName))
+	for _, word := range words {
+		if len(word) < minPersonalLength {
+			continue
+		}
+		if strings.Contains(plain, word) || (len(plain) >= minPersonalLength && strings.Contains(word, plain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// alphanumeric lower cases s and drops everything but letters and
+// digits
+func alphanumeric(s string) string {
+	return strings.Map(func(r rune) rune {
+		if notAlphanumeric(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+func notAlphanumeric(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
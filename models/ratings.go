@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	minRating = 1
+	maxRating = 5
+)
+
+// bookRatingColumns are the book columns derived from its reviews
+var bookRatingColumns = []string{
+	"rating_average",
+	"rating_count",
+	"rating_one",
+	"rating_two",
+	"rating_three",
+	"rating_four",
+	"rating_five",
+}
+
+// BookRating holds the aggregated star ratings of a book. It is
+// stored alongside the book and recalculated whenever one of the
+// book's reviews is created, updated or deleted.
+type BookRating struct {
+	Average float64 `gorm:"not null;default:0"`
+	Count   int     `gorm:"not null;default:0"`
+	One     int     `gorm:"not null;default:0"`
+	Two     int     `gorm:"not null;default:0"`
+	Three   int     `gorm:"not null;default:0"`
+	Four    int     `gorm:"not null;default:0"`
+	Five    int     `gorm:"not null;default:0"`
+}
+
+// Distribution returns the number of reviews given each star rating
+func (br BookRating) Distribution() map[string]int {
+	counts := []int{br.One, br.Two, br.Three, br.Four, br.Five}
+	dist := make(map[string]int, len(counts))
+	for i, n := range counts {
+		dist[strconv.Itoa(i+minRating)] = n
+	}
+	return dist
+}
+
+// MarshalJSON renders the rating as average, count and a
+// histogram keyed by star value
+func (br BookRating) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Average      float64        `json:"average"`
+		Count        int            `json:"count"`
+		Distribution map[string]int `json:"distribution"`
+	}{
+		Average:      br.Average,
+		Count:        br.Count,
+		Distribution: br.Distribution(),
+	})
+}
+
+// refreshBookRating recalculates the rating aggregate of a book
+// from its rated, non-deleted reviews
+func refreshBookRating(db *gorm.DB, bookID uint) error {
+	var (
+		avg    float64
+		rating BookRating
+	)
+	row := db.Table("reviews").
+		Select(`COALESCE(AVG(rating), 0), COUNT(*),
+			COALESCE(SUM(CASE WHEN rating = 1 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating = 2 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating = 3 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating = 4 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating = 5 THEN 1 ELSE 0 END), 0)`).
+		Where("book_id = ? AND rating > 0 AND deleted_at IS NULL", bookID).
+		Row()
+	err := row.Scan(&avg, &rating.Count, &rating.One, &rating.Two, &rating.Three, &rating.Four, &rating.Five)
+	if err != nil {
+		return err
+	}
+	rating.Average = math.Round(avg*100) / 100
+
+	return db.Model(&Book{ID: bookID}).UpdateColumns(map[string]interface{}{
+		"rating_average": rating.Average,
+		"rating_count":   rating.Count,
+		"rating_one":     rating.One,
+		"rating_two":     rating.Two,
+		"rating_three":   rating.Three,
+		"rating_four":    rating.Four,
+		"rating_five":    rating.Five,
+	}).Error
+}
+
+// refreshBookRatings recalculates the rating aggregate of every book
+func refreshBookRatings(db *gorm.DB, bookIDs []uint) error {
+	for _, id := range bookIDs {
+		if err := refreshBookRating(db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
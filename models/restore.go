@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RestoreWindow is how long after deletion a book, review or user
+// account can still be restored
+const RestoreWindow = 14 * 24 * time.Hour
+
+// restorable checks that a soft-deleted record is still within the
+// restore window
+func restorable(deletedAt *time.Time) error {
+	if deletedAt == nil {
+		return ErrNotFound
+	}
+	if time.Since(*deletedAt) > RestoreWindow {
+		return ErrRestoreExpired
+	}
+	return nil
+}
+
+// transaction runs fn inside a DB transaction. The transaction is
+// rolled back if fn returns an error and committed otherwise.
+func transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ReviewEdit is an earlier version of a review, kept whenever the
+// review's notes or rating are changed after it was published
+type ReviewEdit struct {
+	ID       uint      `gorm:"primary_key;auto_increment" json:"id"`
+	ReviewID uint      `gorm:"not null;index" json:"review_id"`
+	Notes    string    `gorm:"not null" json:"notes"`
+	Rating   int       `gorm:"not null;default:0" json:"rating"`
+	EditedAt time.Time `gorm:"not null" json:"edited_at"`
+}
@@ -8,15 +8,18 @@ import (
 
 // Review struct represents the structure of our reviews in the DB
 type Review struct {
-	ID        uint       `gorm:"primary_key;auto_increment" json:"id"`
-	UserID    uint       `gorm:"not_null;index;auto_preload" json:"user_id"`
-	BookID    uint       `gorm:"not_null;index;auto_preload" json:"book_id"`
-	Notes     string     `gorm:"not_null" json:"notes"`
-	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
-	DeletedAt *time.Time `gorm:"default:NULL" json:"deleted_at"`
-	User      User       `gorm:"ForeignKey:user_id"json:"user"`
-	Book      Book       `gorm:"ForeignKey:book_id"json:"book"`
+	ID        uint         `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint         `gorm:"not_null;index;auto_preload" json:"user_id"`
+	BookID    uint         `gorm:"not_null;index;auto_preload" json:"book_id"`
+	Notes     string       `gorm:"not_null" json:"notes"`
+	Rating    int          `gorm:"not null;default:0" json:"rating"`
+	CreatedAt time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	DeletedAt *time.Time   `gorm:"default:NULL" json:"deleted_at"`
+	EditedAt  *time.Time   `gorm:"default:NULL" json:"edited_at"`
+	History   []ReviewEdit `gorm:"-" json:"history,omitempty"`
+	User      User         `gorm:"ForeignKey:user_id" json:"user"`
+	Book      Book         `gorm:"ForeignKey:book_id" json:"book"`
 }
 
 // ReviewDB interface
@@ -25,8 +28,13 @@ type ReviewDB interface {
 	Create(review *Review) (*Review, error)
 	Update(review *Review) (*Review, error)
 	Delete(id uint) error
+	DeletedByID(id uint) (*Review, error)
+	Restore(id uint) error
 	ByUserID(id uint) ([]Review, error)
 	ByBookID(id uint) ([]Review, error)
+	// History returns the earlier versions of a review, most
+	// recent edit first.
+	History(reviewID uint) ([]ReviewEdit, error)
 }
 
 // NewReviewService tells the DB to create a new review
@@ -69,7 +77,8 @@ func (rv *reviewValidator) Create(review *Review) (*Review, error) {
 	err := runReviewValidationFunc(review,
 		rv.userIDRequired,
 		rv.bookIDRequired,
-		rv.reviewNotesRequired)
+		rv.reviewNotesRequired,
+		rv.ratingInRange)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +90,8 @@ func (rv *reviewValidator) Update(review *Review) (*Review, error) {
 	err := runReviewValidationFunc(review,
 		rv.userIDRequired,
 		rv.bookIDRequired,
-		rv.reviewNotesRequired)
+		rv.reviewNotesRequired,
+		rv.ratingInRange)
 	if err != nil {
 		return nil, err
 	}
@@ -96,6 +106,14 @@ func (rv *reviewValidator) Delete(id uint) error {
 	return rv.ReviewDB.Delete(id)
 }
 
+// Restore validator for restoring a deleted review
+func (rv *reviewValidator) Restore(id uint) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	return rv.ReviewDB.Restore(id)
+}
+
 // userIDRequired makes sure a userid is available while creating a review
 func (rv *reviewValidator) userIDRequired(r *Review) error {
 	if r.UserID <= 0 {
@@ -120,6 +138,14 @@ func (rv *reviewValidator) reviewNotesRequired(r *Review) error {
 	return nil
 }
 
+// ratingInRange makes sure a review carries a star rating between 1 and 5
+func (rv *reviewValidator) ratingInRange(r *Review) error {
+	if r.Rating < minRating || r.Rating > maxRating {
+		return ErrRatingInvalid
+	}
+	return nil
+}
+
 var _ ReviewDB = &reviewGorm{}
 
 // reviewGorm struct takes in the database
@@ -142,28 +168,94 @@ func (rg *reviewGorm) Create(review *Review) (*Review, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := refreshBookRating(rg.db, review.BookID); err != nil {
+		return nil, err
+	}
 	return review, nil
 }
 
-// Update func updates a review in the DB
+// Update func updates a review in the DB. When the notes or rating
+// change, the previous version is kept in the review's edit history
+// and the review is marked as edited.
 func (rg *reviewGorm) Update(review *Review) (*Review, error) {
-	err := rg.db.Save(&review).Error
+	err := transaction(rg.db, func(tx *gorm.DB) error {
+		var current Review
+		if err := first(tx.Where("id = ?", review.ID), &current); err != nil {
+			return err
+		}
+		if current.Notes != review.Notes || current.Rating != review.Rating {
+			now := gorm.NowFunc()
+			edit := ReviewEdit{
+				ReviewID: current.ID,
+				Notes:    current.Notes,
+				Rating:   current.Rating,
+				EditedAt: now,
+			}
+			if err := tx.Create(&edit).Error; err != nil {
+				return err
+			}
+			review.EditedAt = &now
+		}
+		// the preloaded user and book are read-only here
+		if err := tx.Set("gorm:save_associations", false).Save(review).Error; err != nil {
+			return err
+		}
+		return refreshBookRating(tx, review.BookID)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return review, nil
 }
 
-// Delete will delete the review with the provided ID
+// Delete will delete the review with the provided ID and
+// recalculate the rating of the book it belonged to
 func (rg *reviewGorm) Delete(id uint) error {
-	review := Review{ID: id}
-	return rg.db.Delete(&review).Error
+	var review Review
+	if err := first(rg.db.Where("id = ?", id), &review); err != nil {
+		return err
+	}
+	if err := rg.db.Delete(&review).Error; err != nil {
+		return err
+	}
+	return refreshBookRating(rg.db, review.BookID)
+}
+
+// DeletedByID gets a soft-deleted review by it's ID
+func (rg *reviewGorm) DeletedByID(id uint) (*Review, error) {
+	var review Review
+	err := first(rg.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id), &review)
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// Restore brings back a deleted review, as long as it is within
+// RestoreWindow and the book it belongs to has not been deleted
+func (rg *reviewGorm) Restore(id uint) error {
+	review, err := rg.DeletedByID(id)
+	if err != nil {
+		return err
+	}
+	if err := restorable(review.DeletedAt); err != nil {
+		return err
+	}
+	var book Book
+	if err := first(rg.db.Where("id = ?", review.BookID), &book); err != nil {
+		return err
+	}
+	err = rg.db.Unscoped().Model(&Review{}).Where("id = ?", id).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		return err
+	}
+	return refreshBookRating(rg.db, review.BookID)
 }
 
 // ByUserID fetches all reviews by a user
 func (rg *reviewGorm) ByUserID(userID uint) ([]Review, error) {
 	var reviews []Review
-	err := rg.db.Where("user_id = ?", userID).Find(&reviews).Error
+	err := rg.db.Preload("User").Preload("Book").Where("user_id = ?", userID).Order("created_at DESC", true).Find(&reviews).Error
 	if err != nil {
 		return nil, err
 	}
@@ -180,6 +272,16 @@ func (rg *reviewGorm) ByBookID(bookID uint) ([]Review, error) {
 	return reviews, nil
 }
 
+// History fetches the earlier versions of a review
+func (rg *reviewGorm) History(reviewID uint) ([]ReviewEdit, error) {
+	var edits []ReviewEdit
+	err := rg.db.Where("review_id = ?", reviewID).Order("edited_at DESC", true).Find(&edits).Error
+	if err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
 // First will query using the provided gorm.DB and it will
 // get the first item returned and place it into dst. If
 // nothing is found in the query, it will return ErrNotFound
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Role decides what a user is allowed to do beyond managing their
+// own content
+type Role string
+
+// The roles a user can hold, from least to most privileged
+const (
+	// RoleReader can only manage their own books and reviews
+	RoleReader Role = "reader"
+
+	// RoleModerator can also edit and remove any book or review
+	RoleModerator Role = "moderator"
+
+	// RoleAdmin can also list, suspend and change the role of users
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders the roles so that higher roles include the
+// permissions of the lower ones
+var roleRanks = map[Role]int{
+	RoleReader:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// HasRole reports whether the user holds the given role or a higher one
+func (u *User) HasRole(role Role) bool {
+	return roleRanks[u.Role] >= roleRanks[role]
+}
+
+// Suspended reports whether the user's account has been suspended
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// SetRole changes the role of the user with the provided ID
+func (us *userService) SetRole(id uint, role Role) (*User, error) {
+	user, err := us.ByID(id)
+	if err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return us.Update(user)
+}
+
+// Suspend stops the user with the provided ID from signing in
+func (us *userService) Suspend(id uint) (*User, error) {
+	user, err := us.ByID(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user.SuspendedAt = &now
+	return us.Update(user)
+}
+
+// Unsuspend lets a suspended user sign in again
+func (us *userService) Unsuspend(id uint) (*User, error) {
+	user, err := us.ByID(id)
+	if err != nil {
+		return nil, err
+	}
+	user.SuspendedAt = nil
+	return us.Update(user)
+}
+
+// defaultRole makes new users readers unless a role was assigned
+func (uv *userValidator) defaultRole(user *User) error {
+	if user.Role == "" {
+		user.Role = RoleReader
+	}
+	return nil
+}
+
+// roleValid makes sure a user holds one of the known roles
+func (uv *userValidator) roleValid(user *User) error {
+	if !user.Role.Valid() {
+		return ErrRoleInvalid
+	}
+	return nil
+}
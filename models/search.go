@@ -0,0 +1,124 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// bookDocument is the weighted text search document of a book. It must
+// match the expression of the books_search_idx index, created in
+// migrations/0001_baseline.up.sql, so that Postgres can use the index
+// when searching.
+const bookDocument = `setweight(to_tsvector('english', coalesce(books.title, '')), 'A') || ` +
+	`setweight(to_tsvector('english', coalesce(books.author, '')), 'A') || ` +
+	`setweight(to_tsvector('english', coalesce(books.category, '')), 'B') || ` +
+	`setweight(to_tsvector('english', coalesce(books.summary, '')), 'C')`
+
+// reviewDocument is the text search document of a review
+const reviewDocument = `to_tsvector('english', coalesce(reviews.notes, ''))`
+
+// BookSearch holds the parameters of a full-text book search
+type BookSearch struct {
+	Query          string
+	IncludeReviews bool
+	Limit          int
+	Page           int
+}
+
+// bookSearcher runs full-text searches against the books table. It
+// returns a page of the matching books and how many match in all.
+type bookSearcher interface {
+	Search(s BookSearch) ([]Book, int, error)
+}
+
+// newBookSearcher picks the search implementation for the DB driver.
+// Postgres gets ranked tsvector search, every other driver falls back
+// to a portable LIKE based search.
+func newBookSearcher(db *gorm.DB) bookSearcher {
+	if isPostgres(db) {
+		return &pgBookSearch{db}
+	}
+	return &likeBookSearch{db}
+}
+
+// isPostgres reports whether the connection uses the postgres dialect
+func isPostgres(db *gorm.DB) bool {
+	return db.Dialect().GetName() == "postgres"
+}
+
+// pgBookSearch searches books with Postgres full-text search
+type pgBookSearch struct {
+	db *gorm.DB
+}
+
+// Search returns books matching the query, most relevant first
+func (pg *pgBookSearch) Search(s BookSearch) ([]Book, int, error) {
+	match := bookDocument + " @@ query"
+	rank := "ts_rank(" + bookDocument + ", query)"
+	if s.IncludeReviews {
+		match = "(" + match + " OR books.id IN (SELECT reviews.book_id FROM reviews " +
+			"WHERE reviews.deleted_at IS NULL AND " + reviewDocument + " @@ query))"
+		rank += " + COALESCE((SELECT MAX(ts_rank(" + reviewDocument + ", query)) FROM reviews " +
+			"WHERE reviews.book_id = books.id AND reviews.deleted_at IS NULL), 0) * 0.5"
+	}
+
+	matches := pg.db.Model(&Book{}).
+		Joins("CROSS JOIN plainto_tsquery('english', ?) query", s.Query).
+		Where(match)
+	var total int
+	if err := matches.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var books []Book
+	err := matches.Preload("User").Select("books.*").
+		Order(rank + " DESC").
+		Order("books.created_at DESC").
+		Limit(s.Limit).Offset(offset(s.Limit, s.Page)).
+		Find(&books).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// likeBookSearch searches books with case-insensitive LIKE matching
+type likeBookSearch struct {
+	db *gorm.DB
+}
+
+// Search returns books matching the query. Matches on the title and
+// author rank above matches on the category, summary or reviews.
+func (ls *likeBookSearch) Search(s BookSearch) ([]Book, int, error) {
+	pattern := "%" + strings.ToLower(s.Query) + "%"
+	match := "LOWER(books.title) LIKE ? OR LOWER(books.author) LIKE ? OR " +
+		"LOWER(books.category) LIKE ? OR LOWER(books.summary) LIKE ?"
+	rank := "CASE WHEN LOWER(books.title) LIKE ? THEN 4 ELSE 0 END + " +
+		"CASE WHEN LOWER(books.author) LIKE ? THEN 3 ELSE 0 END + " +
+		"CASE WHEN LOWER(books.category) LIKE ? THEN 2 ELSE 0 END + " +
+		"CASE WHEN LOWER(books.summary) LIKE ? THEN 1 ELSE 0 END"
+	args := []interface{}{pattern, pattern, pattern, pattern}
+	if s.IncludeReviews {
+		match += " OR books.id IN (SELECT reviews.book_id FROM reviews " +
+			"WHERE reviews.deleted_at IS NULL AND LOWER(reviews.notes) LIKE ?)"
+		args = append(args, pattern)
+	}
+
+	matches := ls.db.Model(&Book{}).Where("("+match+")", args...)
+	var total int
+	if err := matches.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var books []Book
+	err := matches.Preload("User").
+		Order(gorm.Expr(rank+" DESC", pattern, pattern, pattern, pattern)).
+		Order("books.created_at DESC").
+		Limit(s.Limit).Offset(offset(s.Limit, s.Page)).
+		Find(&books).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
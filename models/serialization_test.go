@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretKeys must never appear in an API response
+var secretKeys = []string{
+	"password", "password_hash",
+	"remember", "remember_hash",
+	"token_hash", "code_hash",
+	"secret", "two_factor_secret",
+	"recovery_code", "recovery_codes",
+	"payload",
+}
+
+// secretValue is put in every credential field, so that it shows up in
+// the output however it is renamed
+const secretValue = "sentinel-secret"
+
+func secretUser() User {
+	now := time.Now()
+	return User{
+		ID:               1,
+		FirstName:        "Ada",
+		LastName:         "Lovelace",
+		Email:            "ada@example.com",
+		Password:         secretValue,
+		PasswordHash:     secretValue,
+		Role:             RoleAdmin,
+		TwoFactorEnabled: true,
+		SuspendedAt:      &now,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+}
+
+// jsonKeys collects every object key in the JSON document
+func jsonKeys(t *testing.T, data []byte) map[string]bool {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				keys[key] = true
+				walk(value)
+			}
+		case []interface{}:
+			for _, value := range v {
+				walk(value)
+			}
+		}
+	}
+	walk(doc)
+	return keys
+}
+
+func TestResponsesHideSecrets(t *testing.T) {
+	user := secretUser()
+	book := Book{ID: 2, UserID: 1, Title: "Notes", User: user}
+	review := Review{ID: 3, UserID: 1, BookID: 2, Notes: "Good", User: user, Book: book}
+	book.Reviews = []Review{review}
+
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"user", user},
+		{"user pointer", &user},
+		{"public user", user.Public()},
+		{"self user", user.Self()},
+		{"self users", SelfUsers([]User{user})},
+		{"book", book},
+		{"review", review},
+		{"session", Session{ID: 4, UserID: 1, Token: secretValue, TokenHash: secretValue}},
+		{"api token", APIToken{ID: 5, UserID: 1, Name: "cli", TokenHash: secretValue, Scopes: Scopes{ScopeBooksRead}}},
+		{"job", Job{ID: 6, Queue: "email", Payload: secretValue, Status: JobDead, LastError: "smtp: timeout"}},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		keys := jsonKeys(t, data)
+		for _, key := range secretKeys {
+			if keys[key] {
+				t.Errorf("%s: %s has key %q", tt.name, data, key)
+			}
+		}
+		if strings.Contains(string(data), secretValue) {
+			t.Errorf("%s: %s has a secret value", tt.name, data)
+		}
+	}
+}
+
+func TestNewAPITokenShowsTokenOnce(t *testing.T) {
+	data, err := json.Marshal(APIToken{ID: 5, Name: "cli", Token: "raw-token", TokenHash: secretValue})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := jsonKeys(t, data)
+	if !keys["token"] || keys["token_hash"] || strings.Contains(string(data), secretValue) {
+		t.Errorf("new token = %s, want the raw token and not its hash", data)
+	}
+}
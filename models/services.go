@@ -1,40 +1,65 @@
 package models
 
 import (
-	"os"
+	"database/sql"
 
 	"github.com/jinzhu/gorm"
 	// we want to keep the postgres dialect even though we are not using it directly
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 )
 
+// ServicesConfig holds the secrets and settings the services need
+// besides a database connection
+type ServicesConfig struct {
+	// Pepper is appended to passwords before they are hashed
+	Pepper string
+	// HMACKey signs the hashes of remember, session, reset and API tokens
+	HMACKey string
+	// PasswordPolicy is checked whenever a user sets a password.
+	// DefaultPasswordPolicy is used when it is left empty.
+	PasswordPolicy *PasswordPolicy
+	// LogDB logs every SQL statement
+	LogDB bool
+}
+
 // NewServices is reponsible for connecting all our services to the DB
-func NewServices(dbDriver, connectionInfo string) (*Services, error) {
+func NewServices(dbDriver, connectionInfo string, cfg ServicesConfig) (*Services, error) {
 	db, err := gorm.Open(dbDriver, connectionInfo)
 	if err != nil {
 		return nil, err
 	}
-	var logDB bool
-	if os.Getenv("APP_ENV") == "production" {
-		logDB = false
-	} else {
-		logDB = true
+	db.LogMode(cfg.LogDB)
+	policy := DefaultPasswordPolicy
+	if cfg.PasswordPolicy != nil {
+		policy = *cfg.PasswordPolicy
 	}
-	db.LogMode(logDB)
+	us := NewUserService(db, cfg.Pepper, cfg.HMACKey, policy)
 	return &Services{
-		User: NewUserService(db),
-		Book: NewBookService(db),
-		Review: NewReviewService(db),
-		db: db,
+		User:         us,
+		TwoFactor:    NewTwoFactorService(db, us, cfg.HMACKey),
+		Identity:     NewIdentityService(db, us),
+		Book:         NewBookService(db),
+		Review:       NewReviewService(db),
+		Session:      NewSessionService(db, cfg.HMACKey),
+		APIToken:     NewAPITokenService(db, cfg.HMACKey),
+		Job:          NewJobService(db),
+		Notification: NewNotificationService(db),
+		db:           db,
 	}, nil
 }
 
 // Services struct encompasses all of our services and their structures
 type Services struct {
-	User	UserService
-	Book	BookService
-	Review	ReviewService
-	db	*gorm.DB
+	User         UserService
+	TwoFactor    TwoFactorService
+	Identity     IdentityService
+	Book         BookService
+	Review       ReviewService
+	Session      SessionService
+	APIToken     APITokenService
+	Job          JobService
+	Notification NotificationService
+	db           *gorm.DB
 }
 
 // Close closes the database connection
@@ -42,16 +67,7 @@ func (s *Services) Close() error {
 	return s.db.Close()
 }
 
-// DestructiveReset drops the tables and rebuilds it
-func (s *Services) DestructiveReset() error {
-	err := s.db.DropTableIfExists(&User{}, &Book{}, &Review{}, &pwReset{}).Error
-	if err != nil {
-		return err
-	}
-	return s.AutoMigrate()
+// DB returns the underlying connection, e.g. to run migrations on
+func (s *Services) DB() *sql.DB {
+	return s.db.DB()
 }
-
-// AutoMigrate will attempt to automatically migrate the tables
-func (s *Services) AutoMigrate() error {
-	return s.db.AutoMigrate(&User{}, &Book{}, &Review{}, &pwReset{}).Error
-}
\ No newline at end of file
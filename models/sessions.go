@@ -0,0 +1,214 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sajicode/go-book/hash"
+	"github.com/sajicode/go-book/rand"
+)
+
+const (
+	// SessionDuration is how long a device stays signed in
+	SessionDuration = 30 * 24 * time.Hour
+
+	// sessionTouchInterval limits how often LastSeenAt is written
+	sessionTouchInterval = 5 * time.Minute
+)
+
+// Session is a device a user is signed in on. The raw token only
+// lives in the device's cookie; we store its HMAC.
+type Session struct {
+	ID         uint      `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint      `gorm:"not null;index" json:"-"`
+	Token      string    `gorm:"-" json:"-"`
+	TokenHash  string    `gorm:"not null;unique_index" json:"-"`
+	UserAgent  string    `gorm:"size:512" json:"user_agent"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+	Current    bool      `gorm:"-" json:"current"`
+}
+
+// SessionDB is used to interact with the sessions table
+type SessionDB interface {
+	// ByToken looks up an unexpired session by its raw token
+	ByToken(token string) (*Session, error)
+	ByUserID(userID uint) ([]Session, error)
+	Create(session *Session) error
+	// Touch records that the session was just used
+	Touch(session *Session) error
+	Delete(id uint) error
+	// DeleteByUserID signs the user out of every device
+	DeleteByUserID(userID uint) error
+}
+
+// SessionService is a set of methods used to work with sessions
+type SessionService interface {
+	SessionDB
+}
+
+// NewSessionService handles connection to the DB
+func NewSessionService(db *gorm.DB, hmacKey string) SessionService {
+	return &sessionService{
+		SessionDB: newSessionValidator(&sessionGorm{db}, hash.NewHMAC(hmacKey)),
+	}
+}
+
+type sessionService struct {
+	SessionDB
+}
+
+func newSessionValidator(db SessionDB, hmac hash.HMAC) *sessionValidator {
+	return &sessionValidator{
+		SessionDB: db,
+		hmac:      hmac,
+	}
+}
+
+type sessionValidator struct {
+	SessionDB
+	hmac hash.HMAC
+}
+
+func (sv *sessionValidator) ByToken(token string) (*Session, error) {
+	session := Session{Token: token}
+	err := runSessionValFns(&session, sv.requireToken, sv.hmacToken)
+	if err != nil {
+		return nil, err
+	}
+	return sv.SessionDB.ByToken(session.TokenHash)
+}
+
+func (sv *sessionValidator) Create(session *Session) error {
+	err := runSessionValFns(session,
+		sv.requireUserID,
+		sv.setTokenIfUnset,
+		sv.hmacToken,
+		sv.setExpiryIfUnset,
+	)
+	if err != nil {
+		return err
+	}
+	return sv.SessionDB.Create(session)
+}
+
+func (sv *sessionValidator) Touch(session *Session) error {
+	if time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+	return sv.SessionDB.Touch(session)
+}
+
+func (sv *sessionValidator) Delete(id uint) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	return sv.SessionDB.Delete(id)
+}
+
+func (sv *sessionValidator) DeleteByUserID(userID uint) error {
+	if userID <= 0 {
+		return ErrUserIDRequired
+	}
+	return sv.SessionDB.DeleteByUserID(userID)
+}
+
+func (sv *sessionValidator) requireUserID(s *Session) error {
+	if s.UserID <= 0 {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+func (sv *sessionValidator) requireToken(s *Session) error {
+	if s.Token == "" {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (sv *sessionValidator) setTokenIfUnset(s *Session) error {
+	if s.Token != "" {
+		return nil
+	}
+	token, err := rand.RememberToken()
+	if err != nil {
+		return err
+	}
+	s.Token = token
+	return nil
+}
+
+func (sv *sessionValidator) hmacToken(s *Session) error {
+	if s.Token == "" {
+		return nil
+	}
+	s.TokenHash = sv.hmac.Hash(s.Token)
+	return nil
+}
+
+func (sv *sessionValidator) setExpiryIfUnset(s *Session) error {
+	now := time.Now()
+	if s.LastSeenAt.IsZero() {
+		s.LastSeenAt = now
+	}
+	if s.ExpiresAt.IsZero() {
+		s.ExpiresAt = now.Add(SessionDuration)
+	}
+	return nil
+}
+
+type sessionValFn func(*Session) error
+
+func runSessionValFns(s *Session, fns ...sessionValFn) error {
+	for _, fn := range fns {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ SessionDB = &sessionGorm{}
+
+type sessionGorm struct {
+	db *gorm.DB
+}
+
+func (sg *sessionGorm) ByToken(tokenHash string) (*Session, error) {
+	var session Session
+	err := first(sg.db.Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now()), &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (sg *sessionGorm) ByUserID(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := sg.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (sg *sessionGorm) Create(session *Session) error {
+	return sg.db.Create(session).Error
+}
+
+func (sg *sessionGorm) Touch(session *Session) error {
+	session.LastSeenAt = time.Now()
+	return sg.db.Model(session).UpdateColumn("last_seen_at", session.LastSeenAt).Error
+}
+
+func (sg *sessionGorm) Delete(id uint) error {
+	return sg.db.Where("id = ?", id).Delete(&Session{}).Error
+}
+
+func (sg *sessionGorm) DeleteByUserID(userID uint) error {
+	return sg.db.Where("user_id = ?", userID).Delete(&Session{}).Error
+}
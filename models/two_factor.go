@@ -0,0 +1,454 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sajicode/go-book/hash"
+	"github.com/sajicode/go-book/rand"
+	"github.com/sajicode/go-book/totp"
+)
+
+const (
+	// TwoFactorIssuer names the app in authenticator apps
+	TwoFactorIssuer = "Literary Reviews"
+
+	// RecoveryCodeCount is how many recovery codes a user is given
+	RecoveryCodeCount = 10
+
+	// ChallengeDuration is how long a user has to enter their code
+	// after their password was accepted
+	ChallengeDuration = 5 * time.Minute
+
+	// challengeAttempts is how many codes can be tried on a challenge
+	// before the password has to be entered again
+	challengeAttempts = 5
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// twoFactor holds the TOTP secret of a user, encrypted. It is
+// unconfirmed until the user enters a code from their app.
+type twoFactor struct {
+	ID          uint   `gorm:"primary_key;auto_increment"`
+	UserID      uint   `gorm:"not null;unique_index"`
+	Secret      string `gorm:"not null"`
+	ConfirmedAt *time.Time
+	// LastStep is the step of the last code accepted, so that a code
+	// cannot be used twice
+	LastStep  int64 `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// recoveryCode is a single use code for signing in without the
+// authenticator app. Only its hash is stored.
+type recoveryCode struct {
+	ID        uint   `gorm:"primary_key;auto_increment"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;unique_index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// loginChallenge is handed out once the password of a user with
+// two-factor authentication on was accepted, and traded for a session
+// along with a code
+type loginChallenge struct {
+	ID        uint   `gorm:"primary_key;auto_increment"`
+	UserID    uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"not null;unique_index"`
+	Attempts  int    `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+// TwoFactorEnrollment is what a user needs to add their account to an
+// authenticator app, either by scanning URI as a QR code or by typing
+// Secret
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TwoFactorStatus tells a user whether two-factor authentication is on
+// and how many recovery codes they have left
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorService manages TOTP two-factor authentication and the
+// second step of logging in that it adds
+type TwoFactorService interface {
+	Status(user *User) (*TwoFactorStatus, error)
+	// Enroll creates a new secret for user, replacing one that was
+	// never confirmed. Two-factor authentication stays off until
+	// Confirm is called with a code from the authenticator app.
+	Enroll(user *User) (*TwoFactorEnrollment, error)
+	// Confirm turns two-factor authentication on and returns the
+	// recovery codes, which are never shown again
+	Confirm(user *User, code string) ([]string, error)
+	// Disable turns two-factor authentication off. code is either a
+	// code from the app or a recovery code.
+	Disable(user *User, code string) (*User, error)
+	// RegenerateRecoveryCodes replaces every recovery code of user
+	RegenerateRecoveryCodes(user *User, code string) ([]string, error)
+	// Challenge starts the second step of logging in for user,
+	// returning a token for CompleteChallenge
+	Challenge(user *User) (string, error)
+	// CompleteChallenge returns the user the challenge was created
+	// for once given a valid code or recovery code
+	CompleteChallenge(token, code string) (*User, error)
+	// Reset turns two-factor authentication off for a user who lost
+	// their device and recovery codes. It is used by admins.
+	Reset(userID uint) (*User, error)
+}
+
+// NewTwoFactorService creates a TwoFactorService. The TOTP secrets are
+// encrypted with a key derived from hmacKey.
+func NewTwoFactorService(db *gorm.DB, users UserDB, hmacKey string) TwoFactorService {
+	key := sha256.Sum256([]byte("two-factor secrets:" + hmacKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		//* a 32 byte key is always valid
+		panic(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &twoFactorService{
+		db:    db,
+		users: users,
+		hmac:  hash.NewHMAC(hmacKey),
+		gcm:   gcm,
+	}
+}
+
+var _ TwoFactorService = &twoFactorService{}
+
+type twoFactorService struct {
+	db    *gorm.DB
+	users UserDB
+	hmac  hash.HMAC
+	gcm   cipher.AEAD
+}
+
+func (tfs *twoFactorService) Status(user *User) (*TwoFactorStatus, error) {
+	status := TwoFactorStatus{Enabled: user.TwoFactorEnabled}
+	if !user.TwoFactorEnabled {
+		return &status, nil
+	}
+	err := tfs.db.Model(&recoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&status.RecoveryCodesLeft).Error
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (tfs *twoFactorService) Enroll(user *User) (*TwoFactorEnrollment, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := tfs.seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	err = transaction(tfs.db, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&twoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&twoFactor{UserID: user.ID, Secret: sealed}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(TwoFactorIssuer, user.Email, secret),
+	}, nil
+}
+
+func (tfs *twoFactorService) Confirm(user *User, code string) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	tf, err := tfs.byUserID(user.ID)
+	if err == ErrNotFound {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tfs.checkCode(tf, code); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tf.ConfirmedAt = &now
+	if err := tfs.db.Save(tf).Error; err != nil {
+		return nil, err
+	}
+	codes, err := tfs.replaceRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactorEnabled = true
+	if _, err := tfs.users.Update(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (tfs *twoFactorService) Disable(user *User, code string) (*User, error) {
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := tfs.verify(user.ID, code); err != nil {
+		return nil, err
+	}
+	return tfs.Reset(user.ID)
+}
+
+func (tfs *twoFactorService) RegenerateRecoveryCodes(user *User, code string) ([]string, error) {
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := tfs.verify(user.ID, code); err != nil {
+		return nil, err
+	}
+	return tfs.replaceRecoveryCodes(user.ID)
+}
+
+func (tfs *twoFactorService) Challenge(user *User) (string, error) {
+	token, err := rand.RememberToken()
+	if err != nil {
+		return "", err
+	}
+	challenge := loginChallenge{
+		UserID:    user.ID,
+		TokenHash: tfs.hmac.Hash(token),
+	}
+	if err := tfs.db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (tfs *twoFactorService) CompleteChallenge(token, code string) (*User, error) {
+	if token == "" {
+		return nil, ErrChallengeInvalid
+	}
+	var challenge loginChallenge
+	err := first(tfs.db.Where("token_hash = ?", tfs.hmac.Hash(token)), &challenge)
+	if err == ErrNotFound {
+		return nil, ErrChallengeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(challenge.CreatedAt) > ChallengeDuration {
+		tfs.db.Delete(&challenge)
+		return nil, ErrChallengeInvalid
+	}
+
+	//* the attempt is taken before the code is checked, so that guesses
+	//* sent at the same time cannot all get in under the limit
+	res := tfs.db.Model(&loginChallenge{}).
+		Where("id = ? AND attempts < ?", challenge.ID, challengeAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		tfs.db.Delete(&challenge)
+		return nil, ErrChallengeInvalid
+	}
+	if err := tfs.verify(challenge.UserID, code); err != nil {
+		return nil, err
+	}
+	//* only one request may complete the challenge
+	res = tfs.db.Delete(&challenge)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrChallengeInvalid
+	}
+	user, err := tfs.users.ByID(challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Suspended() {
+		return nil, ErrAccountSuspended
+	}
+	return user, nil
+}
+
+func (tfs *twoFactorService) Reset(userID uint) (*User, error) {
+	user, err := tfs.users.ByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	err = transaction(tfs.db, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&twoFactor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&recoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&loginChallenge{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactorEnabled = false
+	return tfs.users.Update(user)
+}
+
+func (tfs *twoFactorService) byUserID(userID uint) (*twoFactor, error) {
+	var tf twoFactor
+	err := first(tfs.db.Where("user_id = ?", userID), &tf)
+	if err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// verify accepts either a code from the app of a user with two-factor
+// authentication on, or one of their unused recovery codes
+func (tfs *twoFactorService) verify(userID uint, code string) error {
+	tf, err := tfs.byUserID(userID)
+	if err == ErrNotFound {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if tf.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	if len(normalizeRecoveryCode(code)) == totp.Digits {
+		return tfs.checkCode(tf, code)
+	}
+	return tfs.useRecoveryCode(userID, code)
+}
+
+// checkCode accepts a code from the app that has not been used yet
+func (tfs *twoFactorService) checkCode(tf *twoFactor, code string) error {
+	secret, err := tfs.open(tf.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), tf.LastStep)
+	if !ok {
+		return ErrTwoFactorCodeInvalid
+	}
+	//* only move forward, in case another request used a later code
+	result := tfs.db.Model(&twoFactor{}).
+		Where("id = ? AND last_step < ?", tf.ID, step).
+		Update("last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	tf.LastStep = step
+	return nil
+}
+
+// useRecoveryCode marks code used if it is an unused recovery code of
+// the user
+func (tfs *twoFactorService) useRecoveryCode(userID uint, code string) error {
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrTwoFactorCodeInvalid
+	}
+	result := tfs.db.Model(&recoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, tfs.hmac.Hash(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and
+// creates RecoveryCodeCount new ones, returned in plain text
+func (tfs *twoFactorService) replaceRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b, err := rand.Bytes(5)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	err := transaction(tfs.db, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&recoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			rc := recoveryCode{UserID: userID, CodeHash: tfs.hmac.Hash(normalizeRecoveryCode(code))}
+			if err := tx.Create(&rc).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// seal encrypts a TOTP secret for storage
+func (tfs *twoFactorService) seal(secret string) (string, error) {
+	nonce, err := rand.Bytes(tfs.gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := tfs.gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a TOTP secret sealed by seal
+func (tfs *twoFactorService) open(sealed string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	size := tfs.gcm.NonceSize()
+	if len(b) < size {
+		return "", ErrTwoFactorSecretInvalid
+	}
+	secret, err := tfs.gcm.Open(nil, b[:size], b[size:], nil)
+	if err != nil {
+		return "", ErrTwoFactorSecretInvalid
+	}
+	return string(secret), nil
+}
+
+// normalizeRecoveryCode drops the separators and case users may type
+// a code with
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
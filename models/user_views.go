@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PublicUser is the view of a user that anyone may see. It is what
+// a User serializes to, so users nested in books and reviews never
+// carry more than this.
+type PublicUser struct {
+	ID        uint      `json:"id"`
+	Avatar    string    `json:"avatar"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Bio       string    `json:"bio"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SelfUser is the view of a user shown to the user themselves and to
+// admins. It adds account details but never credentials.
+type SelfUser struct {
+	PublicUser
+	Email            string           `json:"email"`
+	EmailVerified    bool             `json:"email_verified"`
+	Locale           string           `json:"locale"`
+	Role             Role             `json:"role"`
+	NotifyPreference NotifyPreference `json:"notify_preference"`
+	SuspendedAt      *time.Time       `json:"suspended_at"`
+	TwoFactorEnabled bool             `json:"two_factor_enabled"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// Public returns the public view of the user
+func (u User) Public() PublicUser {
+	return PublicUser{
+		ID:        u.ID,
+		Avatar:    u.Avatar,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Bio:       u.Bio,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+// Self returns the view of the user for the account owner
+func (u User) Self() SelfUser {
+	return SelfUser{
+		PublicUser:       u.Public(),
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerified,
+		Locale:           u.Locale,
+		Role:             u.Role,
+		NotifyPreference: u.NotifyPreference,
+		SuspendedAt:      u.SuspendedAt,
+		TwoFactorEnabled: u.TwoFactorEnabled,
+		UpdatedAt:        u.UpdatedAt,
+	}
+}
+
+// SelfUsers returns the account owner view of every user
+func SelfUsers(users []User) []SelfUser {
+	views := make([]SelfUser, len(users))
+	for i, user := range users {
+		views[i] = user.Self()
+	}
+	return views
+}
+
+// MarshalJSON always renders a user through its public view so that
+// no private field can reach an API response by accident
+func (u User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.Public())
+}
@@ -1,40 +1,46 @@
 package models
 
 import (
-	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/sajicode/go-book/hash"
-	"github.com/sajicode/go-book/rand"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var userPwPepper = os.Getenv("USER_PASSWORD_PEPPER")
-var hmacSecretKey = os.Getenv("HMAC_SECRET_KEY")
+// DefaultLocale is the language used for users who have not chosen one
+const DefaultLocale = "en"
 
 // User represents the user model stored in our database
 // This is used for user accounts, storing both an email
 // address and a password so users can log in and gain
 // access to their content.
 type User struct {
-	ID           uint       `gorm:"primary_key;auto_increment" json:"id"`
-	Avatar       string     `gorm:"size:255;null;DEFAULT:'https://res.cloudinary.com/sajicode/image/upload/v1549973773/avatar.png'" json:"avatar"`
-	FirstName    string     `gorm:"size:255;not null" json:"first_name"`
-	LastName     string     `gorm:"size:255;not null" json:"last_name"`
-	Email        string     `gorm:"not null;unique_index" json:"email"`
-	Bio          string     `gorm:"default:NULL" json:"bio"`
-	Password     string     `gorm:"-" json:"password"`
-	PasswordHash string     `gorm:"not null" json:"password_hash"`
-	Remember     string     `gorm:"-" json:"remember"`
-	RememberHash string     `gorm:"not null;unique_index" json:"remember_hash"`
-	CreatedAt    time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt    time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
-	DeletedAt    *time.Time `gorm:"default:NULL" json:"deleted_at"`
-	Books        []Book     `gorm:"-" json:"books"`
-	Reviews      []Review   `gorm:"-" json:"reviews"`
+	ID               uint             `gorm:"primary_key;auto_increment" json:"id"`
+	Avatar           string           `gorm:"size:255;null;DEFAULT:'https://res.cloudinary.com/sajicode/image/upload/v1549973773/avatar.png'" json:"avatar"`
+	FirstName        string           `gorm:"size:255;not null" json:"first_name"`
+	LastName         string           `gorm:"size:255;not null" json:"last_name"`
+	Email            string           `gorm:"not null;unique_index" json:"email"`
+	EmailVerified    bool             `gorm:"not null;default:false" json:"email_verified"`
+	Locale           string           `gorm:"size:16;not null;default:'en'" json:"locale"`
+	Bio              string           `gorm:"default:NULL" json:"bio"`
+	Password         string           `gorm:"-" json:"-"`
+	PasswordHash     string           `gorm:"not null" json:"-"`
+	Role             Role             `gorm:"not null;default:'reader'" json:"role"`
+	NotifyPreference NotifyPreference `gorm:"size:16;not null;default:'immediate'" json:"notify_preference"`
+	SuspendedAt      *time.Time       `gorm:"default:NULL" json:"suspended_at"`
+	TwoFactorEnabled bool             `gorm:"not null;default:false" json:"-"`
+	CreatedAt        time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt        time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	DeletedAt        *time.Time       `gorm:"default:NULL" json:"deleted_at"`
+	Books            []Book           `gorm:"-" json:"-"`
+	Reviews          []Review         `gorm:"-" json:"-"`
+
+	// generatedPassword marks a random Password chosen by us rather
+	// than the user, which the PasswordPolicy does not apply to
+	generatedPassword bool
 }
 
 // UserDB is used to interact with the users database.
@@ -52,13 +58,14 @@ type UserDB interface {
 	// Methods for querying for single users
 	ByID(id uint) (*User, error)
 	ByEmail(email string) (*User, error)
-	ByRemember(token string) (*User, error)
 
 	// Methods for altering users
 	Create(user *User) (*User, error)
 	Update(user *User) (*User, error)
 	Delete(id uint) error
-	AllUsers(limit, page int) ([]User, error)
+	DeletedByEmail(email string) (*User, error)
+	Restore(id uint) error
+	AllUsers(p Pagination) ([]User, *PageInfo, error)
 }
 
 // UserService is a set of methods used to manipulate and
@@ -71,22 +78,56 @@ type UserService interface {
 	// ErrNotFound, ErrInvalidPassword, or another error if
 	// something goes wrong.
 	Authenticate(email, password string) (*User, error)
+	// Login is Authenticate for requests from the outside. Failed
+	// attempts are tracked per email and per ip and slow down, then
+	// lock out, whoever makes them with a *LoginThrottledError.
+	Login(email, password, ip string) (*User, error)
+	// PruneLoginAttempts forgets login attempts too old to count
+	// towards any limit. It is run periodically.
+	PruneLoginAttempts(now time.Time) error
+	// InitiateUnlock creates a token the owner of an account locked
+	// by failed logins can use to lift the lockout with CompleteUnlock.
+	InitiateUnlock(user *User) (string, error)
+	CompleteUnlock(token string) (*User, error)
 	// InitiateReset will start the reset password process
 	// by creating a reset token for the user found with the
 	// provided email address.
 	InitiateReset(email string) (string, error)
 	CompleteReset(token, newPw string) (*User, error)
+	// RestoreAccount brings back a deleted account, along with
+	// the books and reviews deleted with it, once the owner proves
+	// they know the password. Attempts count towards the same limits
+	// as Login and fail the same way.
+	RestoreAccount(email, password, ip string) (*User, error)
+	// InitiateVerification creates a token proving the user
+	// received mail at their current email address. It returns
+	// ErrVerificationThrottled when one was sent too recently.
+	InitiateVerification(user *User) (string, error)
+	// CompleteVerification marks the email address that the token
+	// was sent to as verified.
+	CompleteVerification(token string) (*User, error)
+	// SetRole, Suspend and Unsuspend are used by admins to
+	// manage other users.
+	SetRole(id uint, role Role) (*User, error)
+	Suspend(id uint) (*User, error)
+	Unsuspend(id uint) (*User, error)
 	UserDB
 }
 
-// NewUserService handles connection to the DB
-func NewUserService(db *gorm.DB) UserService {
+// NewUserService handles connection to the DB. pepper is appended to
+// passwords before they are hashed, hmacKey signs stored tokens and
+// policy is checked whenever a password is set.
+func NewUserService(db *gorm.DB, pepper, hmacKey string, policy PasswordPolicy) UserService {
 	ug := &userGorm{db}
-	hmac := hash.NewHMAC(hmacSecretKey)
-	uv := newUserValidator(ug, hmac)
+	hmac := hash.NewHMAC(hmacKey)
+	uv := newUserValidator(ug, pepper, policy)
 	return &userService{
-		UserDB:    uv,
-		pwResetDB: newPwResetValidator(&pwResetGorm{db}, hmac),
+		UserDB:              uv,
+		pepper:              pepper,
+		pwResetDB:           newPwResetValidator(&pwResetGorm{db}, hmac),
+		emailVerificationDB: newEmailVerificationValidator(&emailVerificationGorm{db}, hmac),
+		loginAttemptDB:      &loginAttemptGorm{db},
+		accountUnlockDB:     newAccountUnlockValidator(&accountUnlockGorm{db}, hmac),
 	}
 }
 
@@ -95,7 +136,11 @@ var _ UserService = &userService{}
 // userService struct
 type userService struct {
 	UserDB
-	pwResetDB pwResetDB
+	pepper              string
+	pwResetDB           pwResetDB
+	emailVerificationDB emailVerificationDB
+	loginAttemptDB      loginAttemptDB
+	accountUnlockDB     accountUnlockDB
 }
 
 // Authenticate can be used to authenticate a user with the
@@ -114,7 +159,7 @@ func (us *userService) Authenticate(email, password string) (*User, error) {
 		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(foundUser.PasswordHash), []byte(password+userPwPepper))
+	err = bcrypt.CompareHashAndPassword([]byte(foundUser.PasswordHash), []byte(password+us.pepper))
 	if err != nil {
 		switch err {
 		case bcrypt.ErrMismatchedHashAndPassword:
@@ -123,6 +168,9 @@ func (us *userService) Authenticate(email, password string) (*User, error) {
 			return nil, err
 		}
 	}
+	if foundUser.Suspended() {
+		return nil, ErrAccountSuspended
+	}
 
 	return foundUser, nil
 }
@@ -165,9 +213,99 @@ func (us *userService) CompleteReset(token, newPw string) (*User, error) {
 		return nil, err
 	}
 	us.pwResetDB.Delete(pwr.ID)
+	//* proving control of the inbox lifts a login lockout too
+	if err := us.loginAttemptDB.ClearFailures(updatedUser.Email); err != nil {
+		return nil, err
+	}
 	return updatedUser, nil
 }
 
+// InitiateVerification starts the email verification process
+func (us *userService) InitiateVerification(user *User) (string, error) {
+	if user.EmailVerified {
+		return "", ErrEmailAlreadyVerified
+	}
+	latest, err := us.emailVerificationDB.LatestByUserID(user.ID)
+	switch err {
+	case nil:
+		//* a changed address gets its link straight away
+		if latest.Email == user.Email && time.Since(latest.CreatedAt) < VerificationResendInterval {
+			return "", ErrVerificationThrottled
+		}
+	case ErrNotFound:
+	default:
+		return "", err
+	}
+	ev := emailVerification{
+		UserID: user.ID,
+		Email:  user.Email,
+	}
+	if err := us.emailVerificationDB.Create(&ev); err != nil {
+		return "", err
+	}
+	return ev.Token, nil
+}
+
+// CompleteVerification finalizes the process of email verification
+func (us *userService) CompleteVerification(token string) (*User, error) {
+	ev, err := us.emailVerificationDB.ByToken(token)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, ErrTokenInvalid
+		}
+		return nil, err
+	}
+	if time.Since(ev.CreatedAt) > VerificationDuration {
+		return nil, ErrTokenInvalid
+	}
+	user, err := us.ByID(ev.UserID)
+	if err != nil {
+		return nil, err
+	}
+	//* the address changed after this token was sent
+	if user.Email != ev.Email {
+		return nil, ErrTokenInvalid
+	}
+	user.EmailVerified = true
+	updatedUser, err := us.Update(user)
+	if err != nil {
+		return nil, err
+	}
+	us.emailVerificationDB.DeleteByUserID(user.ID)
+	return updatedUser, nil
+}
+
+// RestoreAccount verifies the credentials of a deleted account and
+// then restores it if it is still within RestoreWindow
+func (us *userService) RestoreAccount(email, password, ip string) (*User, error) {
+	deletedUser, err := us.throttledLogin(email, password, ip, us.authenticateDeleted)
+	if err != nil {
+		return nil, err
+	}
+	if err := us.UserDB.Restore(deletedUser.ID); err != nil {
+		return nil, err
+	}
+	return us.ByID(deletedUser.ID)
+}
+
+// authenticateDeleted is Authenticate for deleted accounts
+func (us *userService) authenticateDeleted(email, password string) (*User, error) {
+	deletedUser, err := us.DeletedByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(deletedUser.PasswordHash), []byte(password+us.pepper))
+	if err != nil {
+		switch err {
+		case bcrypt.ErrMismatchedHashAndPassword:
+			return nil, ErrPasswordIncorrect
+		default:
+			return nil, err
+		}
+	}
+	return deletedUser, nil
+}
+
 // * validators
 
 type userValFunc func(*User) error
@@ -186,16 +324,20 @@ var _ UserDB = &userValidator{}
 // userValidator struct holds the structure for theuser validation
 type userValidator struct {
 	UserDB
-	hmac       hash.HMAC
-	emailRegex *regexp.Regexp
+	pepper      string
+	policy      PasswordPolicy
+	emailRegex  *regexp.Regexp
+	localeRegex *regexp.Regexp
 }
 
 // newUserValidator function
-func newUserValidator(udb UserDB, hmac hash.HMAC) *userValidator {
+func newUserValidator(udb UserDB, pepper string, policy PasswordPolicy) *userValidator {
 	return &userValidator{
-		UserDB:     udb,
-		hmac:       hmac,
-		emailRegex: regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,16}$`),
+		UserDB:      udb,
+		pepper:      pepper,
+		policy:      policy,
+		emailRegex:  regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,16}$`),
+		localeRegex: regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`),
 	}
 }
 
@@ -210,55 +352,45 @@ func (uv *userValidator) ByEmail(email string) (*User, error) {
 	return uv.UserDB.ByEmail(user.Email)
 }
 
-// ByRemember will hash the remember token and then call
-// ByRemember on the subsequent UserDB layer.
-func (uv *userValidator) ByRemember(token string) (*User, error) {
-	user := User{
-		Remember: token,
-	}
-	if err := runUserValFuncs(&user, uv.hmacRemember); err != nil {
-		return nil, err
-	}
-	return uv.UserDB.ByRemember(user.RememberHash)
-}
-
 // Create will create the provided user and backfill data
 // like the ID, CreatedAt, and UpdatedAt fields.
 func (uv *userValidator) Create(user *User) (*User, error) {
 	err := runUserValFuncs(
 		user,
 		uv.passwordRequired,
-		uv.passwordMinLength,
+		uv.passwordPolicy,
 		uv.bcryptPassword,
 		uv.passwordHashRequired,
-		uv.setRememberIfUnset,
-		uv.rememberMinBytes,
-		uv.hmacRemember,
-		uv.rememberHashRequired,
 		uv.normalizeEmail,
 		uv.requireEmail,
 		uv.emailFormat,
-		uv.emailIsAvail)
+		uv.emailIsAvail,
+		uv.normalizeLocale,
+		uv.defaultNotifyPreference,
+		uv.notifyPreferenceValid,
+		uv.defaultRole,
+		uv.roleValid)
 	if err != nil {
 		return nil, err
 	}
 	return uv.UserDB.Create(user)
 }
 
-// Update will hash a remember token if it is provided.
+// Update will hash a new password if one is provided.
 func (uv *userValidator) Update(user *User) (*User, error) {
 	err := runUserValFuncs(
 		user,
-		uv.passwordMinLength,
+		uv.passwordPolicy,
 		uv.bcryptPassword,
 		uv.passwordHashRequired,
-		uv.rememberMinBytes,
-		uv.hmacRemember,
-		uv.rememberHashRequired,
 		uv.normalizeEmail,
 		uv.requireEmail,
 		uv.emailFormat,
-		uv.emailIsAvail)
+		uv.emailIsAvail,
+		uv.unverifyChangedEmail,
+		uv.normalizeLocale,
+		uv.notifyPreferenceValid,
+		uv.roleValid)
 	if err != nil {
 		return nil, err
 	}
@@ -276,50 +408,50 @@ func (uv *userValidator) Delete(id uint) error {
 	return uv.UserDB.Delete(id)
 }
 
-// bcryptPassword will hash a user's password with a
-// predefined pepper (userPwPepper) and bcrypt if the
-// Password field is not the empty string
-func (uv *userValidator) bcryptPassword(user *User) error {
-	if user.Password == "" {
-		return nil
+// DeletedByEmail normalizes the email before looking up a deleted user
+func (uv *userValidator) DeletedByEmail(email string) (*User, error) {
+	user := User{
+		Email: email,
 	}
-	pwBytes := []byte(user.Password + userPwPepper)
-	hashedBytes, err := bcrypt.GenerateFromPassword(pwBytes, bcrypt.DefaultCost)
+	if err := runUserValFuncs(&user, uv.normalizeEmail); err != nil {
+		return nil, err
+	}
+	return uv.UserDB.DeletedByEmail(user.Email)
+}
+
+// Restore will restore the deleted user with the provided ID
+func (uv *userValidator) Restore(id uint) error {
+	var user User
+	user.ID = id
+	err := runUserValFuncs(&user, uv.idGreaterThan(0))
 	if err != nil {
 		return err
 	}
-	user.PasswordHash = string(hashedBytes)
-	user.Password = ""
-	return nil
+	return uv.UserDB.Restore(id)
 }
 
-// hmacRemember to remember our token
-func (uv *userValidator) hmacRemember(user *User) error {
-	if user.Remember == "" {
-		return nil
+// AllUsers validates the page requested before listing users
+func (uv *userValidator) AllUsers(p Pagination) ([]User, *PageInfo, error) {
+	if err := p.normalize(); err != nil {
+		return nil, nil, err
 	}
-	user.RememberHash = uv.hmac.Hash(user.Remember)
-	return nil
+	return uv.UserDB.AllUsers(p)
 }
 
-// setRemember updates our remember value if unset
-func (uv *userValidator) setRememberIfUnset(user *User) error {
-	if user.Remember != "" {
+// bcryptPassword will hash a user's password with a
+// app's pepper and bcrypt if the
+// Password field is not the empty string
+func (uv *userValidator) bcryptPassword(user *User) error {
+	if user.Password == "" {
 		return nil
 	}
-	token, err := rand.RememberToken()
+	pwBytes := []byte(user.Password + uv.pepper)
+	hashedBytes, err := bcrypt.GenerateFromPassword(pwBytes, bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
-	user.Remember = token
-	return nil
-}
-
-// rememberHashRequired checks for a remember hash
-func (uv *userValidator) rememberHashRequired(user *User) error {
-	if user.RememberHash == "" {
-		return ErrRememberRequired
-	}
+	user.PasswordHash = string(hashedBytes)
+	user.Password = ""
 	return nil
 }
 
@@ -340,6 +472,20 @@ func (uv *userValidator) normalizeEmail(user *User) error {
 	return nil
 }
 
+// normalizeLocale lowercases the user's locale, falling back to
+// DefaultLocale, and checks it looks like a language tag such as en or pt-br
+func (uv *userValidator) normalizeLocale(user *User) error {
+	user.Locale = strings.ToLower(strings.TrimSpace(user.Locale))
+	user.Locale = strings.Replace(user.Locale, "_", "-", -1)
+	if user.Locale == "" {
+		user.Locale = DefaultLocale
+	}
+	if !uv.localeRegex.MatchString(user.Locale) {
+		return ErrLocaleInvalid
+	}
+	return nil
+}
+
 // requireEmail ensures the email field is passed in
 func (uv *userValidator) requireEmail(user *User) error {
 	if user.Email == "" {
@@ -363,8 +509,23 @@ func (uv *userValidator) emailFormat(user *User) error {
 func (uv *userValidator) emailIsAvail(user *User) error {
 	existing, err := uv.ByEmail(user.Email)
 	if err == ErrNotFound {
-		// Email address is available
-		return nil
+		//* a deleted user keeps their address while they may restore
+		//* their account, and the unique index still holds it
+		deleted, err := uv.UserDB.DeletedByEmail(user.Email)
+		if err == ErrNotFound {
+			// Email address is available
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if user.ID == deleted.ID {
+			return nil
+		}
+		if restorable(deleted.DeletedAt) == nil {
+			return ErrEmailDeleted
+		}
+		return ErrEmailTaken
 	}
 	if err != nil {
 		return err
@@ -378,17 +539,30 @@ func (uv *userValidator) emailIsAvail(user *User) error {
 	return nil
 }
 
-// passwordMinLength checks the length of the entered password
-func (uv *userValidator) passwordMinLength(user *User) error {
-	if user.Password == "" {
+// unverifyChangedEmail marks the email address unverified when an
+// update changes it
+func (uv *userValidator) unverifyChangedEmail(user *User) error {
+	if !user.EmailVerified {
 		return nil
 	}
-	if len(user.Password) < 8 {
-		return ErrPasswordTooShort
+	existing, err := uv.ByID(user.ID)
+	if err != nil {
+		return err
+	}
+	if existing.Email != user.Email {
+		user.EmailVerified = false
 	}
 	return nil
 }
 
+// passwordPolicy checks a new password against the password policy
+func (uv *userValidator) passwordPolicy(user *User) error {
+	if user.Password == "" || user.generatedPassword {
+		return nil
+	}
+	return uv.policy.Check(user.Password, user)
+}
+
 // passwordRequired ensures password is entered
 func (uv *userValidator) passwordRequired(user *User) error {
 	if user.Password == "" {
@@ -405,21 +579,6 @@ func (uv *userValidator) passwordHashRequired(user *User) error {
 	return nil
 }
 
-// rememberMinBytes function
-func (uv *userValidator) rememberMinBytes(user *User) error {
-	if user.Remember == "" {
-		return nil
-	}
-	n, err := rand.NBytes(user.Remember)
-	if err != nil {
-		return err
-	}
-	if n < 32 {
-		return ErrRememberTooShort
-	}
-	return nil
-}
-
 // * DB interfaces
 
 var _ UserDB = &userGorm{}
@@ -462,19 +621,6 @@ func (ug *userGorm) ByEmail(email string) (*User, error) {
 	return &user, err
 }
 
-// ByRemember looks up a user with the given remember token
-// and returns that user. This method expects the remember
-// token to already be hashed.
-// Errors are the same as ByEmail.
-func (ug *userGorm) ByRemember(rememberHash string) (*User, error) {
-	var user User
-	err := first(ug.db.Where("remember_hash = ?", rememberHash), &user)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
 // Create will create the provided user and backfill data
 // like the ID, CreatedAt, and UpdatedAt fields.
 func (ug *userGorm) Create(user *User) (*User, error) {
@@ -495,19 +641,118 @@ func (ug *userGorm) Update(user *User) (*User, error) {
 	return user, nil
 }
 
-// Delete will delete the user with the provided ID
+// Delete soft-deletes the user with the provided ID together with
+// their books, the reviews on those books and the reviews they wrote.
+// Everything shares one deletion time so that Restore can bring back
+// exactly what was removed here.
 func (ug *userGorm) Delete(id uint) error {
-	user := User{ID: id}
-	return ug.db.Delete(&user).Error
+	now := gorm.NowFunc()
+	return transaction(ug.db, func(tx *gorm.DB) error {
+		res := tx.Model(&User{}).Where("id = ?", id).UpdateColumn("deleted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		var reviewed []uint
+		err := tx.Model(&Review{}).Where("user_id = ?", id).Pluck("DISTINCT book_id", &reviewed).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Review{}).
+			Where("user_id = ? OR book_id IN (SELECT id FROM books WHERE user_id = ?)", id, id).
+			UpdateColumn("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Book{}).Where("user_id = ?", id).UpdateColumn("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+		return refreshBookRatings(tx, reviewed)
+	})
 }
 
-// AllUsers returns users in our DB in paginated format
-func (ug *userGorm) AllUsers(limit, page int) ([]User, error) {
-	dataOffset := (limit * page) - limit
-	var users []User
-	err := ug.db.Limit(limit).Offset(dataOffset).Order("created_at DESC", true).Find(&users).Error
+// DeletedByEmail looks up a soft-deleted user by their email address
+func (ug *userGorm) DeletedByEmail(email string) (*User, error) {
+	var user User
+	err := first(ug.db.Unscoped().Where("email = ? AND deleted_at IS NOT NULL", email), &user)
 	if err != nil {
 		return nil, err
 	}
-	return users, nil
+	return &user, nil
+}
+
+// Restore brings back a deleted user and everything that was deleted
+// along with them, as long as it is within RestoreWindow
+func (ug *userGorm) Restore(id uint) error {
+	var user User
+	err := first(ug.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id), &user)
+	if err != nil {
+		return err
+	}
+	if err := restorable(user.DeletedAt); err != nil {
+		return err
+	}
+	deletedAt := *user.DeletedAt
+	return transaction(ug.db, func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&User{}).Where("id = ?", id).UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&Book{}).
+			Where("user_id = ? AND deleted_at = ?", id, deletedAt).
+			UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		var reviewed []uint
+		err = tx.Unscoped().Model(&Review{}).
+			Where("user_id = ? AND deleted_at = ?", id, deletedAt).
+			Pluck("DISTINCT book_id", &reviewed).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&Review{}).
+			Where("(user_id = ? OR book_id IN (SELECT id FROM books WHERE user_id = ?)) AND deleted_at = ?", id, id, deletedAt).
+			UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		return refreshBookRatings(tx, reviewed)
+	})
+}
+
+// AllUsers returns a page of users, newest first, along with
+// the total number of users
+func (ug *userGorm) AllUsers(p Pagination) ([]User, *PageInfo, error) {
+	db := ug.db.Model(&User{})
+
+	var total int
+	if err := db.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	db, err := pageQuery(db, "users", true, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	var users []User
+	if err := db.Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]cursor, len(users))
+	for i, user := range users {
+		keys[i] = cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+	}
+	info, n := newPageInfo(p, total, keys)
+	users = users[:n]
+	if p.Before != "" {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	return users, info, nil
 }
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// softDeletedUsers is a UserDB holding live and soft-deleted users
+type softDeletedUsers struct {
+	UserDB
+	users []*User
+}
+
+func (s *softDeletedUsers) ByEmail(email string) (*User, error) {
+	for _, user := range s.users {
+		if user.Email == email && user.DeletedAt == nil {
+			return user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *softDeletedUsers) DeletedByEmail(email string) (*User, error) {
+	for _, user := range s.users {
+		if user.Email == email && user.DeletedAt != nil {
+			return user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func TestEmailIsAvail(t *testing.T) {
+	recently := time.Now().Add(-time.Hour)
+	longAgo := time.Now().Add(-2 * RestoreWindow)
+	uv := &userValidator{UserDB: &softDeletedUsers{users: []*User{
+		{ID: 1, Email: "live@example.com"},
+		{ID: 2, Email: "deleted@example.com", DeletedAt: &recently},
+		{ID: 3, Email: "expired@example.com", DeletedAt: &longAgo},
+	}}}
+
+	tests := []struct {
+		name string
+		user User
+		want error
+	}{
+		{"unused address", User{Email: "new@example.com"}, nil},
+		{"address of a live user", User{Email: "live@example.com"}, ErrEmailTaken},
+		{"the user's own address", User{ID: 1, Email: "live@example.com"}, nil},
+		{"address of a deleted user", User{Email: "deleted@example.com"}, ErrEmailDeleted},
+		{"deleted user's own address", User{ID: 2, Email: "deleted@example.com"}, nil},
+		{"address of a user deleted too long ago to restore", User{Email: "expired@example.com"}, ErrEmailTaken},
+	}
+	for _, tt := range tests {
+		if err := uv.emailIsAvail(&tt.user); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
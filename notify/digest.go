@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DigestScheduler sends the daily digest once a day at a set hour (UTC)
+type DigestScheduler struct {
+	notifier *Notifier
+	hour     int
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDigestScheduler creates a scheduler that sends digests every day
+// at hour, from 0 to 23. Call Start to begin.
+func NewDigestScheduler(notifier *Notifier, hour int) *DigestScheduler {
+	return &DigestScheduler{
+		notifier: notifier,
+		hour:     hour,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start launches the scheduler goroutine
+func (ds *DigestScheduler) Start() {
+	ds.wg.Add(1)
+	go ds.loop()
+}
+
+// Stop asks the scheduler to stop and waits for a digest run in
+// progress to finish
+func (ds *DigestScheduler) Stop() {
+	close(ds.stop)
+	ds.wg.Wait()
+}
+
+func (ds *DigestScheduler) loop() {
+	defer ds.wg.Done()
+	for {
+		select {
+		case <-ds.stop:
+			return
+		case <-time.After(time.Until(nextRun(time.Now(), ds.hour))):
+			if err := ds.notifier.SendDigests(); err != nil {
+				slogger.ServerError(context.Background(), err.Error())
+			}
+		}
+	}
+}
+
+// nextRun returns the first time after now that falls on hour
+func nextRun(now time.Time, hour int) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
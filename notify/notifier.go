@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sajicode/go-book/email"
+	"github.com/sajicode/go-book/logger"
+	"github.com/sajicode/go-book/models"
+)
+
+// * logger
+var slogger = logger.NewLogger()
+
+// Notifier turns events in the app into notifications for the users
+// they concern, emailing them according to their preference
+type Notifier struct {
+	ns      models.NotificationService
+	us      models.UserService
+	emailer *email.Client
+}
+
+// NewNotifier is used to create a new notifier
+func NewNotifier(ns models.NotificationService, us models.UserService, emailer *email.Client) *Notifier {
+	return &Notifier{
+		ns:      ns,
+		us:      us,
+		emailer: emailer,
+	}
+}
+
+// ReviewCreated notifies a book's owner that review was posted on it.
+// Owners are not notified about their own reviews.
+func (n *Notifier) ReviewCreated(review *models.Review, book *models.Book) error {
+	if review.UserID == book.UserID {
+		return nil
+	}
+	owner, err := n.us.ByID(book.UserID)
+	if err != nil {
+		return err
+	}
+	reviewer, err := n.us.ByID(review.UserID)
+	if err != nil {
+		return err
+	}
+	reviewerName := strings.TrimSpace(reviewer.FirstName + " " + reviewer.LastName)
+
+	notification := models.Notification{
+		UserID:   owner.ID,
+		ActorID:  reviewer.ID,
+		Type:     models.NotificationNewReview,
+		BookID:   book.ID,
+		ReviewID: review.ID,
+		Message:  fmt.Sprintf("%s reviewed %q", reviewerName, book.Title),
+	}
+	if err := n.ns.Create(&notification); err != nil {
+		return err
+	}
+
+	if owner.NotifyPreference != models.NotifyImmediate {
+		return nil
+	}
+	err = n.emailer.NewReview(recipient(owner), email.ReviewNotice{
+		Reviewer: reviewerName,
+		Book:     book.Title,
+		BookID:   book.ID,
+		Rating:   review.Rating,
+		Notes:    review.Notes,
+	})
+	if err != nil {
+		return err
+	}
+	return n.ns.MarkEmailed(notification.ID)
+}
+
+// SendDigests emails every user on the daily digest a summary of their
+// notifications that have not been emailed or read yet
+func (n *Notifier) SendDigests() error {
+	ids, err := n.ns.DigestUserIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := n.sendDigest(id); err != nil {
+			slogger.ServerError(context.Background(), fmt.Sprintf("digest for user %d: %v", id, err))
+		}
+	}
+	return nil
+}
+
+func (n *Notifier) sendDigest(userID uint) error {
+	user, err := n.us.ByID(userID)
+	if err != nil {
+		return err
+	}
+	notifications, err := n.ns.ClaimDigest(userID)
+	if err != nil || len(notifications) == 0 {
+		return err
+	}
+	items := make([]email.DigestItem, len(notifications))
+	for i, notification := range notifications {
+		items[i] = email.DigestItem{
+			Message: notification.Message,
+			BookID:  notification.BookID,
+		}
+	}
+	return n.emailer.Digest(recipient(user), items)
+}
+
+// recipient addresses an email to user in their language
+func recipient(user *models.User) email.Recipient {
+	return email.Recipient{
+		Name:   user.FirstName,
+		Email:  user.Email,
+		Locale: user.Locale,
+	}
+}
@@ -0,0 +1,194 @@
+// Package oidctest runs an OpenID Connect provider for tests.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// KeyID names the signing key of an Issuer
+const KeyID = "test-key"
+
+// Issuer serves discovery, its signing keys and a token endpoint that
+// checks the client secret and PKCE verifier. Users sign in at it
+// through Authorize instead of a login page.
+type Issuer struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// Key is published at the keys endpoint
+	Key *rsa.PrivateKey
+	// Signer signs ID tokens. It is Key unless a test swaps it.
+	Signer *rsa.PrivateKey
+	// Claims can change the claims of the ID tokens issued
+	Claims func(claims map[string]interface{})
+	// ReportedIssuer is reported in discovery instead of the URL of
+	// the server when set
+	ReportedIssuer string
+
+	mu            sync.Mutex
+	codes         map[string]authorization
+	tokenRequests int
+}
+
+// authorization is what the issuer remembers about a code it handed out
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+// NewIssuer starts an Issuer for one client. It must be closed when
+// the test is done.
+func NewIssuer(t *testing.T, clientID, clientSecret, redirectURL string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Key:          key,
+		Signer:       key,
+		codes:        map[string]authorization{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/keys", i.keys)
+	mux.HandleFunc("/token", i.token)
+	i.Server = httptest.NewServer(mux)
+	return i
+}
+
+// Authorize signs the user in at authURL and returns the code and state
+// that the provider would redirect back to the client with
+func (i *Issuer) Authorize(t *testing.T, authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("response_type") != "code" || q.Get("client_id") != i.ClientID ||
+		q.Get("redirect_uri") != i.RedirectURL || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected auth code URL %s", authURL)
+	}
+	code = "code-" + q.Get("state")
+	i.mu.Lock()
+	i.codes[code] = authorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	i.mu.Unlock()
+	return code, q.Get("state")
+}
+
+// TokenRequests counts the calls to the token endpoint
+func (i *Issuer) TokenRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.tokenRequests
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := i.ReportedIssuer
+	if issuer == "" {
+		issuer = i.URL
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                 issuer,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/keys",
+	})
+}
+
+func (i *Issuer) keys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(i.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.Key.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.tokenRequests++
+
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	if id, secret, ok := r.BasicAuth(); !ok || id != i.ClientID || secret != i.ClientSecret {
+		fail("invalid_client")
+		return
+	}
+	code := r.PostFormValue("code")
+	auth, ok := i.codes[code]
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != i.RedirectURL {
+		fail("invalid_grant")
+		return
+	}
+	//* a code can only be tried once, right or wrong
+	delete(i.codes, code)
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":            i.URL,
+		"sub":            "user-1",
+		"aud":            i.ClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          auth.nonce,
+		"email":          "reader@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+		"family_name":    "Lovelace",
+	}
+	if i.Claims != nil {
+		i.Claims(claims)
+	}
+	token, err := i.sign(claims)
+	if err != nil {
+		fail("server_error")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": token})
+}
+
+func (i *Issuer) sign(claims map[string]interface{}) (string, error) {
+	var segments [2]string
+	for n, v := range []interface{}{map[string]string{"alg": "RS256", "kid": KeyID}, claims} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		segments[n] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	payload := segments[0] + "." + segments[1]
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.Signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
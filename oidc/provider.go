@@ -0,0 +1,239 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sajicode/go-book/rand"
+)
+
+// DefaultScopes are asked for when a provider has none configured
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// httpTimeout bounds every call made to a provider
+const httpTimeout = 10 * time.Second
+
+// Config is how to reach one OpenID Connect provider
+type Config struct {
+	// Name identifies the provider in URLs and linked identities
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is our callback, registered with the provider
+	RedirectURL string
+	Scopes      []string
+}
+
+// discovery is the part of the provider metadata we use, from
+// <issuer>/.well-known/openid-configuration
+type discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Provider runs the authorization code flow against one provider. Its
+// metadata is fetched on first use, so the app starts even when the
+// provider is down.
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *discovery
+	keys *keySet
+}
+
+// NewProvider creates a Provider for cfg
+func NewProvider(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = DefaultScopes
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Provider{
+		Config: cfg,
+		client: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// metadata returns the discovery document, fetching it once
+func (p *Provider) metadata(ctx context.Context) (*discovery, *keySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, p.keys, nil
+	}
+
+	var meta discovery
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != p.Issuer {
+		return nil, nil, fmt.Errorf("oidc: %s reports issuer %q", p.Issuer, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("oidc: %s metadata is missing endpoints", p.Issuer)
+	}
+	p.meta = &meta
+	p.keys = newKeySet(meta.JWKSURI, p.getJSON)
+	return p.meta, p.keys, nil
+}
+
+// Flow holds the values that tie the callback to the login it
+// completes. They must be kept by the client, e.g. in a signed cookie,
+// between AuthCodeURL and Exchange.
+type Flow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// NewFlow creates a random state, nonce and PKCE verifier
+func NewFlow() (*Flow, error) {
+	var values [3]string
+	for i := range values {
+		value, err := rand.Bytes(32)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(value)
+	}
+	return &Flow{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// challenge is the S256 PKCE code challenge for the verifier
+func (f *Flow) challenge() string {
+	sum := sha256.Sum256([]byte(f.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where to send the user to sign in with the provider
+func (p *Provider) AuthCodeURL(ctx context.Context, flow *Flow) (string, error) {
+	meta, _, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", flow.State)
+	params.Set("nonce", flow.Nonce)
+	params.Set("code_challenge", flow.challenge())
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// tokenResponse is the reply of the token endpoint
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades the code from the callback for an ID token and
+// returns its verified claims
+func (p *Provider) Exchange(ctx context.Context, code string, flow *Flow) (*Claims, error) {
+	meta, keys, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", flow.Verifier)
+	basicAuth := p.ClientSecret != "" && p.supportsBasicAuth(meta)
+	if p.ClientSecret != "" && !basicAuth {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequest("POST", meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basicAuth {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("oidc: token response: %v", err)
+	}
+	if token.Error != "" {
+		if token.ErrorDescription != "" {
+			return nil, fmt.Errorf("oidc: token request failed: %s: %s", token.Error, token.ErrorDescription)
+		}
+		return nil, fmt.Errorf("oidc: token request failed: %s", token.Error)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token request failed with status %d", res.StatusCode)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+	return p.verify(ctx, keys, token.IDToken, flow.Nonce, time.Now())
+}
+
+// supportsBasicAuth reports whether the client secret is sent with
+// HTTP basic auth, the default when the provider does not say
+func (p *Provider) supportsBasicAuth(meta *discovery) bool {
+	if len(meta.TokenAuthMethods) == 0 {
+		return true
+	}
+	for _, method := range meta.TokenAuthMethods {
+		if method == "client_secret_basic" {
+			return true
+		}
+	}
+	return false
+}
+
+// getJSON fetches url into dst
+func (p *Provider) getJSON(ctx context.Context, url string, dst interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, res.Body)
+		return fmt.Errorf("oidc: GET %s returned status %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(dst)
+}
@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sajicode/go-book/oidc/oidctest"
+)
+
+const (
+	testClientID     = "client-id"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://books.example.com/api/auth/oidc/test/callback"
+)
+
+func newTestProvider(issuer *oidctest.Issuer) *Provider {
+	return NewProvider(Config{
+		Name:         "test",
+		Issuer:       issuer.URL + "/",
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+}
+
+func TestExchange(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// change sets up the issuer or the flow after the user signed
+		// in at the provider
+		change  func(issuer *oidctest.Issuer, flow *Flow)
+		wantErr string
+	}{
+		{"valid", nil, ""},
+		{"nonce mismatch", func(issuer *oidctest.Issuer, flow *Flow) {
+			flow.Nonce = "another-nonce"
+		}, "nonce does not match"},
+		{"PKCE verifier mismatch", func(issuer *oidctest.Issuer, flow *Flow) {
+			flow.Verifier = "another-verifier"
+		}, "invalid_grant"},
+		{"signed with another key", func(issuer *oidctest.Issuer, flow *Flow) {
+			issuer.Signer = otherKey
+		}, ErrTokenInvalid.Error()},
+		{"wrong issuer", func(issuer *oidctest.Issuer, flow *Flow) {
+			issuer.Claims = func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }
+		}, "issued by"},
+		{"wrong audience", func(issuer *oidctest.Issuer, flow *Flow) {
+			issuer.Claims = func(c map[string]interface{}) { c["aud"] = "another-client" }
+		}, "not meant for us"},
+		{"shared audience without azp", func(issuer *oidctest.Issuer, flow *Flow) {
+			issuer.Claims = func(c map[string]interface{}) { c["aud"] = []string{testClientID, "another-client"} }
+		}, "not issued to us"},
+		{"expired", func(issuer *oidctest.Issuer, flow *Flow) {
+			issuer.Claims = func(c map[string]interface{}) { c["exp"] = time.Now().Add(-2 * leeway).Unix() }
+		}, "expired"},
+		{"issued in the future", func(issuer *oidctest.Issuer, flow *Flow) {
+			issuer.Claims = func(c map[string]interface{}) { c["iat"] = time.Now().Add(2 * leeway).Unix() }
+		}, "in the future"},
+		{"no subject", func(issuer *oidctest.Issuer, flow *Flow) {
+			issuer.Claims = func(c map[string]interface{}) { delete(c, "sub") }
+		}, "no subject"},
+	}
+	for _, tt := range tests {
+		issuer := oidctest.NewIssuer(t, testClientID, testClientSecret, testRedirectURL)
+		p := newTestProvider(issuer)
+		ctx := context.Background()
+		flow, err := NewFlow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		authURL, err := p.AuthCodeURL(ctx, flow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := issuer.Authorize(t, authURL)
+		if tt.change != nil {
+			tt.change(issuer, flow)
+		}
+
+		claims, err := p.Exchange(ctx, code, flow)
+		issuer.Close()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want it to mention %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if claims.Subject != "user-1" || claims.Email != "reader@example.com" || !bool(claims.EmailVerified) {
+			t.Errorf("%s: claims = %+v", tt.name, claims)
+		}
+	}
+}
+
+func TestExchangeCodeOnce(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID, testClientSecret, testRedirectURL)
+	defer issuer.Close()
+	p := newTestProvider(issuer)
+	ctx := context.Background()
+	flow, err := NewFlow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := issuer.Authorize(t, authURL)
+	if _, err := p.Exchange(ctx, code, flow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, flow); err == nil {
+		t.Error("a code was exchanged twice")
+	}
+}
+
+func TestMetadataChecksIssuer(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID, testClientSecret, testRedirectURL)
+	defer issuer.Close()
+	issuer.ReportedIssuer = "https://evil.example.com"
+	_, err := newTestProvider(issuer).AuthCodeURL(context.Background(), &Flow{})
+	if err == nil || !strings.Contains(err.Error(), "reports issuer") {
+		t.Errorf("err = %v, want the issuer to be refused", err)
+	}
+}
@@ -0,0 +1,233 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leeway allows for clock drift between us and the provider
+const leeway = time.Minute
+
+// refreshInterval is the least time between two fetches of the keys,
+// so tokens with unknown key IDs cannot make us hammer the provider
+const refreshInterval = time.Minute
+
+// ErrTokenInvalid is returned for an ID token that fails verification
+var ErrTokenInvalid = errors.New("oidc: id token is not valid")
+
+// Claims are the ID token claims we use
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+	Picture       string   `json:"picture"`
+}
+
+// audience is a single audience or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// flexBool accepts true as well as "true", as some providers send
+// email_verified as a string
+type flexBool bool
+
+func (f *flexBool) UnmarshalJSON(b []byte) error {
+	switch strings.Trim(string(b), `"`) {
+	case "true":
+		*f = true
+	case "false", "null", "":
+		*f = false
+	default:
+		return fmt.Errorf("oidc: %s is not a boolean", b)
+	}
+	return nil
+}
+
+// verify checks the signature and claims of an ID token. Only RS256 is
+// accepted, as the spec requires providers to support it.
+func (p *Provider) verify(ctx context.Context, keys *keySet, token, nonce string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("oidc: id token is signed with %q, only RS256 is supported", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	key, err := keys.key(ctx, header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.Issuer:
+		return nil, fmt.Errorf("oidc: id token was issued by %q", claims.Issuer)
+	case !claims.Audience.contains(p.ClientID):
+		return nil, errors.New("oidc: id token is not meant for us")
+	case len(claims.Audience) > 1 && claims.AuthorizedBy != p.ClientID:
+		return nil, errors.New("oidc: id token was not issued to us")
+	case now.After(time.Unix(claims.Expiry, 0).Add(leeway)):
+		return nil, errors.New("oidc: id token has expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(leeway)):
+		return nil, errors.New("oidc: id token was issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, errors.New("oidc: id token nonce does not match")
+	case claims.Subject == "":
+		return nil, errors.New("oidc: id token has no subject")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, dst interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// keySet caches the signing keys of a provider, fetching them again
+// when a token names a key we do not know, i.e. after key rotation
+type keySet struct {
+	uri   string
+	fetch func(ctx context.Context, url string, dst interface{}) error
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(uri string, fetch func(ctx context.Context, url string, dst interface{}) error) *keySet {
+	return &keySet{uri: uri, fetch: fetch}
+}
+
+// jwk is one key of a JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (ks *keySet) key(ctx context.Context, kid string, now time.Time) (*rsa.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	if now.Sub(ks.fetchedAt) < refreshInterval {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := ks.fetch(ctx, ks.uri, &set); err != nil {
+		return nil, err
+	}
+	ks.fetchedAt = now
+	ks.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.rsa()
+		if err != nil {
+			continue
+		}
+		ks.keys[k.Kid] = key
+	}
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+// lookup finds the key with kid, or the only key when the token does
+// not name one
+func (ks *keySet) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (k jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+		return nil, errors.New("oidc: rsa exponent is not valid")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
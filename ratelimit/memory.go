@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often stores drop buckets that have refilled,
+// as a full bucket is the same as no bucket
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in this process. Each instance of the app
+// counts on its own, so use PostgresStore when running several.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	full time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*memoryBucket{},
+	}
+}
+
+// Take implements Store
+func (ms *MemoryStore) Take(key string, p Policy, now time.Time) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if now.Sub(ms.lastSweep) > sweepInterval {
+		ms.sweep(now)
+	}
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: newBucket(p, now)}
+		ms.buckets[key] = b
+	}
+	result := b.take(p, now)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+func (ms *MemoryStore) sweep(now time.Time) {
+	for key, b := range ms.buckets {
+		if !b.full.After(now) {
+			delete(ms.buckets, key)
+		}
+	}
+	ms.lastSweep = now
+}
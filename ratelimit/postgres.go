@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// PostgresStore keeps buckets in the rate_limits table, so that every
+// instance of the app shares them
+type PostgresStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresStore creates a store using db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take implements Store. The bucket row is locked while it is updated
+// so that concurrent requests for a key cannot both spend its last
+// token.
+func (ps *PostgresStore) Take(key string, p Policy, now time.Time) (Result, error) {
+	if ps.shouldSweep(now) {
+		//* a failed sweep only leaves a few rows behind
+		ps.db.Exec(`DELETE FROM rate_limits WHERE full_at < $1`, now)
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	full := newBucket(p, now)
+	_, err = tx.Exec(`INSERT INTO rate_limits (key, tokens, updated_at, full_at)
+		VALUES ($1, $2, $3, $3) ON CONFLICT (key) DO NOTHING`, key, full.tokens, now)
+	if err != nil {
+		return Result{}, err
+	}
+	var b bucket
+	err = tx.QueryRow(`SELECT tokens, updated_at FROM rate_limits WHERE key = $1 FOR UPDATE`, key).
+		Scan(&b.tokens, &b.updated)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := b.take(p, now)
+	_, err = tx.Exec(`UPDATE rate_limits SET tokens = $2, updated_at = $3, full_at = $4 WHERE key = $1`,
+		key, b.tokens, b.updated, now.Add(result.Reset))
+	if err != nil {
+		return Result{}, err
+	}
+	return result, tx.Commit()
+}
+
+func (ps *PostgresStore) shouldSweep(now time.Time) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if now.Sub(ps.lastSweep) <= sweepInterval {
+		return false
+	}
+	ps.lastSweep = now
+	return true
+}
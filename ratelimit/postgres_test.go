@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// TestPostgresStore needs a database, named by TEST_DATABASE_URL, that
+// it may create the rate_limits table in
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	schema, err := ioutil.ReadFile("../migrations/0003_rate_limits.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DO $$ BEGIN ` + string(schema) + ` EXCEPTION WHEN duplicate_table THEN END $$`); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+	defer db.Exec(`DELETE FROM rate_limits WHERE key LIKE $1`, prefix+"%")
+	testStore(t, prefix, func() Store { return NewPostgresStore(db) })
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a token bucket: it holds up to Limit tokens and refills at
+// Limit tokens per Period. Every request takes one token.
+type Policy struct {
+	// Name keeps the buckets of different policies apart
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// ParsePolicy reads a policy written as <limit>/<period>, e.g. 5/1h
+func ParsePolicy(name, value string) (Policy, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Policy{}, fmt.Errorf("rate limit %q must look like 5/1h", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit < 1 {
+		return Policy{}, fmt.Errorf("rate limit %q must allow at least one request", value)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %q must have a positive period such as 1m", value)
+	}
+	return Policy{Name: name, Limit: limit, Period: period}, nil
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("%d/%s", p.Limit, p.Period)
+}
+
+// rate is how many tokens are added back per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is how many tokens are left in the bucket
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when not Allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Take must be safe to call concurrently.
+type Store interface {
+	// Take removes a token from the bucket of policy p for key
+	Take(key string, p Policy, now time.Time) (Result, error)
+}
+
+// bucket is the state a store keeps for each key
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newBucket is a full bucket
+func newBucket(p Policy, now time.Time) bucket {
+	return bucket{tokens: float64(p.Limit), updated: now}
+}
+
+// take refills b for the time passed since it was last updated and
+// takes a token if there is one
+func (b *bucket) take(p Policy, now time.Time) Result {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(p.Limit), b.tokens+elapsed.Seconds()*p.rate())
+		b.updated = now
+	}
+	result := Result{Limit: p.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / p.rate())
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = b.fullIn(p)
+	return result
+}
+
+// fullIn is how long until b holds Limit tokens again
+func (b *bucket) fullIn(p Policy) time.Duration {
+	return seconds((float64(p.Limit) - b.tokens) / p.rate())
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// start is the time the fake clock of the tests starts at
+var start = time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("login", " 5 / 1m ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "login" || p.Limit != 5 || p.Period != time.Minute || p.String() != "5/1m0s" {
+		t.Errorf("policy = %+v", p)
+	}
+	for _, bad := range []string{"", "5", "0/1m", "-1/1m", "x/1m", "5/0s", "5/soon"} {
+		if _, err := ParsePolicy("login", bad); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
+
+// testStore runs the behaviour every Store must have against the store
+// returned by newStore. Keys are prefixed so that stores shared between
+// runs start out empty.
+func testStore(t *testing.T, prefix string, newStore func() Store) {
+	p := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+
+	t.Run("burst then refill", func(t *testing.T) {
+		s := newStore()
+		key := prefix + "burst"
+		for i := 0; i < p.Limit; i++ {
+			r, err := s.Take(key, p, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !r.Allowed || r.Remaining != p.Limit-i-1 || r.Limit != p.Limit {
+				t.Fatalf("take %d = %+v, want allowed with %d left", i+1, r, p.Limit-i-1)
+			}
+		}
+		r, err := s.Take(key, p, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Allowed || r.RetryAfter != time.Second || r.Reset != 3*time.Second {
+			t.Fatalf("take past the burst = %+v, want refused, retry after 1s and full in 3s", r)
+		}
+
+		r, err = s.Take(key, p, start.Add(500*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Allowed || r.RetryAfter != 500*time.Millisecond {
+			t.Fatalf("take half a token later = %+v, want refused, retry after 500ms", r)
+		}
+		r, err = s.Take(key, p, start.Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.Allowed || r.Remaining != 0 {
+			t.Fatalf("take a token later = %+v, want allowed with none left", r)
+		}
+
+		//* an idle bucket refills to Limit and no further
+		for i := 0; i < p.Limit; i++ {
+			if r, _ := s.Take(key, p, start.Add(time.Hour)); !r.Allowed {
+				t.Fatalf("take %d after an hour = %+v, want allowed", i+1, r)
+			}
+		}
+		if r, _ := s.Take(key, p, start.Add(time.Hour)); r.Allowed {
+			t.Fatalf("take past the burst after an hour = %+v, want refused", r)
+		}
+	})
+
+	t.Run("keys are counted apart", func(t *testing.T) {
+		s := newStore()
+		for i := 0; i < p.Limit; i++ {
+			s.Take(prefix+"a", p, start)
+		}
+		if r, _ := s.Take(prefix+"a", p, start); r.Allowed {
+			t.Fatalf("a = %+v, want refused", r)
+		}
+		r, err := s.Take(prefix+"b", p, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.Allowed || r.Remaining != p.Limit-1 {
+			t.Errorf("b = %+v, want a full bucket of its own", r)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, "", func() Store { return NewMemoryStore() })
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	p := Policy{Name: "test", Limit: 2, Period: time.Second}
+	s := NewMemoryStore()
+	s.Take("idle", p, start)
+	s.Take("busy", p, start.Add(2*sweepInterval))
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("a bucket that had refilled was kept")
+	}
+	if _, ok := s.buckets["busy"]; !ok {
+		t.Error("a bucket in use was dropped")
+	}
+}
@@ -0,0 +1,121 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 Appendix B, SHA-1
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestRFC6238Vectors(t *testing.T) {
+	key, err := encoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range rfcVectors {
+		step := Step(time.Unix(v.unix, 0))
+		if got := hotp(key, step, 8); got != v.code {
+			t.Errorf("T=%d: 8 digit code = %s, want %s", v.unix, got, v.code)
+		}
+		//* the 6 digit code apps show is the end of the 8 digit one
+		got, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := v.code[2:]; got != want {
+			t.Errorf("T=%d: code = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -1, true},
+		{"one step ahead", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, current+tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, 0)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && step != current+tt.offset {
+			t.Errorf("%s: step = %d, want %d", tt.name, step, current+tt.offset)
+		}
+	}
+}
+
+func TestValidateRefusesUsedSteps(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code, err := Code(rfcSecret, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, code, now, 0)
+	if !ok || step != current {
+		t.Fatalf("first use: step = %d, ok = %v, want %d", step, ok, current)
+	}
+	if _, ok := Validate(rfcSecret, code, now, step); ok {
+		t.Error("a code was accepted twice")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(Period), step); ok {
+		t.Error("a code was accepted again in the next period")
+	}
+	//* a later code is still good after an earlier one was used
+	next, err := Code(rfcSecret, current+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, ok := Validate(rfcSecret, next, now, current); !ok || step != current+1 {
+		t.Errorf("next code: step = %d, ok = %v, want %d", step, ok, current+1)
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(rfcSecret, " "+code[:3]+" "+code[3:]+" ", now, 0); !ok {
+		t.Error("a code with spaces was refused")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(rfcSecret, bad, now, 0); ok {
+			t.Errorf("code %q was accepted", bad)
+		}
+	}
+	if _, ok := Validate("not base32!", code, now, 0); ok {
+		t.Error("a code was accepted for a broken secret")
+	}
+}
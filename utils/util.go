@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 )
 
@@ -10,13 +11,36 @@ func Fail(status string, message string) map[string]interface{} {
 	return map[string]interface{}{"status": status, "message": message}
 }
 
+// FailWith returns a formatted error response to the client along
+// with the error itself, for clients to tell errors apart by
+func FailWith(status string, message string, err interface{}) map[string]interface{} {
+	return map[string]interface{}{"status": status, "message": message, "error": err}
+}
+
 // Message returns a formatted success response to the client
 func Success(status string, data interface{}) map[string]interface{} {
 	return map[string]interface{}{"status": status, "data": data}
 }
 
+// SuccessPage returns a formatted success response to the client
+// along with the pagination details of a listing
+func SuccessPage(status string, data interface{}, pagination interface{}) map[string]interface{} {
+	return map[string]interface{}{"status": status, "data": data, "pagination": pagination}
+}
+
 // Respond returns a formatted http response to the client
 func Respond(w http.ResponseWriter, data interface{}) {
 	w.Header().Add("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
+
+// ClientIP returns the address of the client that made the request.
+// Behind a proxy this relies on middleware.RealIP, as X-Forwarded-For
+// can only be trusted when our own proxy set it.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}